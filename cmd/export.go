@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"ozon_test/config"
+	"ozon_test/internal/services"
+	"ozon_test/internal/storage"
+)
+
+const exportUsage = `использование: main -storage=<postgres|sqlite> export -type <posts|comments> [флаги]`
+
+// runExport выполняет подкоманду export с аргументами args: выгружает
+// посты или комментарии в stdout или файл.
+func runExport(cfg *config.Config, storageType string, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), exportUsage)
+		flags.PrintDefaults()
+	}
+	target := flags.String("type", "", "Что выгрузить: posts или comments")
+	format := flags.String("format", services.ExportNDJSON, "Формат: ndjson или csv")
+	fromValue := flags.String("from", "", "Начало периода по времени создания: 2006-01-02 или RFC 3339")
+	toValue := flags.String("to", "", "Конец периода (не включается): 2006-01-02 или RFC 3339")
+	afterID := flags.Int("after", 0, "Выгружать записи с ID больше указанного, чтобы продолжить прерванную выгрузку")
+	output := flags.String("o", "", "Файл выгрузки (по умолчанию stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter := storage.ExportFilter{AfterID: *afterID}
+	var err error
+	if filter.From, err = services.ParseExportDate(*fromValue); err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	if filter.To, err = services.ParseExportDate(*toValue); err != nil {
+		return fmt.Errorf("-to: %w", err)
+	}
+
+	exportStorage, closeStorage, err := openExportStorage(cfg, storageType)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := bufio.NewWriterSize(out, 64<<10)
+	lastID, err := services.NewExportService(exportStorage).Export(writer, *target, *format, filter)
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	if errors.Is(err, services.ErrInvalidExportTarget) || errors.Is(err, services.ErrInvalidExportFormat) {
+		return fmt.Errorf("%w\n%s", err, exportUsage)
+	}
+	if err != nil {
+		return fmt.Errorf("выгрузка прервана после ID %d (продолжить: -after %d): %w", lastID, lastID, err)
+	}
+	log.Printf("Выгрузка завершена, последний ID: %d", lastID)
+	return nil
+}
+
+// openExportStorage подключается к базе для выгрузки. Данные in-memory
+// хранилища живут в процессе сервера, поэтому выгружаются только через API.
+func openExportStorage(cfg *config.Config, storageType string) (storage.ExportStorage, func(), error) {
+	switch storageType {
+	case "postgres":
+		pool, err := storage.CreateDBPool(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return storage.NewPostgresExportStorage(pool), pool.Close, nil
+	case "sqlite":
+		db, err := storage.OpenSQLite(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return storage.NewSQLiteExportStorage(db), func() { db.Close() }, nil
+	default:
+		return nil, nil, errors.New("выгрузка командой доступна для postgres и sqlite; данные in-memory хранилища выгружаются через GET /v1/admin/export")
+	}
+}
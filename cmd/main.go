@@ -1,18 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"ozon_test/config"
 	"ozon_test/internal/api"
+	"ozon_test/internal/cache"
+	"ozon_test/internal/moderation"
+	"ozon_test/internal/ratelimit"
 	"ozon_test/internal/services"
+	"ozon_test/internal/spam"
 	"ozon_test/internal/storage"
 )
 
 func main() {
-	storageType := flag.String("storage", "inmemory", "Storage type: inmemory or postgres")
+	storageType := flag.String("storage", "inmemory", "Storage type: inmemory, postgres or sqlite")
 	flag.Parse()
 
 	cfg, err := config.LoadConfig()
@@ -20,13 +29,56 @@ func main() {
 		log.Fatalf("Ошибка загрузки конфигурации: %v", err)
 	}
 
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg, *storageType, flag.Args()[1:]); err != nil {
+			log.Fatalf("Ошибка миграции: %v", err)
+		}
+		return
+	}
+	if flag.Arg(0) == "export" {
+		if err := runExport(cfg, *storageType, flag.Args()[1:]); err != nil {
+			log.Fatalf("Ошибка выгрузки: %v", err)
+		}
+		return
+	}
+
 	var postStorage storage.PostStorage
 	var commentStorage storage.CommentStorage
+	var txManager storage.TxManager
+	var searchStorage storage.SearchStorage
+	var reactionStorage storage.ReactionStorage
+	var activityStorage storage.ActivityStorage
+	var moderationStorage storage.ModerationStorage
+	var reportStorage storage.ReportStorage
+	var idempotencyStorage storage.IdempotencyStorage
+	var exportStorage storage.ExportStorage
+	statsHandler := api.NewStatsHandler()
 
 	switch *storageType {
 	case "inmemory":
-		postStorage = storage.NewInMemoryPostStorage()
-		commentStorage = storage.NewInMemoryCommentStorage()
+		posts, comments := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+		if cfg.InMemory.DataDir != "" {
+			var persistence *storage.Persistence
+			posts, comments, persistence, err = storage.NewPersistentInMemoryStorage(cfg)
+			if err != nil {
+				log.Fatalf("Ошибка восстановления in-memory хранилища: %v", err)
+			}
+			defer func() {
+				if err := persistence.Close(); err != nil {
+					log.Printf("Ошибка закрытия журнала: %v", err)
+				}
+			}()
+		}
+		postStorage = posts
+		commentStorage = comments
+		txManager = storage.NewInMemoryTxManager(posts, comments)
+		searchStorage = storage.NewInMemorySearchStorage(posts, comments)
+		reactionStorage = storage.NewInMemoryReactionStorage(posts, comments)
+		activityStorage = storage.NewInMemoryActivityStorage(posts, comments)
+		moderationStorage = storage.NewInMemoryModerationStorage(posts, comments)
+		reportStorage = storage.NewInMemoryReportStorage(posts, comments)
+		idempotencyStorage = storage.NewInMemoryIdempotencyStorage()
+		exportStorage = storage.NewInMemoryExportStorage(posts, comments)
 	case "postgres":
 		if err := storage.ApplyMigrations(cfg); err != nil {
 			log.Fatalf("Ошибка применения миграций: %v", err)
@@ -35,25 +87,137 @@ func main() {
 		if err != nil {
 			log.Fatalf("Ошибка создания пула подключений: %v", err)
 		}
-		postStorage = storage.NewPostgresPostStorage(pool)
-		commentStorage = storage.NewPostgresCommentStorage(pool)
+		if len(cfg.Database.Replicas.DSNs) > 0 {
+			replicas, err := storage.NewReplicaSet(cfg, pool)
+			if err != nil {
+				log.Fatalf("Ошибка подключения к репликам: %v", err)
+			}
+			defer replicas.Close()
+			postStorage = storage.NewReplicatedPostgresPostStorage(pool, replicas)
+			commentStorage = storage.NewReplicatedPostgresCommentStorage(pool, replicas)
+			searchStorage = storage.NewReplicatedPostgresSearchStorage(replicas)
+			exportStorage = storage.NewReplicatedPostgresExportStorage(pool, replicas)
+			statsHandler.Register("db_replicas", func() interface{} { return replicas.Stats() })
+		} else {
+			postStorage = storage.NewPostgresPostStorage(pool)
+			commentStorage = storage.NewPostgresCommentStorage(pool)
+			searchStorage = storage.NewPostgresSearchStorage(pool)
+			exportStorage = storage.NewPostgresExportStorage(pool)
+		}
+		activityStorage = storage.NewPostgresActivityStorage(pool)
+		txManager = storage.NewPostgresTxManager(pool)
+		reactionStorage = storage.NewPostgresReactionStorage(pool)
+		moderationStorage = storage.NewPostgresModerationStorage(pool)
+		reportStorage = storage.NewPostgresReportStorage(pool)
+		idempotencyStorage = storage.NewPostgresIdempotencyStorage(pool)
+		statsHandler.Register("db_pool", func() interface{} { return storage.GetPoolStats(pool) })
+	case "sqlite":
+		if err := storage.ApplySQLiteMigrations(cfg); err != nil {
+			log.Fatalf("Ошибка применения миграций: %v", err)
+		}
+		db, err := storage.OpenSQLite(cfg)
+		if err != nil {
+			log.Fatalf("Ошибка открытия базы SQLite: %v", err)
+		}
+		postStorage = storage.NewSQLitePostStorage(db)
+		commentStorage = storage.NewSQLiteCommentStorage(db)
+		txManager = storage.NewSQLiteTxManager(db)
+		searchStorage = storage.NewSQLiteSearchStorage(db)
+		reactionStorage = storage.NewSQLiteReactionStorage(db)
+		activityStorage = storage.NewSQLiteActivityStorage(db)
+		moderationStorage = storage.NewSQLiteModerationStorage(db)
+		reportStorage = storage.NewSQLiteReportStorage(db)
+		idempotencyStorage = storage.NewSQLiteIdempotencyStorage(db)
+		exportStorage = storage.NewSQLiteExportStorage(db)
 	default:
 		log.Fatal("Неизвестный тип хранилища")
 	}
 
-	postService := services.NewPostService(postStorage)
-	commentService := services.NewCommentService(commentStorage, postStorage)
+	if cfg.Cache.Enabled {
+		cacheLayer := storage.NewCacheLayer(cfg, cache.NewLRU(cfg.Cache.Size))
+		postStorage = cacheLayer.PostStorage(postStorage)
+		commentStorage = cacheLayer.CommentStorage(commentStorage)
+		txManager = cacheLayer.TxManager(txManager)
+		reactionStorage = cacheLayer.ReactionStorage(reactionStorage)
+		moderationStorage = cacheLayer.ModerationStorage(moderationStorage)
+		reportStorage = cacheLayer.ReportStorage(reportStorage)
+		statsHandler.Register("cache", func() interface{} { return cacheLayer.Stats() })
+	}
+
+	moderationChain, err := moderation.NewChainFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка настройки модерации: %v", err)
+	}
+	postService := services.NewPostService(postStorage, txManager)
+	postService.SetModeration(moderationChain)
+	commentService := services.NewCommentService(postStorage, commentStorage, txManager)
+	commentService.SetModeration(moderationChain)
+	commentService.SetSpamDetector(spam.NewDetectorFromConfig(cfg))
+	searchService := services.NewSearchService(searchStorage)
+	reactionService := services.NewReactionService(reactionStorage, cfg.Reactions.Emoji)
+	moderationService := services.NewModerationService(moderationStorage)
+	reportService := services.NewReportService(reportStorage, cfg.Reports.HideThreshold)
+	exportService := services.NewExportService(exportStorage)
+	feedService := services.NewFeedService(postStorage, activityStorage, cfg)
+	defer feedService.Close()
 
 	postHandler := api.NewPostHandler(postService)
-	commentHandler := api.NewCommentHandler(commentService)
+	commentHandler := api.NewCommentHandler(commentService, cfg)
+	searchHandler := api.NewSearchHandler(searchService)
+	reactionHandler := api.NewReactionHandler(reactionService)
+	feedHandler := api.NewFeedHandler(feedService)
+	moderationHandler := api.NewModerationHandler(moderationService)
+	reportHandler := api.NewReportHandler(reportService)
+	exportHandler := api.NewExportHandler(exportService)
+	idempotency := api.NewIdempotency(idempotencyStorage, cfg)
 
-	http.HandleFunc("/posts", postHandler.GetAllPosts)
-	http.HandleFunc("/posts/create", postHandler.CreatePost)
-	http.HandleFunc("/posts/disable-comments", postHandler.DisableComments)
-	http.HandleFunc("/comments", commentHandler.GetComments)
-	http.HandleFunc("/comments/create", commentHandler.CreateComment)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/posts", postHandler.GetAllPosts)
+	mux.Handle("/posts/create", idempotency.Middleware(http.HandlerFunc(postHandler.CreatePost)))
+	mux.HandleFunc("/posts/get", postHandler.GetPost)
+	mux.HandleFunc("/posts/disable-comments", postHandler.DisableComments)
+	mux.HandleFunc("/comments", commentHandler.GetComments)
+	mux.Handle("/comments/create", idempotency.Middleware(http.HandlerFunc(commentHandler.CreateComment)))
+	mux.HandleFunc("/v1/search", searchHandler.Search)
+	mux.HandleFunc("/v1/reactions/add", reactionHandler.AddReaction)
+	mux.HandleFunc("/v1/reactions/remove", reactionHandler.RemoveReaction)
+	mux.HandleFunc("/v1/feed/hot", feedHandler.GetHotFeed)
+	mux.Handle("/v1/moderation/queue", api.RequireRole(config.RoleModerator, http.HandlerFunc(moderationHandler.GetQueue)))
+	mux.Handle("/v1/moderation/approve", api.RequireRole(config.RoleModerator, http.HandlerFunc(moderationHandler.Approve)))
+	mux.Handle("/v1/moderation/reject", api.RequireRole(config.RoleModerator, http.HandlerFunc(moderationHandler.Reject)))
+	mux.Handle("/v1/moderation/bulk", api.RequireRole(config.RoleModerator, http.HandlerFunc(moderationHandler.Bulk)))
+	mux.HandleFunc("/v1/reports/create", reportHandler.CreateReport)
+	mux.Handle("/v1/reports", api.RequireRole(config.RoleModerator, http.HandlerFunc(reportHandler.GetReports)))
+	mux.Handle("/v1/reports/resolve", api.RequireRole(config.RoleModerator, http.HandlerFunc(reportHandler.Resolve)))
+	mux.Handle("/v1/admin/export", api.RequireRole(config.RoleAdmin, http.HandlerFunc(exportHandler.Export)))
+	mux.Handle("/debug/stats", api.RequireRole(config.RoleAdmin, http.HandlerFunc(statsHandler.GetStats)))
+
+	var handler http.Handler = api.NewHTTPCache(cfg).Middleware(mux)
+	handler = api.Authenticate(cfg)(handler)
+	if cfg.RateLimit.Enabled {
+		handler = api.NewRateLimiter(ratelimit.NewMemoryStore(), cfg).Middleware(handler)
+	}
+	if cfg.Compression.Enabled {
+		handler = api.NewCompression(cfg).Middleware(handler)
+	}
 
 	serverAddr := ":8080"
+	server := &http.Server{Addr: serverAddr, Handler: handler}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Ошибка остановки сервера: %v", err)
+		}
+	}()
+
 	log.Printf("Сервер запускается на %s...", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, nil))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	log.Println("Сервер остановлен")
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"ozon_test/config"
+	"ozon_test/internal/storage"
+)
+
+const migrateUsage = `использование: main -storage=<postgres|sqlite> migrate <команда>
+команды:
+  up [N]      применить все миграции или N следующих
+  down N      откатить N последних миграций
+  goto V      перейти к версии V
+  version     показать текущую версию
+  force V     записать версию V без выполнения миграций (снимает флаг dirty)`
+
+// runMigrate выполняет подкоманду migrate с аргументами args.
+func runMigrate(cfg *config.Config, storageType string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := storage.NewMigrate(cfg, storageType)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		if len(args) == 1 {
+			err = m.Up()
+			break
+		}
+		var n uint
+		if n, err = parseMigrateArg(args, "N"); err == nil {
+			err = m.Steps(int(n))
+		}
+	case "down":
+		var n uint
+		if n, err = parseMigrateArg(args, "N"); err == nil {
+			err = m.Steps(-int(n))
+		}
+	case "goto":
+		var v uint
+		if v, err = parseMigrateArg(args, "V"); err == nil {
+			err = m.Migrate(v)
+		}
+	case "force":
+		var v uint
+		if v, err = parseMigrateArg(args, "V"); err == nil {
+			err = m.Force(int(v))
+		}
+	case "version":
+	default:
+		return fmt.Errorf("неизвестная команда %q\n%s", args[0], migrateUsage)
+	}
+	if errors.Is(err, migrate.ErrNoChange) {
+		log.Println("Изменений нет")
+	} else if err != nil {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		log.Println("Миграции не применены")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Текущая версия: %d, dirty: %t", version, dirty)
+	return nil
+}
+
+func parseMigrateArg(args []string, name string) (uint, error) {
+	if len(args) != 2 {
+		return 0, fmt.Errorf("команда %s ожидает аргумент %s\n%s", args[0], name, migrateUsage)
+	}
+	n, err := strconv.ParseUint(args[1], 10, 0)
+	if err != nil || (name == "N" && n == 0) {
+		return 0, fmt.Errorf("неверное значение %s: %q", name, args[1])
+	}
+	return uint(n), nil
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -17,21 +19,277 @@ type Config struct {
 		User     string `mapstructure:"user"`
 		Password string `mapstructure:"password"`
 		DBName   string `mapstructure:"dbname"`
+		// Режим TLS: disable, allow, prefer, require, verify-ca или verify-full
+		SSLMode        string        `mapstructure:"sslmode"`
+		SSLRootCert    string        `mapstructure:"sslrootcert"`
+		SSLCert        string        `mapstructure:"sslcert"`
+		SSLKey         string        `mapstructure:"sslkey"`
+		ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+		Pool           struct {
+			MaxConns          int32         `mapstructure:"max_conns"`
+			MinConns          int32         `mapstructure:"min_conns"`
+			MaxConnLifetime   time.Duration `mapstructure:"max_conn_lifetime"`
+			MaxConnIdleTime   time.Duration `mapstructure:"max_conn_idle_time"`
+			HealthCheckPeriod time.Duration `mapstructure:"health_check_period"`
+		} `mapstructure:"pool"`
+		// Ожидание доступности базы при запуске: экспоненциальная задержка
+		// от InitialInterval до MaxInterval, пока не истечёт MaxElapsedTime
+		Retry struct {
+			InitialInterval time.Duration `mapstructure:"initial_interval"`
+			MaxInterval     time.Duration `mapstructure:"max_interval"`
+			Multiplier      float64       `mapstructure:"multiplier"`
+			MaxElapsedTime  time.Duration `mapstructure:"max_elapsed_time"`
+		} `mapstructure:"retry"`
+		// Реплики для чтения: строки подключения в формате postgres://...
+		// Недоступные реплики исключаются до следующей успешной проверки
+		Replicas struct {
+			DSNs                []string      `mapstructure:"dsns"`
+			HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+		} `mapstructure:"replicas"`
 	} `mapstructure:"database"`
+	SQLite struct {
+		Path string `mapstructure:"path"`
+	} `mapstructure:"sqlite"`
+	InMemory struct {
+		// Пустой каталог отключает сохранение данных in-memory хранилища
+		DataDir          string        `mapstructure:"data_dir"`
+		Fsync            string        `mapstructure:"fsync"`
+		FsyncInterval    time.Duration `mapstructure:"fsync_interval"`
+		SnapshotInterval time.Duration `mapstructure:"snapshot_interval"`
+	} `mapstructure:"inmemory"`
+	// Кэш поста по ID и первой страницы комментариев
+	Cache struct {
+		Enabled          bool          `mapstructure:"enabled"`
+		Size             int           `mapstructure:"size"`
+		TTL              time.Duration `mapstructure:"ttl"`
+		CommentsPageSize int           `mapstructure:"comments_page_size"`
+	} `mapstructure:"cache"`
+	Reactions struct {
+		// Эмодзи, доступные в дополнение к голосам upvote и downvote
+		Emoji []string `mapstructure:"emoji"`
+	} `mapstructure:"reactions"`
+	// Горячая лента: оценка поста — сумма весов его комментариев и реакций,
+	// каждый вес уменьшается вдвое за HalfLife
+	Feed struct {
+		RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+		HalfLife        time.Duration `mapstructure:"half_life"`
+		Size            int           `mapstructure:"size"`
+		Weights         struct {
+			Comment  float64 `mapstructure:"comment"`
+			Reaction float64 `mapstructure:"reaction"`
+			// Вес downvote; остальные реакции весят Reaction
+			Downvote float64 `mapstructure:"downvote"`
+		} `mapstructure:"weights"`
+	} `mapstructure:"feed"`
+	// Пользователи API: запрос с заголовком Authorization: Bearer <token>
+	// выполняется от имени пользователя с этим токеном
+	Auth struct {
+		Users []User `mapstructure:"users"`
+	} `mapstructure:"auth"`
+	// Ограничение частоты запросов: корзины токенов по пользователю или,
+	// для анонимных запросов, по IP. Чтение — запросы GET и HEAD, остальное — запись
+	RateLimit struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Заголовок с адресом клиента, который выставляет доверенный прокси
+		// (например, X-Real-IP); пустой — адрес соединения
+		RealIPHeader string    `mapstructure:"real_ip_header"`
+		Read         RateLimit `mapstructure:"read"`
+		Write        RateLimit `mapstructure:"write"`
+	} `mapstructure:"rate_limit"`
+	Reports struct {
+		// Сколько разных пользователей должны пожаловаться на пост или
+		// комментарий, чтобы он скрылся до решения модератора; 0 — не скрывать
+		HideThreshold int `mapstructure:"hide_threshold"`
+	} `mapstructure:"reports"`
+	// Ключи идемпотентности запросов создания: ответ хранится TTL; ключ
+	// запроса, не завершившегося за LockTimeout, можно занять снова
+	Idempotency struct {
+		TTL         time.Duration `mapstructure:"ttl"`
+		LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	} `mapstructure:"idempotency"`
+	// Заголовок Cache-Control ответов GET по маршрутам. Ответы авторизованным
+	// пользователям включают их неодобренные записи, поэтому на маршрутах
+	// с public они получают Authenticated и не попадают в общий кэш (CDN)
+	HTTPCache struct {
+		Routes        []CacheRoute `mapstructure:"routes"`
+		Authenticated string       `mapstructure:"authenticated"`
+	} `mapstructure:"http_cache"`
+	// Сжатие ответов (zstd или gzip по Accept-Encoding). Ответы короче
+	// MinSize байт не сжимаются: выигрыш меньше накладных расходов
+	Compression struct {
+		Enabled bool `mapstructure:"enabled"`
+		MinSize int  `mapstructure:"min_size"`
+	} `mapstructure:"compression"`
+	// Поиск спама среди новых комментариев: повторов текста одного автора
+	// и серий комментариев к разным постам
+	Spam struct {
+		Enabled    bool `mapstructure:"enabled"`
+		Duplicates struct {
+			Window time.Duration `mapstructure:"window"`
+			// Наибольшее число различающихся битов simhash-отпечатков у повтора
+			MaxDistance int `mapstructure:"max_distance"`
+			// Тексты короче стольких слов на повтор не проверяются
+			MinWords int `mapstructure:"min_words"`
+		} `mapstructure:"duplicates"`
+		// Не больше Count комментариев за Window к Posts и более разным постам
+		Rapid struct {
+			Count  int           `mapstructure:"count"`
+			Window time.Duration `mapstructure:"window"`
+			Posts  int           `mapstructure:"posts"`
+		} `mapstructure:"rapid"`
+	} `mapstructure:"spam"`
+	// Проверка постов и комментариев перед сохранением. Действия правил:
+	// mask (скрыть нарушение звёздочками), hold (отправить на проверку), reject
+	Moderation struct {
+		BannedWords struct {
+			// Слово, оканчивающееся на «*», запрещает все слова с этой основой
+			Words  []string `mapstructure:"words"`
+			Action string   `mapstructure:"action"`
+		} `mapstructure:"banned_words"`
+		Links struct {
+			// Отрицательное значение снимает ограничение
+			Max    int    `mapstructure:"max"`
+			Action string `mapstructure:"action"`
+		} `mapstructure:"links"`
+		Rules []ModerationRule `mapstructure:"rules"`
+	} `mapstructure:"moderation"`
+}
+
+// ModerationRule — правило модерации по регулярному выражению (синтаксис RE2).
+type ModerationRule struct {
+	Name    string `mapstructure:"name"`
+	Pattern string `mapstructure:"pattern"`
+	Action  string `mapstructure:"action"`
+}
+
+// CacheRoute — значение заголовка Cache-Control ответов маршрута Path.
+type CacheRoute struct {
+	Path         string `mapstructure:"path"`
+	CacheControl string `mapstructure:"cache_control"`
+}
+
+// Роли пользователей API. Администратор может всё, что модератор.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// User — пользователь API, его токен доступа и роль; пустая роль
+// не даёт дополнительных прав.
+type User struct {
+	Name  string `mapstructure:"name"`
+	Token string `mapstructure:"token"`
+	Role  string `mapstructure:"role"`
+}
+
+// RateLimit — Rate запросов в секунду с допустимым всплеском до Burst запросов.
+type RateLimit struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
 }
 
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
+	viper.SetDefault("database.sslmode", "disable")
+	viper.SetDefault("database.connect_timeout", 5*time.Second)
+	viper.SetDefault("database.pool.max_conns", 10)
+	viper.SetDefault("database.pool.min_conns", 2)
+	viper.SetDefault("database.pool.max_conn_lifetime", time.Hour)
+	viper.SetDefault("database.pool.max_conn_idle_time", 30*time.Minute)
+	viper.SetDefault("database.pool.health_check_period", time.Minute)
+	viper.SetDefault("database.retry.initial_interval", 500*time.Millisecond)
+	viper.SetDefault("database.retry.max_interval", 10*time.Second)
+	viper.SetDefault("database.retry.multiplier", 2.0)
+	viper.SetDefault("database.retry.max_elapsed_time", time.Minute)
+	viper.SetDefault("database.replicas.health_check_interval", 5*time.Second)
+	viper.SetDefault("sqlite.path", "data.db")
+	viper.SetDefault("inmemory.fsync", "interval")
+	viper.SetDefault("inmemory.fsync_interval", time.Second)
+	viper.SetDefault("inmemory.snapshot_interval", 5*time.Minute)
+	viper.SetDefault("cache.size", 10000)
+	viper.SetDefault("cache.ttl", 30*time.Second)
+	viper.SetDefault("cache.comments_page_size", 50)
+	viper.SetDefault("reactions.emoji", []string{"👍", "❤️", "😂", "😮", "😢"})
+	viper.SetDefault("moderation.banned_words.action", "mask")
+	viper.SetDefault("moderation.links.max", 3)
+	viper.SetDefault("moderation.links.action", "hold")
+	viper.SetDefault("reports.hide_threshold", 3)
+	viper.SetDefault("idempotency.ttl", 24*time.Hour)
+	viper.SetDefault("idempotency.lock_timeout", time.Minute)
+	viper.SetDefault("http_cache.routes", []map[string]interface{}{
+		{"path": "/posts", "cache_control": "public, max-age=5"},
+		{"path": "/posts/get", "cache_control": "public, max-age=5"},
+		{"path": "/comments", "cache_control": "public, max-age=5"},
+		{"path": "/v1/feed/hot", "cache_control": "public, max-age=30"},
+		{"path": "/v1/search", "cache_control": "public, max-age=60"},
+		{"path": "/v1/moderation/queue", "cache_control": "no-store"},
+		{"path": "/v1/reports", "cache_control": "no-store"},
+		{"path": "/v1/admin/export", "cache_control": "no-store"},
+		{"path": "/debug/stats", "cache_control": "no-store"},
+	})
+	viper.SetDefault("http_cache.authenticated", "private, no-cache")
+	viper.SetDefault("compression.enabled", true)
+	viper.SetDefault("compression.min_size", 1024)
+	viper.SetDefault("spam.enabled", true)
+	viper.SetDefault("spam.duplicates.window", time.Hour)
+	viper.SetDefault("spam.duplicates.max_distance", 3)
+	viper.SetDefault("spam.duplicates.min_words", 3)
+	viper.SetDefault("spam.rapid.count", 5)
+	viper.SetDefault("spam.rapid.window", time.Minute)
+	viper.SetDefault("spam.rapid.posts", 3)
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.read.rate", 20.0)
+	viper.SetDefault("rate_limit.read.burst", 40)
+	viper.SetDefault("rate_limit.write.rate", 0.5)
+	viper.SetDefault("rate_limit.write.burst", 10)
+	viper.SetDefault("feed.refresh_interval", 30*time.Second)
+	viper.SetDefault("feed.half_life", 6*time.Hour)
+	viper.SetDefault("feed.size", 100)
+	viper.SetDefault("feed.weights.comment", 1.0)
+	viper.SetDefault("feed.weights.reaction", 0.5)
+	viper.SetDefault("feed.weights.downvote", 0.0)
 	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("ошибка чтения конфигурационного файла: %w", err)
+		// Без файла конфигурации работаем на значениях по умолчанию
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("ошибка чтения конфигурационного файла: %w", err)
+		}
 	}
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("ошибка разбора конфигурации: %w", err)
 	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
+
+// validate проверяет значения, с которыми сервис не может работать.
+func (c *Config) validate() error {
+	if c.RateLimit.Enabled {
+		if err := c.RateLimit.Read.validate("rate_limit.read"); err != nil {
+			return err
+		}
+		if err := c.RateLimit.Write.validate("rate_limit.write"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate проверяет лимит: при нулевой корзине или скорости запросы
+// отклонялись бы все или навсегда.
+func (l RateLimit) validate(name string) error {
+	if l.Burst < 1 {
+		return fmt.Errorf("%s.burst должен быть не меньше 1, получено %d", name, l.Burst)
+	}
+	if l.Rate <= 0 {
+		return fmt.Errorf("%s.rate должен быть больше 0, получено %v", name, l.Rate)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -38,4 +39,36 @@ database:
 	if cfg.Database.DBName != "testdb" {
 		t.Errorf("Ожидался Database.DBName 'testdb', получено '%s'", cfg.Database.DBName)
 	}
+	if cfg.Database.Pool.MaxConns != 10 || cfg.Database.Retry.MaxInterval != 10*time.Second {
+		t.Errorf("Ожидались значения пула по умолчанию, получено %+v, %+v", cfg.Database.Pool, cfg.Database.Retry)
+	}
+	if routes := cfg.HTTPCache.Routes; len(routes) == 0 || routes[0] != (CacheRoute{Path: "/posts", CacheControl: "public, max-age=5"}) {
+		t.Errorf("Ожидались маршруты Cache-Control по умолчанию, получено %+v", routes)
+	}
+	if !cfg.Compression.Enabled || cfg.Compression.MinSize != 1024 {
+		t.Errorf("Ожидалось сжатие от 1024 байт, получено %+v", cfg.Compression)
+	}
+}
+
+func TestLoadConfigRejectsRateLimit(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	for key, value := range map[string]interface{}{
+		"rate_limit.read.burst":  0,
+		"rate_limit.write.rate":  0.0,
+		"rate_limit.write.burst": -1,
+	} {
+		viper.Reset()
+		viper.Set(key, value)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s = %v: ожидалась ошибка про %s, получено %v", key, value, key, err)
+		}
+	}
+
+	// Выключенное ограничение не проверяется
+	viper.Reset()
+	viper.Set("rate_limit.enabled", false)
+	viper.Set("rate_limit.read.burst", 0)
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("Ожидалась загрузка без ограничения частоты, получено %v", err)
+	}
 }
@@ -2,18 +2,33 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"ozon_test/config"
+	"ozon_test/internal/models"
+	"ozon_test/internal/moderation"
+	"ozon_test/internal/ratelimit"
 	"ozon_test/internal/services"
 	"ozon_test/internal/storage"
 )
 
 func TestGetAllPosts(t *testing.T) {
 	postStorage := storage.NewInMemoryPostStorage()
-	postService := services.NewPostService(postStorage)
+	txManager := storage.NewInMemoryTxManager(postStorage, storage.NewInMemoryCommentStorage())
+	postService := services.NewPostService(postStorage, txManager)
 	handler := NewPostHandler(postService)
 
 	_, _ = postService.CreatePost("Test1", "Text1", "Author1")
@@ -50,14 +65,16 @@ func TestGetAllPosts(t *testing.T) {
 func TestCreateCommentInvalidJSON(t *testing.T) {
 	commentStorage := storage.NewInMemoryCommentStorage()
 	postStorage := storage.NewInMemoryPostStorage()
-	commentService := services.NewCommentService(commentStorage, postStorage)
-	handler := NewCommentHandler(commentService)
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	commentService := services.NewCommentService(postStorage, commentStorage, txManager)
+	handler := NewCommentHandler(commentService, &config.Config{})
 
 	req, err := http.NewRequest("POST", "/comments/create", bytes.NewBuffer([]byte("invalid json")))
 	if err != nil {
 		t.Fatal(err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, config.User{Name: "alice"}))
 
 	rr := httptest.NewRecorder()
 	handler.CreateComment(rr, req)
@@ -66,3 +83,995 @@ func TestCreateCommentInvalidJSON(t *testing.T) {
 		t.Errorf("Ожидался код 400, получено %v", status)
 	}
 }
+
+// Автор берётся из пользователя запроса, а не из тела
+func TestCreateAuthorFromUser(t *testing.T) {
+	commentStorage := storage.NewInMemoryCommentStorage()
+	postStorage := storage.NewInMemoryPostStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postHandler := NewPostHandler(services.NewPostService(postStorage, txManager))
+	commentHandler := NewCommentHandler(services.NewCommentService(postStorage, commentStorage, txManager), &config.Config{})
+	request := func(path, body, user string) *http.Request {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, config.User{Name: user}))
+		}
+		return req
+	}
+
+	rr := httptest.NewRecorder()
+	postHandler.CreatePost(rr, request("/posts/create", `{"title":"Test","text":"Text","author":"bob"}`, "alice"))
+	var post models.Post
+	if err := json.NewDecoder(rr.Body).Decode(&post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Author != "alice" {
+		t.Errorf("Ожидался автор alice, получен %q", post.Author)
+	}
+	rr = httptest.NewRecorder()
+	commentHandler.CreateComment(rr, request("/comments/create", fmt.Sprintf(`{"post_id":%d,"text":"Comment","author":"bob"}`, post.ID), "carol"))
+	var comment models.Comment
+	if err := json.NewDecoder(rr.Body).Decode(&comment); err != nil {
+		t.Fatal(err)
+	}
+	if comment.Author != "carol" {
+		t.Errorf("Ожидался автор carol, получен %q", comment.Author)
+	}
+
+	// Анонимно создать пост или комментарий нельзя, даже указав автора в теле
+	rr = httptest.NewRecorder()
+	postHandler.CreatePost(rr, request("/posts/create", `{"title":"Test","text":"Text","author":"bob"}`, ""))
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Ожидался код 401 для анонимного поста, получено %d %v", rr.Code, rr.Header())
+	}
+	rr = httptest.NewRecorder()
+	commentHandler.CreateComment(rr, request("/comments/create", fmt.Sprintf(`{"post_id":%d,"text":"Comment"}`, post.ID), ""))
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Ожидался код 401 для анонимного комментария, получено %d %v", rr.Code, rr.Header())
+	}
+	if comments, _ := commentHandler.service.GetVisibleComments(post.ID, "", 10, 0); len(comments) != 1 {
+		t.Errorf("Анонимный комментарий не должен сохраняться, комментариев %d", len(comments))
+	}
+}
+
+func TestGetCommentsSort(t *testing.T) {
+	commentStorage := storage.NewInMemoryCommentStorage()
+	postStorage := storage.NewInMemoryPostStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := services.NewPostService(postStorage, txManager)
+	commentService := services.NewCommentService(postStorage, commentStorage, txManager)
+	handler := NewCommentHandler(commentService, &config.Config{})
+	post, _ := postService.CreatePost("Test", "Text", "Author")
+	first, _ := commentService.CreateComment(post.ID, nil, "First", "User1", "User1")
+	_, _ = commentService.CreateComment(post.ID, nil, "Second", "User2", "User2")
+	_, _ = commentService.CreateComment(post.ID, &first.ID, "Reply", "User3", "User3")
+
+	rr := httptest.NewRecorder()
+	handler.GetComments(rr, httptest.NewRequest("GET", "/comments?post_id=1&sort=old", nil))
+	var comments []struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&comments); err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 3 || comments[1].Text != "Reply" {
+		t.Errorf("Ожидался ответ сразу за родителем, получено %v", comments)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.GetComments(rr, httptest.NewRequest("GET", "/comments?post_id=1&sort=random", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался код 400, получено %v", rr.Code)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	handler := NewStatsHandler()
+	handler.Register("db_pool", func() interface{} { return map[string]int{"total_conns": 3} })
+
+	rr := httptest.NewRecorder()
+	handler.GetStats(rr, httptest.NewRequest("GET", "/debug/stats", nil))
+
+	var stats map[string]map[string]int
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["db_pool"]["total_conns"] != 3 {
+		t.Errorf("Ожидалось total_conns 3, получено %v", stats)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	postStorage, commentStorage := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	searchStorage := storage.NewInMemorySearchStorage(postStorage, commentStorage)
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := services.NewPostService(postStorage, txManager)
+	handler := NewSearchHandler(services.NewSearchService(searchStorage))
+
+	_, _ = postService.CreatePost("Погода", "Сегодня солнечно", "Author")
+	_, _ = postService.CreatePost("Новости", "Ничего не случилось", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.Search(rr, httptest.NewRequest("GET", "/v1/search?q=%D1%81%D0%BE%D0%BB%D0%BD%D0%B5%D1%87%D0%BD%D0%BE", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Ожидался код 200, получено %v", rr.Code)
+	}
+	var results []struct {
+		Type    string
+		ID      int
+		Snippet string
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != 1 || results[0].Snippet != "Погода Сегодня <b>солнечно</b>" {
+		t.Errorf("Ожидался пост 1 с подсветкой, получено %+v", results)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Search(rr, httptest.NewRequest("GET", "/v1/search?q=+", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался код 400 для пустого запроса, получено %v", rr.Code)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	postStorage, commentStorage := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := services.NewPostService(postStorage, txManager)
+	reactionService := services.NewReactionService(storage.NewInMemoryReactionStorage(postStorage, commentStorage), []string{"👍"})
+	handler := NewReactionHandler(reactionService)
+	post, _ := postService.CreatePost("Test", "Text", "Author")
+
+	tests := []struct {
+		name      string
+		remove    bool
+		anonymous bool
+		body      string
+		want      int
+	}{
+		{"anonymous", false, true, `{"target_type":"post","target_id":1,"kind":"👍"}`, http.StatusUnauthorized},
+		{"add", false, false, `{"target_type":"post","target_id":1,"kind":"👍"}`, http.StatusOK},
+		{"unknown kind", false, false, `{"target_type":"post","target_id":1,"kind":"🤖"}`, http.StatusBadRequest},
+		{"unknown target type", false, false, `{"target_type":"user","target_id":1,"kind":"upvote"}`, http.StatusBadRequest},
+		{"missing post", false, false, `{"target_type":"post","target_id":42,"kind":"upvote"}`, http.StatusNotFound},
+		{"remove", true, false, `{"target_type":"post","target_id":1}`, http.StatusOK},
+		{"remove again", true, false, `{"target_type":"post","target_id":1}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/reactions", bytes.NewBufferString(tt.body))
+		if !tt.anonymous {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, config.User{Name: "alice"}))
+		}
+		if tt.remove {
+			handler.RemoveReaction(rr, req)
+		} else {
+			handler.AddReaction(rr, req)
+		}
+		if rr.Code != tt.want {
+			t.Errorf("%s: ожидался код %d, получено %d", tt.name, tt.want, rr.Code)
+		}
+		if tt.name == "add" {
+			if got, _ := postStorage.GetPostByID(post.ID); got.Reactions["👍"] != 1 {
+				t.Errorf("Ожидалась реакция 👍 у поста, получено %v", got.Reactions)
+			}
+		}
+	}
+}
+
+func TestHotFeed(t *testing.T) {
+	postStorage, commentStorage := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := services.NewPostService(postStorage, txManager)
+	commentService := services.NewCommentService(postStorage, commentStorage, txManager)
+	cfg := &config.Config{}
+	cfg.Feed.HalfLife = time.Hour
+	cfg.Feed.Size = 10
+	cfg.Feed.Weights.Comment = 1
+	feedService := services.NewFeedService(postStorage, storage.NewInMemoryActivityStorage(postStorage, commentStorage), cfg)
+	handler := NewFeedHandler(feedService)
+
+	_, _ = postService.CreatePost("Quiet", "Text", "Author")
+	post, _ := postService.CreatePost("Busy", "Text", "Author")
+	_, _ = commentService.CreateComment(post.ID, nil, "Comment", "User", "User")
+	if err := feedService.Refresh(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.GetHotFeed(rr, httptest.NewRequest("GET", "/v1/feed/hot", nil))
+	var feed []struct {
+		Title string
+		Score float64
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 1 || feed[0].Title != "Busy" || feed[0].Score <= 0 {
+		t.Errorf("Ожидался один пост Busy с положительной оценкой, получено %+v", feed)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.GetHotFeed(rr, httptest.NewRequest("GET", "/v1/feed/hot?offset=-1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался код 400 для отрицательного смещения, получено %v", rr.Code)
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		query  string
+		limit  int
+		offset int
+		ok     bool
+	}{
+		{"", 10, 0, true},
+		{"limit=5&offset=20", 5, 20, true},
+		{"limit=0", 10, 0, true},
+		{"limit=1000", 100, 0, true},
+		{"limit=abc", 0, 0, false},
+		{"limit=-1", 0, 0, false},
+		{"offset=1.5", 0, 0, false},
+		{"offset=-10", 0, 0, false},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		limit, offset, ok := pageParams(rr, httptest.NewRequest("GET", "/v1/search?"+tt.query, nil))
+		if limit != tt.limit || offset != tt.offset || ok != tt.ok {
+			t.Errorf("%q: ожидалось %d, %d, %v, получено %d, %d, %v", tt.query, tt.limit, tt.offset, tt.ok, limit, offset, ok)
+		}
+		if !ok && rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: ожидался код 400, получено %v", tt.query, rr.Code)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.Users = []config.User{{Name: "alice", Token: "secret"}}
+	handler := Authenticate(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		w.Write([]byte(user))
+	}))
+
+	tests := []struct {
+		header string
+		code   int
+		user   string
+	}{
+		{"", http.StatusOK, ""},
+		{"Bearer secret", http.StatusOK, "alice"},
+		{"Bearer wrong", http.StatusUnauthorized, ""},
+		{"Basic secret", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/posts", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.code {
+			t.Errorf("%q: ожидался код %d, получено %d", tt.header, tt.code, rr.Code)
+		}
+		if tt.code == http.StatusOK && rr.Body.String() != tt.user {
+			t.Errorf("%q: ожидался пользователь %q, получено %q", tt.header, tt.user, rr.Body.String())
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.Users = []config.User{{Name: "alice", Token: "secret"}}
+	cfg.RateLimit.Read = config.RateLimit{Rate: 1, Burst: 5}
+	cfg.RateLimit.Write = config.RateLimit{Rate: 0.1, Burst: 2}
+	limiter := NewRateLimiter(ratelimit.NewMemoryStore(), cfg)
+	handler := limiter.Middleware(Authenticate(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	serve := func(method, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/comments/create", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := serve("POST", ""); rr.Code != http.StatusOK {
+			t.Fatalf("Запись %d: ожидался код 200, получено %d", i, rr.Code)
+		}
+	}
+	rr := serve("POST", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Ожидался код 429, получено %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "10" || rr.Header().Get("X-RateLimit-Limit") != "2" ||
+		rr.Header().Get("X-RateLimit-Remaining") != "0" || rr.Header().Get("X-RateLimit-Reset") != "20" {
+		t.Errorf("Неожиданные заголовки: %v", rr.Header())
+	}
+
+	// Чтение и запросы пользователя с того же IP считаются отдельно
+	if rr := serve("GET", ""); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "4" {
+		t.Errorf("Ожидалось чтение с остатком 4, получено %d, %v", rr.Code, rr.Header())
+	}
+	if rr := serve("POST", "Bearer secret"); rr.Code != http.StatusOK {
+		t.Errorf("Ожидалась отдельная корзина пользователя, получено %d", rr.Code)
+	}
+
+	// Подбор токена ограничивается по IP корзиной записи, в том числе для чтения
+	for i := 0; i < 2; i++ {
+		if rr := serve("GET", "Bearer guess"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Попытка %d: ожидался код 401, получено %d", i, rr.Code)
+		}
+	}
+	if rr := serve("GET", "Bearer guess"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Ожидался код 429 после неверных токенов, получено %d", rr.Code)
+	}
+	if rr := serve("GET", "Bearer secret"); rr.Code != http.StatusOK {
+		t.Errorf("Верный токен не должен ограничиваться неудачными попытками, получено %d", rr.Code)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	handler := RequireRole(config.RoleModerator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name string
+		user *config.User
+		code int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user", &config.User{Name: "alice"}, http.StatusForbidden},
+		{"moderator", &config.User{Name: "bob", Role: config.RoleModerator}, http.StatusOK},
+		{"admin", &config.User{Name: "carol", Role: config.RoleAdmin}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/moderation/queue", nil)
+		if tt.user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, *tt.user))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.code {
+			t.Errorf("%s: ожидался код %d, получено %d", tt.name, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestModerationQueue(t *testing.T) {
+	postStorage, commentStorage := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := services.NewPostService(postStorage, txManager)
+	postService.SetModeration(moderation.NewChain(moderation.NewLinkLimit(0, moderation.ActionHold)))
+	postHandler := NewPostHandler(postService)
+	handler := NewModerationHandler(services.NewModerationService(storage.NewInMemoryModerationStorage(postStorage, commentStorage)))
+
+	post, err := postService.CreatePost("Ссылка", "https://example.com", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Status != models.StatusPending {
+		t.Fatalf("Ожидался статус pending, получен %q", post.Status)
+	}
+	postService.CreatePost("Обычный", "Text", "bob")
+
+	listPosts := func(user string) []models.Post {
+		req := httptest.NewRequest("GET", "/posts", nil)
+		if user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, config.User{Name: user}))
+		}
+		rr := httptest.NewRecorder()
+		postHandler.GetAllPosts(rr, req)
+		var posts []models.Post
+		json.NewDecoder(rr.Body).Decode(&posts)
+		return posts
+	}
+	if posts := listPosts(""); len(posts) != 1 {
+		t.Errorf("Аноним должен видеть 1 пост, получено %d", len(posts))
+	}
+	if posts := listPosts("alice"); len(posts) != 2 {
+		t.Errorf("Автор должен видеть свой пост на проверке, получено %d", len(posts))
+	}
+
+	rr := httptest.NewRecorder()
+	handler.GetQueue(rr, httptest.NewRequest("GET", "/v1/moderation/queue", nil))
+	var queue []models.ModerationItem
+	if err := json.NewDecoder(rr.Body).Decode(&queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || queue[0].ID != post.ID || queue[0].Type != models.ModerationTargetPost {
+		t.Fatalf("Ожидался пост %d в очереди, получено %+v", post.ID, queue)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"action": "approve", "items": []map[string]interface{}{
+		{"type": "post", "id": post.ID},
+		{"type": "comment", "id": 42},
+		{"type": "user", "id": 1},
+	}})
+	rr = httptest.NewRecorder()
+	handler.Bulk(rr, httptest.NewRequest("POST", "/v1/moderation/bulk", bytes.NewReader(body)))
+	var results []services.ModerationResult
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Error != "" || results[1].Error == "" || results[2].Error == "" {
+		t.Errorf("Ожидался успех только для первой записи, получено %+v", results)
+	}
+	if posts := listPosts(""); len(posts) != 2 {
+		t.Errorf("Одобренный пост должен быть виден всем, получено %d", len(posts))
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Reject(rr, httptest.NewRequest("POST", "/v1/moderation/reject", bytes.NewReader([]byte(`{"type":"post","id":999}`))))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Ожидался код 404, получено %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.Bulk(rr, httptest.NewRequest("POST", "/v1/moderation/bulk", bytes.NewReader([]byte(`{"action":"delete"}`))))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался код 400 для неизвестного действия, получено %d", rr.Code)
+	}
+}
+
+func TestReports(t *testing.T) {
+	postStorage, commentStorage := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	postService := services.NewPostService(postStorage, storage.NewInMemoryTxManager(postStorage, commentStorage))
+	reportService := services.NewReportService(storage.NewInMemoryReportStorage(postStorage, commentStorage), 2)
+	handler := NewReportHandler(reportService)
+
+	post, err := postService.CreatePost("Test", "Text", "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := func(user, reason string) int {
+		body, _ := json.Marshal(map[string]interface{}{"type": "post", "id": post.ID, "reason": reason})
+		req := httptest.NewRequest("POST", "/v1/reports/create", bytes.NewReader(body))
+		if user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, config.User{Name: user}))
+		}
+		rr := httptest.NewRecorder()
+		handler.CreateReport(rr, req)
+		return rr.Code
+	}
+	for _, tc := range []struct {
+		user, reason string
+		want         int
+	}{
+		{"", models.ReportReasonSpam, http.StatusUnauthorized},
+		{"alice", "boring", http.StatusBadRequest},
+		{"alice", models.ReportReasonSpam, http.StatusCreated},
+		{"alice", models.ReportReasonAbuse, http.StatusConflict},
+		{"bob", models.ReportReasonSpam, http.StatusCreated},
+	} {
+		if code := report(tc.user, tc.reason); code != tc.want {
+			t.Errorf("%q/%q: ожидался код %d, получен %d", tc.user, tc.reason, tc.want, code)
+		}
+	}
+	if visible, _ := postService.GetVisiblePosts(""); len(visible) != 0 {
+		t.Error("Пост должен скрыться после двух жалоб")
+	}
+
+	rr := httptest.NewRecorder()
+	handler.GetReports(rr, httptest.NewRequest("GET", "/v1/reports", nil))
+	var open []models.Report
+	if err := json.NewDecoder(rr.Body).Decode(&open); err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 {
+		t.Fatalf("Ожидалось 2 открытые жалобы, получено %+v", open)
+	}
+
+	resolve := func(resolution string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"type": "post", "id": post.ID, "resolution": resolution})
+		rr := httptest.NewRecorder()
+		handler.Resolve(rr, httptest.NewRequest("POST", "/v1/reports/resolve", bytes.NewReader(body)))
+		return rr
+	}
+	if rr := resolve("ban"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался код 400 для неизвестного решения, получен %d", rr.Code)
+	}
+	rr = resolve(models.ReportDismiss)
+	var result map[string]int
+	json.NewDecoder(rr.Body).Decode(&result)
+	if rr.Code != http.StatusOK || result["resolved"] != 2 {
+		t.Errorf("Ожидалось закрытие 2 жалоб, получено %d %v", rr.Code, result)
+	}
+	if visible, _ := postService.GetVisiblePosts(""); len(visible) != 1 {
+		t.Error("Отклонённые жалобы должны вернуть пост в ленту")
+	}
+	if rr := resolve(models.ReportDismiss); rr.Code != http.StatusNotFound {
+		t.Errorf("Ожидался код 404 без открытых жалоб, получен %d", rr.Code)
+	}
+}
+
+func TestIdempotencyReplaysCreate(t *testing.T) {
+	postStorage := storage.NewInMemoryPostStorage()
+	postService := services.NewPostService(postStorage, storage.NewInMemoryTxManager(postStorage, storage.NewInMemoryCommentStorage()))
+	cfg := &config.Config{}
+	cfg.Idempotency.TTL = time.Hour
+	cfg.Idempotency.LockTimeout = time.Minute
+	handler := NewIdempotency(storage.NewInMemoryIdempotencyStorage(), cfg).Middleware(http.HandlerFunc(NewPostHandler(postService).CreatePost))
+
+	create := func(user, key, title string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"title": title, "text": "Text"})
+		req := httptest.NewRequest("POST", "/posts/create", bytes.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		if user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, config.User{Name: user}))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := create("alice", "k1", "Test")
+	retry := create("alice", "k1", "Test")
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Fatalf("Повтор должен вернуть первый ответ: %d %q, %d %q", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Ожидались заголовки повтора, получено %v", retry.Header())
+	}
+	// По ETag повтора можно изменить созданный пост
+	if etag := retry.Header().Get("ETag"); etag == "" || etag != first.Header().Get("ETag") {
+		t.Errorf("Повтор должен вернуть ETag первого ответа %q, получено %q", first.Header().Get("ETag"), etag)
+	}
+	if posts, _ := postStorage.GetAllPosts(); len(posts) != 1 {
+		t.Errorf("Повтор не должен создавать пост, постов %d", len(posts))
+	}
+
+	if rr := create("alice", "k1", "Другой"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался код 422 для другого тела, получен %d", rr.Code)
+	}
+	// Ключ другого пользователя или анонимного клиента не пересекается с ключом alice
+	if rr := create("bob", "k1", "Test"); rr.Code != http.StatusOK || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Ключ другого пользователя не должен повторять ответ, получено %d", rr.Code)
+	}
+	if rr := create("", "k1", "Test"); rr.Code != http.StatusUnauthorized || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Ключ анонимного клиента не должен повторять ответ, получено %d", rr.Code)
+	}
+	if posts, _ := postStorage.GetAllPosts(); len(posts) != 2 {
+		t.Errorf("Ожидалось 2 поста, получено %d", len(posts))
+	}
+}
+
+func TestIdempotencyStoresOnlyFinalResponses(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Idempotency.TTL = time.Hour
+	cfg.Idempotency.LockTimeout = time.Minute
+	status, calls := http.StatusOK, 0
+	handler := NewIdempotency(storage.NewInMemoryIdempotencyStorage(), cfg).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	serve := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/comments/create", strings.NewReader(`{"text":"Comment"}`))
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, tc := range []struct {
+		status int
+		stored bool
+	}{
+		{http.StatusCreated, true},
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, false},
+		{http.StatusConflict, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+	} {
+		key := fmt.Sprint(tc.status)
+		status, calls = tc.status, 0
+		serve(key)
+		status = http.StatusOK
+		rr := serve(key)
+		wantCalls := 2
+		if tc.stored {
+			wantCalls = 1
+		}
+		if replayed := rr.Header().Get("Idempotent-Replayed") == "true"; replayed != tc.stored || calls != wantCalls {
+			t.Errorf("%d: ожидалось сохранение %v, повтор %v после %d вызовов", tc.status, tc.stored, replayed, calls)
+		}
+	}
+}
+
+func TestDisableCommentsIfMatch(t *testing.T) {
+	postStorage := storage.NewInMemoryPostStorage()
+	postService := services.NewPostService(postStorage, storage.NewInMemoryTxManager(postStorage, storage.NewInMemoryCommentStorage()))
+	handler := NewPostHandler(postService)
+	post, _ := postService.CreatePost("Test", "Text", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.GetPost(rr, httptest.NewRequest("GET", "/posts/get?id=1", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(etag, `"1.`) {
+		t.Fatalf("Ожидался пост с ETag версии 1, получено %d %q", rr.Code, etag)
+	}
+
+	disable := func(ifMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]int{"post_id": post.ID})
+		req := httptest.NewRequest("POST", "/posts/disable-comments", bytes.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		handler.DisableComments(rr, req)
+		return rr
+	}
+	for _, tc := range []struct {
+		ifMatch string
+		want    int
+	}{
+		{"", http.StatusPreconditionRequired},
+		{`"2"`, http.StatusPreconditionFailed},
+		{`W/"1"`, http.StatusPreconditionFailed},
+		// Тег сжатого ответа несёт ту же версию
+		{encodedETag(etag, "gzip"), http.StatusOK},
+		// Версия уже сменилась
+		{etag, http.StatusPreconditionFailed},
+	} {
+		if rr := disable(tc.ifMatch); rr.Code != tc.want {
+			t.Errorf("If-Match %q: ожидался код %d, получен %d", tc.ifMatch, tc.want, rr.Code)
+		}
+	}
+	if rr := disable("*"); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"3"` {
+		t.Errorf("If-Match * должен проходить с новой версией, получено %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	rr = httptest.NewRecorder()
+	handler.GetPost(rr, httptest.NewRequest("GET", "/posts/get?id=42", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Ожидался код 404 для несуществующего поста, получен %d", rr.Code)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	posts, comments := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	postService := services.NewPostService(posts, storage.NewInMemoryTxManager(posts, comments))
+	handler := NewPostHandler(postService)
+	reactions := services.NewReactionService(storage.NewInMemoryReactionStorage(posts, comments), nil)
+	post, _ := postService.CreatePost("Test", "Text", "Author")
+
+	get := func(url, ifNoneMatch string, serve http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		serve(rr, req)
+		return rr
+	}
+	for _, tc := range []struct {
+		url   string
+		serve http.HandlerFunc
+	}{
+		{"/posts", handler.GetAllPosts},
+		{"/posts/get?id=1", handler.GetPost},
+	} {
+		rr := get(tc.url, "", tc.serve)
+		etag := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: ожидался ответ 200 с ETag, получено %d %q", tc.url, rr.Code, etag)
+		}
+		if rr := get(tc.url, `"other", W/`+etag, tc.serve); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("%s: ожидался пустой ответ 304, получено %d %q", tc.url, rr.Code, rr.Body.String())
+		}
+		// Реакция меняет тело ответа, а с ним и ETag
+		if _, err := reactions.AddReaction(models.ReactionTargetPost, post.ID, tc.url, models.ReactionUpvote); err != nil {
+			t.Fatal(err)
+		}
+		if rr := get(tc.url, etag, tc.serve); rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+			t.Errorf("%s: ожидался ответ 200 с новым ETag, получено %d %q", tc.url, rr.Code, rr.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name, method, ifNoneMatch, ifModifiedSince string
+		want                                       bool
+	}{
+		{"без условий", "GET", "", "", false},
+		{"тот же тег", "GET", `"abc"`, "", true},
+		{"любой тег", "HEAD", "*", "", true},
+		{"другой тег", "GET", `"def"`, "", false},
+		{"не изменялся", "GET", "", modified.Format(http.TimeFormat), true},
+		{"изменён позже", "GET", "", modified.Add(-time.Second).Format(http.TimeFormat), false},
+		{"неверная дата", "GET", "", "вчера", false},
+		// If-None-Match отменяет If-Modified-Since
+		{"тег важнее даты", "GET", `"def"`, modified.Format(http.TimeFormat), false},
+		{"не GET", "POST", `"abc"`, "", false},
+	} {
+		req := httptest.NewRequest(tc.method, "/posts", nil)
+		if tc.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tc.ifNoneMatch)
+		}
+		if tc.ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", tc.ifModifiedSince)
+		}
+		if got := notModified(req, `"abc"`, modified); got != tc.want {
+			t.Errorf("%s: ожидалось %v, получено %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestHTTPCacheControl(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.HTTPCache.Routes = []config.CacheRoute{
+		{Path: "/posts", CacheControl: "public, max-age=5"},
+		{Path: "/v1/reports", CacheControl: "no-store"},
+	}
+	cfg.HTTPCache.Authenticated = "private, no-cache"
+	status := http.StatusOK
+	handler := NewHTTPCache(cfg).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	serve := func(method, path string, user *config.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, *user))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	alice := &config.User{Name: "alice"}
+	for _, tc := range []struct {
+		method, path string
+		user         *config.User
+		want         string
+	}{
+		{"GET", "/posts", nil, "public, max-age=5"},
+		{"GET", "/posts", alice, "private, no-cache"},
+		{"GET", "/v1/reports", alice, "no-store"},
+		{"POST", "/posts", nil, ""},
+		{"GET", "/comments", nil, ""},
+	} {
+		if got := serve(tc.method, tc.path, tc.user).Header().Get("Cache-Control"); got != tc.want {
+			t.Errorf("%s %s: ожидался Cache-Control %q, получено %q", tc.method, tc.path, tc.want, got)
+		}
+	}
+	if rr := serve("GET", "/posts", nil); rr.Header().Get("Vary") != "Authorization" {
+		t.Errorf("Ожидался Vary: Authorization, получено %q", rr.Header().Get("Vary"))
+	}
+	status = http.StatusInternalServerError
+	if rr := serve("GET", "/posts", nil); rr.Header().Get("Cache-Control") != "" {
+		t.Errorf("Ответ с ошибкой не должен кэшироваться, получено %q", rr.Header().Get("Cache-Control"))
+	}
+}
+
+func TestListRepresentations(t *testing.T) {
+	posts, comments := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	postService := services.NewPostService(posts, storage.NewInMemoryTxManager(posts, comments))
+	handler := NewPostHandler(postService)
+	postService.CreatePost("Test1", "Text1", "Author1")
+	postService.CreatePost("Test2", "Text2", "Author2")
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/posts", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		handler.GetAllPosts(rr, req)
+		return rr
+	}
+	for _, tc := range []struct {
+		accept, want string
+	}{
+		{"", mediaJSON},
+		{"*/*", mediaJSON},
+		{"application/msgpack", mediaMsgpack},
+		{"application/json;q=0.5, application/x-ndjson", mediaNDJSON},
+		{"application/*;q=0.2, application/msgpack;q=0.9", mediaMsgpack},
+		{"text/html, */*;q=0.1", mediaJSON},
+	} {
+		if rr := get(tc.accept); rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != tc.want {
+			t.Errorf("Accept %q: ожидался %s, получено %d %q", tc.accept, tc.want, rr.Code, rr.Header().Get("Content-Type"))
+		}
+	}
+	if rr := get("text/html, application/json;q=0"); rr.Code != http.StatusNotAcceptable {
+		t.Errorf("Ожидался статус 406, получено %d", rr.Code)
+	}
+
+	rr := get(mediaNDJSON)
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"Test2"`) {
+		t.Errorf("Ожидалось 2 строки NDJSON, получено %q", rr.Body.String())
+	}
+	// NDJSON проверяется по своему ETag, как и остальные представления
+	etag := rr.Header().Get("ETag")
+	if etag == "" || etag == get(mediaJSON).Header().Get("ETag") {
+		t.Errorf("Ожидался собственный ETag NDJSON, получено %q", etag)
+	}
+	req := httptest.NewRequest("GET", "/posts", nil)
+	req.Header.Set("Accept", mediaNDJSON)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler.GetAllPosts(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Ожидался статус 304 для NDJSON, получено %d", rr.Code)
+	}
+
+	rr = get(mediaMsgpack)
+	var decoded []map[string]interface{}
+	if err := msgpack.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0]["Title"] != "Test1" {
+		t.Errorf("Ожидались 2 поста в MessagePack, получено %v", decoded)
+	}
+	if rr.Header().Get("ETag") == get(mediaJSON).Header().Get("ETag") {
+		t.Error("ETag представлений должны различаться")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Compression.MinSize = 100
+	cfg.HTTPCache.Routes = []config.CacheRoute{{Path: "/", CacheControl: "public, max-age=5"}}
+	body := strings.Repeat("сжимаемый текст ", 20)
+	var stream bool
+	handler := NewCompression(cfg).Middleware(NewHTTPCache(cfg).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checkNotModified(w, r, `"abc"`, time.Time{}) {
+			return
+		}
+		w.Write([]byte(body[:r.ContentLength]))
+		if stream {
+			http.NewResponseController(w).Flush()
+		}
+	})))
+	serve := func(size int, acceptEncoding string, ifNoneMatch ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.ContentLength = int64(size)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		if len(ifNoneMatch) > 0 {
+			req.Header.Set("If-None-Match", ifNoneMatch[0])
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	decode := func(rr *httptest.ResponseRecorder) string {
+		var reader io.Reader
+		switch rr.Header().Get("Content-Encoding") {
+		case "gzip":
+			gz, err := gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = gz
+		case "zstd":
+			zr, err := zstd.NewReader(rr.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			reader = zr
+		default:
+			reader = rr.Body
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	for _, tc := range []struct {
+		size           int
+		acceptEncoding string
+		want           string
+	}{
+		{len(body), "gzip, deflate, br, zstd", "zstd"},
+		{len(body), "gzip", "gzip"},
+		{len(body), "zstd;q=0.5, gzip", "gzip"},
+		{len(body), "*", "zstd"},
+		{len(body), "zstd;q=0, *", "gzip"},
+		{len(body), "identity", ""},
+		{len(body), "", ""},
+		// Короткий ответ не сжимается
+		{50, "gzip", ""},
+	} {
+		rr := serve(tc.size, tc.acceptEncoding)
+		if got := rr.Header().Get("Content-Encoding"); got != tc.want {
+			t.Errorf("Accept-Encoding %q, %d байт: ожидалась кодировка %q, получено %q", tc.acceptEncoding, tc.size, tc.want, got)
+		}
+		if got := decode(rr); got != body[:tc.size] {
+			t.Errorf("Accept-Encoding %q: тело искажено: %q", tc.acceptEncoding, got)
+		}
+		// У сжатого представления свой строгий тег
+		etag := `"abc"`
+		if tc.want != "" {
+			etag = `"abc-` + tc.want + `"`
+		}
+		if rr.Header().Get("ETag") != etag || rr.Header().Get("Cache-Control") != "public, max-age=5" {
+			t.Errorf("Заголовки обработчика потеряны: %v", rr.Header())
+		}
+		if !strings.Contains(strings.Join(rr.Header().Values("Vary"), ","), "Accept-Encoding") {
+			t.Errorf("Ожидался Vary: Accept-Encoding, получено %q", rr.Header().Values("Vary"))
+		}
+	}
+
+	// Тег сжатого представления подтверждает копию, 304 повторяет его
+	for _, tc := range []struct {
+		acceptEncoding string
+		ifNoneMatch    string
+		want           string
+	}{
+		{"gzip", `"abc-gzip"`, `"abc-gzip"`},
+		{"gzip", `W/"abc-gzip"`, `"abc-gzip"`},
+		{"gzip", `"abc"`, `"abc"`},
+		{"", `"abc-zstd"`, `"abc"`},
+	} {
+		rr := serve(len(body), tc.acceptEncoding, tc.ifNoneMatch)
+		if rr.Code != http.StatusNotModified || rr.Header().Get("ETag") != tc.want {
+			t.Errorf("If-None-Match %s: ожидался 304 с ETag %s, получено %d %q", tc.ifNoneMatch, tc.want, rr.Code, rr.Header().Get("ETag"))
+		}
+	}
+
+	// Потоковый ответ сжимается независимо от размера
+	stream = true
+	rr := serve(50, "gzip")
+	if rr.Header().Get("Content-Encoding") != "gzip" || !rr.Flushed || decode(rr) != body[:50] {
+		t.Errorf("Ожидался сброшенный сжатый ответ, получено %v, %v", rr.Header(), rr.Flushed)
+	}
+}
+
+func TestExport(t *testing.T) {
+	posts, comments := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	txManager := storage.NewInMemoryTxManager(posts, comments)
+	postService := services.NewPostService(posts, txManager)
+	commentService := services.NewCommentService(posts, comments, txManager)
+	handler := NewExportHandler(services.NewExportService(storage.NewInMemoryExportStorage(posts, comments)))
+	for _, title := range []string{"First", "Second", "Third"} {
+		postService.CreatePost(title, "Text, \"quoted\"", "Author")
+	}
+	commentService.CreateComment(1, nil, "Comment", "User", "User")
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Export(rr, httptest.NewRequest("GET", "/v1/admin/export?"+query, nil))
+		return rr
+	}
+
+	rr := export("type=posts&after_id=1")
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != mediaNDJSON || len(lines) != 2 {
+		t.Fatalf("Ожидались 2 поста после первого в NDJSON, получено %d %q", rr.Code, rr.Body.String())
+	}
+	var post models.Post
+	if err := json.Unmarshal([]byte(lines[0]), &post); err != nil || post.ID != 2 || post.Title != "Second" {
+		t.Errorf("Ожидался второй пост, получено %+v, %v", post, err)
+	}
+	if cursor := rr.Result().Trailer.Get(exportCursorTrailer); cursor != "3" {
+		t.Errorf("Ожидался курсор 3 в трейлере, получено %q", cursor)
+	}
+
+	rr = export("type=comments&format=csv&from=2000-01-01")
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0][0] != "id" || records[1][1] != "1" || records[1][3] != "Comment" {
+		t.Errorf("Ожидались заголовок и комментарий в CSV, получено %v", records)
+	}
+
+	// Пустая выгрузка сохраняет курсор
+	if rr := export("type=posts&after_id=2&to=2000-01-01"); rr.Body.Len() != 0 || rr.Result().Trailer.Get(exportCursorTrailer) != "2" {
+		t.Errorf("Ожидалась пустая выгрузка с курсором 2, получено %q, %v", rr.Body.String(), rr.Result().Trailer)
+	}
+	for _, query := range []string{"type=users", "type=posts&format=xml", "type=posts&from=вчера", "type=posts&after_id=-1"} {
+		if rr := export(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: ожидался статус 400, получено %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"ozon_test/config"
+)
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// Authenticate определяет пользователя по заголовку Authorization: Bearer <token>
+// и кладёт его в контекст запроса. Запрос без заголовка выполняется
+// анонимно, с неизвестным токеном — отклоняется.
+func Authenticate(cfg *config.Config) func(http.Handler) http.Handler {
+	users := cfg.Auth.Users
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			user, ok := findUser(users, header)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Неверный токен доступа", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+		})
+	}
+}
+
+// findUser возвращает пользователя по непустому заголовку Authorization;
+// ok ложно, если заголовок неверен или токен неизвестен.
+func findUser(users []config.User, header string) (config.User, bool) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return config.User{}, false
+	}
+	for _, user := range users {
+		// Сравнение за постоянное время не выдаёт совпавший префикс токена
+		if subtle.ConstantTimeCompare([]byte(token), []byte(user.Token)) == 1 && user.Token != "" {
+			return user, true
+		}
+	}
+	return config.User{}, false
+}
+
+// UserFromContext возвращает имя пользователя, от которого выполняется запрос.
+func UserFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(userContextKey).(config.User)
+	return user.Name, ok
+}
+
+// viewer возвращает имя пользователя запроса; пустое для анонимного.
+func viewer(r *http.Request) string {
+	name, _ := UserFromContext(r.Context())
+	return name
+}
+
+// requireUser возвращает имя пользователя запроса; анонимному
+// запросу отвечает 401 и возвращает false.
+func requireUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name, ok := UserFromContext(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+	}
+	return name, ok
+}
+
+// hasRole сообщает, есть ли у user права роли role.
+func hasRole(user config.User, role string) bool {
+	return user.Role == role || user.Role == config.RoleAdmin
+}
+
+// RequireRole пропускает только пользователей с правами роли role:
+// анонимный запрос получает 401, пользователь без прав — 403.
+func RequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(userContextKey).(config.User)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+			return
+		}
+		if !hasRole(user, role) {
+			http.Error(w, "Недостаточно прав", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
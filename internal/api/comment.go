@@ -2,32 +2,55 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"ozon_test/config"
+	"ozon_test/internal/models"
 	"ozon_test/internal/services"
+	"ozon_test/internal/spam"
+	"ozon_test/internal/storage"
 )
 
 type CommentHandler struct {
-	service *services.CommentService
+	service      *services.CommentService
+	realIPHeader string
 }
 
-func NewCommentHandler(service *services.CommentService) *CommentHandler {
-	return &CommentHandler{service: service}
+func NewCommentHandler(service *services.CommentService, cfg *config.Config) *CommentHandler {
+	return &CommentHandler{service: service, realIPHeader: cfg.RateLimit.RealIPHeader}
 }
 
+// CreateComment создаёт комментарий от имени пользователя запроса;
+// анонимные комментарии не принимаются.
 func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	author, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
 	var req struct {
 		PostID          int    `json:"post_id"`
 		ParentCommentID *int   `json:"parent_comment_id"`
 		Text            string `json:"text"`
-		Author          string `json:"author"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Неверный запрос", http.StatusBadRequest)
 		return
 	}
-	comment, err := h.service.CreateComment(req.PostID, req.ParentCommentID, req.Text, req.Author)
+	comment, err := h.service.CreateComment(req.PostID, req.ParentCommentID, req.Text, author, clientKey(r, h.realIPHeader))
+	if errors.Is(err, spam.ErrDuplicate) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, spam.ErrTooFast) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Пост не найден", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Не удалось создать комментарий: "+err.Error(), http.StatusBadRequest)
 		return
@@ -42,16 +65,33 @@ func (h *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Неверный ID поста", http.StatusBadRequest)
 		return
 	}
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-	if limit == 0 {
-		limit = 10
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
 	}
-	comments, err := h.service.GetCommentsByPostID(postID, limit, offset)
+	// Время изменения читается до комментариев (см. PostHandler.GetAllPosts)
+	lastModified, err := h.service.LastModified(postID)
 	if err != nil {
 		http.Error(w, "Не удалось получить комментарии", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comments)
+	var comments []*models.Comment
+	if sort := r.URL.Query().Get("sort"); sort != "" {
+		comments, err = h.service.GetCommentTree(postID, viewer(r), sort, limit, offset)
+	} else {
+		comments, err = h.service.GetVisibleComments(postID, viewer(r), limit, offset)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Пост не найден", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidCommentSort) {
+		http.Error(w, "Неизвестный порядок сортировки", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Не удалось получить комментарии", http.StatusInternalServerError)
+		return
+	}
+	writeCacheableList(w, r, comments, lastModified)
 }
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"ozon_test/config"
+)
+
+// encodings — поддерживаемые кодировки сжатия в порядке предпочтения
+// сервера: при равных весах в Accept-Encoding выбирается первая.
+var encodings = []string{"zstd", "gzip"}
+
+// encoder — общий интерфейс gzip.Writer и zstd.Encoder.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Кодировщики дороги в создании (zstd выделяет окно при первой записи),
+// поэтому переиспользуются между ответами.
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	"zstd": {New: func() interface{} {
+		// Окно в 1 МиБ укладывается в ограничения браузеров (8 МиБ)
+		// и держит память пула небольшой
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return encoder
+	}},
+}
+
+// Compression сжимает ответы кодировкой, выбранной по Accept-Encoding.
+// Ответ сжимается, когда его тело достигает minSize байт либо когда
+// обработчик сбрасывает его по частям (потоковый ответ).
+//
+// К ETag сжатого ответа добавляется суффикс кодировки (см. encodedETag):
+// представления с разными телами не должны иметь общий строгий тег.
+type Compression struct {
+	minSize int
+}
+
+func NewCompression(cfg *config.Config) *Compression {
+	return &Compression{minSize: cfg.Compression.MinSize}
+}
+
+func (c *Compression) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		header := r.Header.Get("Accept-Encoding")
+		encoding, ok := negotiate(header, encodings, matchEncoding)
+		// Без заголовка клиент может не понимать сжатие, а у HEAD нет тела
+		if header == "" || !ok || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writer := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: c.minSize,
+			ifNoneMatch: r.Header.Get("If-None-Match")}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// compressWriter копит начало тела, пока не станет ясно, сжимать ли ответ:
+// заголовки отправляются только после этого решения.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	ifNoneMatch string
+	status      int
+	buf         []byte
+	started     bool
+	encoder     encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.started {
+		if w.encoder != nil {
+			return w.encoder.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush отправляет клиенту записанную часть ответа. Ответ, сбрасываемый
+// по частям, считается потоковым и сжимается независимо от размера.
+func (w *compressWriter) Flush() {
+	if !w.started {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if err := w.start(true); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil && w.encoder.Flush() != nil {
+		return
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// start отправляет заголовки и накопленное тело; compress разрешает
+// сжатие, если у ответа есть тело и обработчик не сжал его сам.
+func (w *compressWriter) start(compress bool) error {
+	w.started = true
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.encoder = encoderPools[w.encoding].Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if etag := header.Get("ETag"); etag != "" {
+		encoded := encodedETag(etag, w.encoding)
+		// Ответ 304 повторяет тег представления, которое подтвердил клиент
+		if w.encoder != nil || w.status == http.StatusNotModified && etagListed(w.ifNoneMatch, encoded) {
+			header.Set("ETag", encoded)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close завершает ответ: короткое тело отправляется без сжатия.
+func (w *compressWriter) close() {
+	if !w.started {
+		if w.status == 0 {
+			// Обработчик ничего не записал: ответ 200 без тела отправит net/http
+			return
+		}
+		w.start(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		encoderPools[w.encoding].Put(w.encoder)
+		w.encoder = nil
+	}
+}
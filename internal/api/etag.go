@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ozon_test/internal/services"
+)
+
+// versionETag возвращает ETag записи: номер её версии в кавычках.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// itemETag возвращает ETag записи с телом ответа body: версию и хеш тела.
+// Тело меняют и реакции, не меняющие версию, поэтому If-None-Match
+// сравнивает тег целиком, а If-Match — только версию.
+func itemETag(version int, body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + strconv.Itoa(version) + "." + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// bodyETag возвращает ETag ответа-списка: хеш его тела.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ifMatchVersion возвращает версию из заголовка If-Match; ok ложно, если
+// заголовка нет. «*» означает любую версию. Слабый или неразборчивый тег
+// не совпадает ни с какой версией: If-Match сравнивает теги строго.
+func ifMatchVersion(r *http.Request) (version int, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false
+	}
+	if header == "*" {
+		return services.AnyVersion, true
+	}
+	unquoted, found := strings.CutPrefix(stripETagEncoding(header), `"`)
+	if found {
+		unquoted, found = strings.CutSuffix(unquoted, `"`)
+	}
+	// Тег из itemETag: версия и хеш тела через точку
+	unquoted, _, _ = strings.Cut(unquoted, ".")
+	version, err := strconv.Atoi(unquoted)
+	if !found || err != nil || version <= 0 {
+		return -1, true
+	}
+	return version, true
+}
+
+// encodedETag возвращает ETag ответа, сжатого кодировкой encoding: у сжатого
+// и несжатого представлений разные тела, поэтому и строгие теги разные.
+func encodedETag(etag, encoding string) string {
+	unquoted, ok := strings.CutSuffix(etag, `"`)
+	if !ok {
+		return etag
+	}
+	return unquoted + "-" + encoding + `"`
+}
+
+// stripETagEncoding убирает из тега суффикс кодировки, добавленный
+// encodedETag: обработчики сравнивают теги несжатых ответов.
+func stripETagEncoding(tag string) string {
+	for _, encoding := range encodings {
+		if unquoted, ok := strings.CutSuffix(tag, "-"+encoding+`"`); ok {
+			return unquoted + `"`
+		}
+	}
+	return tag
+}
+
+// etagMatches сообщает, есть ли etag в списке тегов заголовка If-None-Match.
+// Сравнение слабое: префикс W/ и суффикс кодировки сжатия не учитываются.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || stripETagEncoding(strings.TrimPrefix(tag, "W/")) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagListed сообщает, есть ли etag в списке тегов header без учёта
+// префикса W/.
+func etagListed(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
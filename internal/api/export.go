@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"ozon_test/internal/services"
+	"ozon_test/internal/storage"
+)
+
+// exportCursorTrailer — трейлер с ID последней выгруженной записи.
+const exportCursorTrailer = "X-Export-Cursor"
+
+var exportContentTypes = map[string]string{
+	services.ExportNDJSON: mediaNDJSON,
+	services.ExportCSV:    "text/csv; charset=utf-8",
+}
+
+type ExportHandler struct {
+	service *services.ExportService
+}
+
+func NewExportHandler(service *services.ExportService) *ExportHandler {
+	return &ExportHandler{service: service}
+}
+
+// Export выгружает посты или комментарии потоком. Успешная выгрузка
+// завершается трейлером X-Export-Cursor; если она оборвалась, соединение
+// разрывается, и клиент продолжает её с after_id последней полученной записи.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter storage.ExportFilter
+	if value := query.Get("after_id"); value != "" {
+		afterID, err := strconv.Atoi(value)
+		if err != nil || afterID < 0 {
+			http.Error(w, "Неверный after_id", http.StatusBadRequest)
+			return
+		}
+		filter.AfterID = afterID
+	}
+	var err error
+	if filter.From, err = services.ParseExportDate(query.Get("from")); err != nil {
+		http.Error(w, "Неверный from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = services.ParseExportDate(query.Get("to")); err != nil {
+		http.Error(w, "Неверный to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = services.ExportNDJSON
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Trailer", exportCursorTrailer)
+	body := &trackingWriter{Writer: w}
+	lastID, err := h.service.Export(body, query.Get("type"), format, filter)
+	switch {
+	case errors.Is(err, services.ErrInvalidExportTarget) || errors.Is(err, services.ErrInvalidExportFormat):
+		w.Header().Del("Trailer")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil && !body.written:
+		w.Header().Del("Trailer")
+		http.Error(w, "Не удалось выгрузить данные", http.StatusInternalServerError)
+	case err != nil:
+		// Статус уже отправлен: разрыв соединения не даст принять
+		// оборванную выгрузку за полную
+		log.Printf("Выгрузка %s прервана после ID %d: %v", query.Get("type"), lastID, err)
+		panic(http.ErrAbortHandler)
+	default:
+		if !body.written {
+			// Пустая выгрузка: заголовки отправляются до трейлера явно
+			w.WriteHeader(http.StatusOK)
+			http.NewResponseController(w).Flush()
+		}
+		w.Header().Set(exportCursorTrailer, strconv.Itoa(lastID))
+	}
+}
+
+// trackingWriter запоминает, начата ли запись ответа.
+type trackingWriter struct {
+	io.Writer
+	written bool
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.Writer.Write(p)
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"ozon_test/internal/services"
+)
+
+type FeedHandler struct {
+	service *services.FeedService
+}
+
+func NewFeedHandler(service *services.FeedService) *FeedHandler {
+	return &FeedHandler{service: service}
+}
+
+func (h *FeedHandler) GetHotFeed(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	writeList(w, r, h.service.GetHotPosts(limit, offset))
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"ozon_test/config"
+)
+
+// HTTPCache выставляет ответам GET и HEAD заголовок Cache-Control
+// их маршрута (см. config.HTTPCache). Ответы с ошибкой его не получают.
+type HTTPCache struct {
+	routes        map[string]string
+	authenticated string
+}
+
+func NewHTTPCache(cfg *config.Config) *HTTPCache {
+	routes := make(map[string]string, len(cfg.HTTPCache.Routes))
+	for _, route := range cfg.HTTPCache.Routes {
+		routes[route.Path] = route.CacheControl
+	}
+	return &HTTPCache{routes: routes, authenticated: cfg.HTTPCache.Authenticated}
+}
+
+func (c *HTTPCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := c.routes[r.URL.Path]
+		if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Ответ зависит от пользователя: неодобренные записи видит только автор
+		w.Header().Add("Vary", "Authorization")
+		if _, authenticated := UserFromContext(r.Context()); authenticated && strings.Contains(value, "public") {
+			value = c.authenticated
+		}
+		next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+	})
+}
+
+// cacheControlWriter выставляет Cache-Control успешному ответу и ответу 304.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < http.StatusMultipleChoices || status == http.StatusNotModified {
+			w.Header().Set("Cache-Control", w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap открывает http.ResponseController исходный ResponseWriter,
+// например, для сброса потокового ответа.
+func (w *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writeCacheable отвечает телом v в JSON с заголовками ETag (etag от тела)
+// и Last-Modified либо, если копия клиента актуальна, 304 Not Modified.
+// Нулевое lastModified заголовок Last-Modified не выставляет.
+func writeCacheable(w http.ResponseWriter, r *http.Request, v interface{}, lastModified time.Time, etag func(body []byte) string) {
+	body, err := encodeJSON(v)
+	if err != nil {
+		http.Error(w, "Не удалось сформировать ответ", http.StatusInternalServerError)
+		return
+	}
+	if checkNotModified(w, r, etag(body), lastModified) {
+		return
+	}
+	w.Header().Set("Content-Type", mediaJSON)
+	w.Write(body)
+}
+
+// writeCacheableList отвечает списком items в представлении из Accept
+// (см. writeList) с заголовками ETag и Last-Modified, как writeCacheable.
+// ETag вычисляется по телу представления, поэтому у каждого он свой.
+func writeCacheableList(w http.ResponseWriter, r *http.Request, items interface{}, lastModified time.Time) {
+	mediaType, ok := listMediaType(w, r)
+	if !ok {
+		return
+	}
+	body, err := encodeAs(mediaType, items)
+	if err != nil {
+		http.Error(w, "Не удалось сформировать ответ", http.StatusInternalServerError)
+		return
+	}
+	if checkNotModified(w, r, bodyETag(body), lastModified) {
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Write(body)
+}
+
+// checkNotModified выставляет заголовки ETag (если он не пуст) и
+// Last-Modified и, если копия клиента актуальна, отвечает 304.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	// Заголовок передаёт время с точностью до секунды: изменение в текущую
+	// секунду его бы не изменило, и клиент получил бы 304 на новое
+	// содержимое. Поэтому такой ответ проверяется только по ETag
+	lastModified = lastModified.Truncate(time.Second)
+	if !lastModified.IsZero() && lastModified.Before(time.Now().Truncate(time.Second)) {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	} else {
+		lastModified = time.Time{}
+	}
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// encodeJSON кодирует v так же, как json.Encoder в остальных обработчиках.
+func encodeJSON(v interface{}) ([]byte, error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(v); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// notModified проверяет условия запроса GET или HEAD (RFC 9110, 13.2.2):
+// If-None-Match, если он есть, отменяет If-Modified-Since.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, etag)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.After(since)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"ozon_test/config"
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// replayedHeaders — заголовки ответа, которые сохраняются вместе с телом:
+// по ним клиент продолжает работу с созданной записью (If-Match и т. п.).
+var replayedHeaders = []string{"ETag", "Location", "Last-Modified"}
+
+// Idempotency сохраняет первый ответ на запрос с заголовком Idempotency-Key
+// и возвращает его на повторы с тем же ключом в течение TTL. Ключи разных
+// пользователей (для анонимных запросов — IP) не пересекаются. Должен
+// стоять после Authenticate.
+type Idempotency struct {
+	storage      storage.IdempotencyStorage
+	ttl          time.Duration
+	lockTimeout  time.Duration
+	realIPHeader string
+
+	mu        sync.Mutex
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+// Период удаления устаревших ключей
+const idempotencyPurgeInterval = time.Minute
+
+func NewIdempotency(storage storage.IdempotencyStorage, cfg *config.Config) *Idempotency {
+	return &Idempotency{
+		storage:      storage,
+		ttl:          cfg.Idempotency.TTL,
+		lockTimeout:  cfg.Idempotency.LockTimeout,
+		realIPHeader: cfg.RateLimit.RealIPHeader,
+		now:          time.Now,
+	}
+}
+
+// requestHash отличает повтор запроса от другого запроса с тем же ключом.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// purge не чаще раза в idempotencyPurgeInterval удаляет записи старше TTL.
+func (i *Idempotency) purge(now time.Time) {
+	i.mu.Lock()
+	if now.Sub(i.lastPurge) < idempotencyPurgeInterval {
+		i.mu.Unlock()
+		return
+	}
+	i.lastPurge = now
+	i.mu.Unlock()
+	if err := i.storage.PurgeIdempotencyKeys(now.Add(-i.ttl)); err != nil {
+		log.Printf("Ошибка удаления устаревших ключей идемпотентности: %v", err)
+	}
+}
+
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, "Ключ идемпотентности длиннее 255 символов", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Неверный запрос", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := i.now()
+		i.purge(now)
+		record := &models.IdempotencyRecord{
+			Owner:       clientKey(r, i.realIPHeader),
+			Key:         key,
+			RequestHash: requestHash(r, body),
+			CreatedAt:   now,
+		}
+		existing, err := i.storage.ReserveIdempotencyKey(record, now.Add(-i.ttl), now.Add(-i.lockTimeout))
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			// Ключ освободили между попыткой занять его и чтением записи
+			http.Error(w, "Запрос с этим ключом идемпотентности ещё выполняется", http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "Не удалось проверить ключ идемпотентности", http.StatusInternalServerError)
+			return
+		case existing == nil:
+		case existing.RequestHash != record.RequestHash:
+			http.Error(w, "Ключ идемпотентности уже использован для другого запроса", http.StatusUnprocessableEntity)
+			return
+		case existing.StatusCode == 0:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Запрос с этим ключом идемпотентности ещё выполняется", http.StatusConflict)
+			return
+		default:
+			if existing.ContentType != "" {
+				w.Header().Set("Content-Type", existing.ContentType)
+			}
+			for name, value := range existing.Headers {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(existing.StatusCode)
+			w.Write(existing.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		// Ответ, зависящий от состояния или времени, не сохраняется:
+		// повтор выполнит запрос заново
+		if !storableStatus(rec.status) {
+			if err := i.storage.ReleaseIdempotencyKey(record.Owner, record.Key); err != nil {
+				log.Printf("Ошибка освобождения ключа идемпотентности: %v", err)
+			}
+			return
+		}
+		record.StatusCode = rec.status
+		record.ContentType = w.Header().Get("Content-Type")
+		record.Headers = make(map[string]string)
+		for _, name := range replayedHeaders {
+			if value := w.Header().Get(name); value != "" {
+				record.Headers[name] = value
+			}
+		}
+		// Сжатие, если оно уже началось, добавило к ETag суффикс кодировки;
+		// повтор может прийти с другой кодировкой
+		if etag, ok := record.Headers["ETag"]; ok {
+			record.Headers["ETag"] = stripETagEncoding(etag)
+		}
+		record.Body = rec.body.Bytes()
+		if err := i.storage.SaveIdempotentResponse(record); err != nil {
+			log.Printf("Ошибка сохранения ответа для ключа идемпотентности: %v", err)
+		}
+	})
+}
+
+// storableStatus сообщает, сохраняется ли ответ с кодом status для повторов:
+// успех и ошибки проверки запроса, которые повтор получил бы снова.
+// Конфликт (в том числе повтор по мнению детектора спама), отказ по частоте,
+// отсутствующая запись и ошибки сервера могут пройти при следующей попытке.
+func storableStatus(status int) bool {
+	switch {
+	case status >= 200 && status < 300:
+		return true
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
+	}
+}
+
+// responseRecorder передаёт ответ клиенту и запоминает его код и тело.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
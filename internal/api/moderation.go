@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"ozon_test/internal/services"
+	"ozon_test/internal/storage"
+)
+
+// ModerationHandler обслуживает очередь модерации. Доступ к нему
+// ограничивается RequireRole.
+type ModerationHandler struct {
+	service *services.ModerationService
+}
+
+func NewModerationHandler(service *services.ModerationService) *ModerationHandler {
+	return &ModerationHandler{service: service}
+}
+
+type moderationTarget struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+func (h *ModerationHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	items, err := h.service.Queue(limit, offset)
+	if err != nil {
+		http.Error(w, "Не удалось получить очередь модерации", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func (h *ModerationHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, h.service.Approve)
+}
+
+func (h *ModerationHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, h.service.Reject)
+}
+
+func (h *ModerationHandler) decide(w http.ResponseWriter, r *http.Request, action func(string, services.ModerationTarget) error) {
+	var req moderationTarget
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный запрос", http.StatusBadRequest)
+		return
+	}
+	err := action(viewer(r), services.ModerationTarget{Type: req.Type, ID: req.ID})
+	switch {
+	case errors.Is(err, services.ErrInvalidModerationTarget):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Запись не найдена", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "Не удалось изменить статус", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Bulk применяет действие approve или reject к списку записей и возвращает
+// итог по каждой: ошибка одной записи не отменяет остальные.
+func (h *ModerationHandler) Bulk(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action string             `json:"action"`
+		Items  []moderationTarget `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный запрос", http.StatusBadRequest)
+		return
+	}
+	targets := make([]services.ModerationTarget, len(req.Items))
+	for i, item := range req.Items {
+		targets[i] = services.ModerationTarget{Type: item.Type, ID: item.ID}
+	}
+	results, err := h.service.Bulk(viewer(r), req.Action, targets)
+	if errors.Is(err, services.ErrInvalidModerationAction) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Не удалось изменить статусы", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
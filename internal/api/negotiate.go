@@ -0,0 +1,89 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+)
+
+// weighted — значение из заголовка Accept или Accept-Encoding с его весом q.
+type weighted struct {
+	value   string
+	quality float64
+}
+
+// parseWeighted разбирает список значений с весами («gzip;q=0.5, zstd»).
+// Вес по умолчанию — 1; параметры, кроме q, отбрасываются. Значения
+// приводятся к нижнему регистру.
+func parseWeighted(header string) []weighted {
+	var values []weighted
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		item := weighted{value: value, quality: 1}
+		for _, param := range strings.Split(params, ";") {
+			name, raw, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(name)) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil && q >= 0 && q <= 1 {
+				item.quality = q
+			}
+		}
+		values = append(values, item)
+	}
+	return values
+}
+
+// negotiate выбирает из offers вариант с наибольшим весом в header по
+// правилу match (чем больше specificity, тем точнее совпадение и тем
+// важнее его вес). При равных весах побеждает вариант, указанный в offers
+// раньше. Пустой header принимает первый вариант; ok ложно, если
+// ни один вариант не допустим.
+func negotiate(header string, offers []string, match func(pattern, offer string) (specificity int, ok bool)) (string, bool) {
+	if strings.TrimSpace(header) == "" {
+		return offers[0], true
+	}
+	accepted := parseWeighted(header)
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, specificity := 0.0, -1
+		for _, item := range accepted {
+			if s, ok := match(item.value, offer); ok && s > specificity {
+				quality, specificity = item.quality, s
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// matchMediaType сопоставляет диапазон Accept («*/*», «application/*» или
+// точный тип) с типом offer.
+func matchMediaType(pattern, offer string) (int, bool) {
+	switch {
+	case pattern == offer:
+		return 2, true
+	case pattern == "*/*":
+		return 0, true
+	case strings.HasSuffix(pattern, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(pattern, "*")):
+		return 1, true
+	}
+	return 0, false
+}
+
+// matchEncoding сопоставляет кодировку из Accept-Encoding («*» или
+// название) с кодировкой offer.
+func matchEncoding(pattern, offer string) (int, bool) {
+	switch pattern {
+	case offer:
+		return 1, true
+	case "*":
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 100
+)
+
+// pageParams разбирает параметры limit и offset списка. Без limit (или при
+// limit=0) отдаётся defaultPageLimit записей, больший maxPageLimit
+// уменьшается до него. На нечисловое или отрицательное значение отвечает 400
+// и возвращает ok == false.
+func pageParams(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	if limit, ok = queryInt(w, r, "limit"); !ok {
+		return 0, 0, false
+	}
+	if offset, ok = queryInt(w, r, "offset"); !ok {
+		return 0, 0, false
+	}
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, offset, true
+}
+
+// queryInt возвращает неотрицательный параметр запроса name; отсутствующий
+// параметр равен нулю.
+func queryInt(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		http.Error(w, "Параметр "+name+" должен быть неотрицательным целым числом", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
@@ -2,9 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
+	"ozon_test/internal/moderation"
 	"ozon_test/internal/services"
+	"ozon_test/internal/storage"
 )
 
 type PostHandler struct {
@@ -15,33 +19,76 @@ func NewPostHandler(service *services.PostService) *PostHandler {
 	return &PostHandler{service: service}
 }
 
+// CreatePost создаёт пост от имени пользователя запроса; анонимные
+// посты не принимаются.
 func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
+	author, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
 	var req struct {
-		Title  string `json:"title"`
-		Text   string `json:"text"`
-		Author string `json:"author"`
+		Title string `json:"title"`
+		Text  string `json:"text"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Неверный запрос", http.StatusBadRequest)
 		return
 	}
-	post, err := h.service.CreatePost(req.Title, req.Text, req.Author)
+	post, err := h.service.CreatePost(req.Title, req.Text, author)
+	if errors.Is(err, moderation.ErrRejected) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Не удалось создать пост", http.StatusInternalServerError)
 		return
 	}
+	body, err := encodeJSON(post)
+	if err != nil {
+		http.Error(w, "Не удалось сформировать ответ", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(post)
+	w.Header().Set("ETag", itemETag(post.Version, body))
+	w.Write(body)
+}
+
+// GetPost возвращает пост с его версией в заголовке ETag: его нужно
+// передать в If-Match при изменении поста.
+func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Неверный ID поста", http.StatusBadRequest)
+		return
+	}
+	post, err := h.service.GetPost(id, viewer(r))
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Пост не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Не удалось получить пост", http.StatusInternalServerError)
+		return
+	}
+	writeCacheable(w, r, post, post.UpdatedAt, func(body []byte) string {
+		return itemETag(post.Version, body)
+	})
 }
 
 func (h *PostHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
-	posts, err := h.service.GetAllPosts()
+	// Время изменения читается до постов: изменение между запросами
+	// даст клиенту более раннее время и лишнюю загрузку, но не 304
+	lastModified, err := h.service.LastModified()
 	if err != nil {
 		http.Error(w, "Не удалось получить посты", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	posts, err := h.service.GetVisiblePosts(viewer(r))
+	if err != nil {
+		http.Error(w, "Не удалось получить посты", http.StatusInternalServerError)
+		return
+	}
+	writeCacheableList(w, r, posts, lastModified)
 }
 
 func (h *PostHandler) DisableComments(w http.ResponseWriter, r *http.Request) {
@@ -52,9 +99,21 @@ func (h *PostHandler) DisableComments(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Неверный запрос", http.StatusBadRequest)
 		return
 	}
-	if err := h.service.DisableComments(req.PostID); err != nil {
-		http.Error(w, "Не удалось отключить комментарии", http.StatusInternalServerError)
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		http.Error(w, "Требуется заголовок If-Match с версией поста", http.StatusPreconditionRequired)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	post, err := h.service.DisableComments(req.PostID, version)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Пост не найден", http.StatusNotFound)
+	case errors.Is(err, storage.ErrVersionConflict):
+		http.Error(w, "Пост изменён другим запросом, получите его заново", http.StatusPreconditionFailed)
+	case err != nil:
+		http.Error(w, "Не удалось отключить комментарии", http.StatusInternalServerError)
+	default:
+		w.Header().Set("ETag", versionETag(post.Version))
+		w.WriteHeader(http.StatusOK)
+	}
 }
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ozon_test/config"
+	"ozon_test/internal/ratelimit"
+)
+
+// RateLimiter ограничивает частоту запросов корзинами токенов: отдельной
+// для чтения и для записи у каждого пользователя, а для анонимных запросов —
+// у каждого IP. Запросы с неверным токеном ограничиваются по IP корзиной
+// записи, общей для всех методов, чтобы токен нельзя было подбирать
+// без ограничений. Должен стоять перед Authenticate: пользователя он
+// определяет по токену сам, а неверный токен Authenticate отклоняет.
+type RateLimiter struct {
+	store        ratelimit.Store
+	read         ratelimit.Limit
+	write        ratelimit.Limit
+	users        []config.User
+	realIPHeader string
+}
+
+func NewRateLimiter(store ratelimit.Store, cfg *config.Config) *RateLimiter {
+	return &RateLimiter{
+		store:        store,
+		read:         ratelimit.Limit{Rate: cfg.RateLimit.Read.Rate, Burst: cfg.RateLimit.Read.Burst},
+		write:        ratelimit.Limit{Rate: cfg.RateLimit.Write.Rate, Burst: cfg.RateLimit.Write.Burst},
+		users:        cfg.Auth.Users,
+		realIPHeader: cfg.RateLimit.RealIPHeader,
+	}
+}
+
+// clientKey возвращает ключ клиента: пользователя или IP для анонимного
+// запроса. realIPHeader — заголовок с адресом от доверенного прокси.
+func clientKey(r *http.Request, realIPHeader string) string {
+	if user, ok := UserFromContext(r.Context()); ok {
+		return "user:" + user
+	}
+	return ipKey(r, realIPHeader)
+}
+
+// ipKey возвращает ключ IP-адреса клиента.
+func ipKey(r *http.Request, realIPHeader string) string {
+	if realIPHeader != "" {
+		if ip := strings.TrimSpace(r.Header.Get(realIPHeader)); ip != "" {
+			return "ip:" + ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// seconds округляет d вверх до целых секунд, как требуют заголовки.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, class := l.write, "write:"
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			limit, class = l.read, "read:"
+		}
+		key := ipKey(r, l.realIPHeader)
+		if header := r.Header.Get("Authorization"); header != "" {
+			if user, ok := findUser(l.users, header); ok {
+				key = "user:" + user.Name
+			} else {
+				limit, class = l.write, "auth:"
+			}
+		}
+		result := l.store.Take(class+key, limit)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("X-RateLimit-Reset", seconds(result.Reset))
+		if !result.Allowed {
+			w.Header().Set("Retry-After", seconds(result.RetryAfter))
+			http.Error(w, "Слишком много запросов", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
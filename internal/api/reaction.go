@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"ozon_test/internal/services"
+	"ozon_test/internal/storage"
+)
+
+type ReactionHandler struct {
+	service *services.ReactionService
+}
+
+func NewReactionHandler(service *services.ReactionService) *ReactionHandler {
+	return &ReactionHandler{service: service}
+}
+
+type reactionRequest struct {
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	Kind       string `json:"kind"`
+}
+
+// AddReaction ставит реакцию от имени пользователя запроса; анонимные
+// реакции не принимаются.
+func (h *ReactionHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	author, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный запрос", http.StatusBadRequest)
+		return
+	}
+	reaction, err := h.service.AddReaction(req.TargetType, req.TargetID, author, req.Kind)
+	if err != nil {
+		writeReactionError(w, err, "Не удалось поставить реакцию")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reaction)
+}
+
+func (h *ReactionHandler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	author, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный запрос", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.RemoveReaction(req.TargetType, req.TargetID, author); err != nil {
+		writeReactionError(w, err, "Не удалось снять реакцию")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeReactionError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReactionKind), errors.Is(err, services.ErrInvalidReactionTarget),
+		errors.Is(err, services.ErrEmptyReactionAuthor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, message+": цель или реакция не найдена", http.StatusNotFound)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
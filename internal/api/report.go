@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"ozon_test/internal/services"
+	"ozon_test/internal/storage"
+)
+
+type ReportHandler struct {
+	service *services.ReportService
+}
+
+func NewReportHandler(service *services.ReportService) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+// CreateReport принимает жалобу от пользователя запроса: анонимные
+// жалобы не принимаются, иначе их нельзя было бы считать по авторам.
+func (h *ReportHandler) CreateReport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type   string `json:"type"`
+		ID     int    `json:"id"`
+		Reason string `json:"reason"`
+		Text   string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный запрос", http.StatusBadRequest)
+		return
+	}
+	report, err := h.service.Report(viewer(r), req.Type, req.ID, req.Reason, req.Text)
+	switch {
+	case errors.Is(err, services.ErrEmptyReporter):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, services.ErrInvalidReportTarget), errors.Is(err, services.ErrInvalidReportReason),
+		errors.Is(err, services.ErrReportTextTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Запись не найдена", http.StatusNotFound)
+	case errors.Is(err, storage.ErrDuplicateReport):
+		http.Error(w, "Жалоба на эту запись уже отправлена", http.StatusConflict)
+	case err != nil:
+		http.Error(w, "Не удалось отправить жалобу", http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func (h *ReportHandler) GetReports(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	reports, err := h.service.OpenReports(limit, offset)
+	if err != nil {
+		http.Error(w, "Не удалось получить жалобы", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// Resolve закрывает все открытые жалобы на запись решением модератора.
+func (h *ReportHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type       string `json:"type"`
+		ID         int    `json:"id"`
+		Resolution string `json:"resolution"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный запрос", http.StatusBadRequest)
+		return
+	}
+	resolved, err := h.service.Resolve(viewer(r), req.Type, req.ID, req.Resolution)
+	switch {
+	case errors.Is(err, services.ErrInvalidReportTarget), errors.Is(err, services.ErrInvalidReportResolution):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Открытые жалобы на запись не найдены", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "Не удалось закрыть жалобы", http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"resolved": resolved})
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Представления списков. NDJSON — по записи JSON на строку. Списки
+// ограничены страницей и уже загружены в память, поэтому все представления
+// кодируются целиком и получают ETag от тела; потоком отдаётся только
+// выгрузка (см. ExportHandler).
+const (
+	mediaJSON    = "application/json"
+	mediaNDJSON  = "application/x-ndjson"
+	mediaMsgpack = "application/msgpack"
+)
+
+// listMediaTypes — представления списков; первое используется, если
+// клиент не прислал Accept.
+var listMediaTypes = []string{mediaJSON, mediaNDJSON, mediaMsgpack}
+
+// listMediaType выбирает представление списка по заголовку Accept. Если
+// ни одно не подходит, отвечает 406 и возвращает ok == false.
+func listMediaType(w http.ResponseWriter, r *http.Request) (mediaType string, ok bool) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok = negotiate(r.Header.Get("Accept"), listMediaTypes, matchMediaType)
+	if !ok {
+		http.Error(w, "Доступные представления: "+strings.Join(listMediaTypes, ", "), http.StatusNotAcceptable)
+	}
+	return mediaType, ok
+}
+
+// writeList отвечает списком items (срезом) в представлении из Accept.
+func writeList(w http.ResponseWriter, r *http.Request, items interface{}) {
+	mediaType, ok := listMediaType(w, r)
+	if !ok {
+		return
+	}
+	body, err := encodeAs(mediaType, items)
+	if err != nil {
+		http.Error(w, "Не удалось сформировать ответ", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Write(body)
+}
+
+// encodeAs кодирует v в JSON, NDJSON (v — срез) или MessagePack.
+func encodeAs(mediaType string, v interface{}) ([]byte, error) {
+	switch mediaType {
+	case mediaMsgpack:
+		return encodeMsgpack(v)
+	case mediaNDJSON:
+		return encodeNDJSON(v)
+	}
+	return encodeJSON(v)
+}
+
+// encodeMsgpack кодирует v в MessagePack с теми же именами полей, что и в
+// JSON; время передаётся расширением timestamp.
+func encodeMsgpack(v interface{}) ([]byte, error) {
+	var body bytes.Buffer
+	encoder := msgpack.NewEncoder(&body)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// encodeNDJSON кодирует записи items (среза) по одной на строку.
+func encodeNDJSON(items interface{}) ([]byte, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	list := reflect.ValueOf(items)
+	for i := 0; i < list.Len(); i++ {
+		if err := encoder.Encode(list.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return body.Bytes(), nil
+}
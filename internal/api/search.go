@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"ozon_test/internal/services"
+)
+
+type SearchHandler struct {
+	service *services.SearchService
+}
+
+func NewSearchHandler(service *services.SearchService) *SearchHandler {
+	return &SearchHandler{service: service}
+}
+
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	results, err := h.service.Search(r.URL.Query().Get("q"), limit, offset)
+	if errors.Is(err, services.ErrEmptySearchQuery) || errors.Is(err, services.ErrSearchQueryTooLong) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Не удалось выполнить поиск", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, results)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// StatsHandler отдаёт в JSON метрики компонентов приложения (пула подключений, кэша и т.п.).
+type StatsHandler struct {
+	sources map[string]func() interface{}
+}
+
+func NewStatsHandler() *StatsHandler {
+	return &StatsHandler{sources: make(map[string]func() interface{})}
+}
+
+// Register добавляет источник метрик под именем name. Вызывается до запуска сервера.
+func (h *StatsHandler) Register(name string, source func() interface{}) {
+	h.sources[name] = source
+}
+
+func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats := make(map[string]interface{}, len(h.sources))
+	for name, source := range h.sources {
+		stats[name] = source()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
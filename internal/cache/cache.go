@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache — хранилище байтовых значений с ограниченным временем жизни.
+// Интерфейс намеренно повторяет возможности внешних кэшей (Redis, memcached),
+// чтобы локальную реализацию можно было заменить без изменения вызывающего кода.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	// Set сохраняет значение на ttl; нулевой ttl означает бессрочное хранение.
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// LRU — локальный кэш, вытесняющий давно не использованные записи,
+// когда их число превышает размер.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewLRU(size int) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+func (c *LRU) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return e.value, true
+}
+
+func (c *LRU) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		e := elem.Value.(*entry)
+		e.value, e.expiresAt = value, expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// Len возвращает число записей, включая ещё не удалённые просроченные.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*entry).key)
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	c.Get("a")
+	c.Set("c", []byte("3"), 0)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Запись b должна быть вытеснена")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Запись %s должна остаться в кэше", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Ожидалось 2 записи, получено %d", c.Len())
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+	c.Set("short", []byte("1"), time.Second)
+	c.Set("forever", []byte("2"), 0)
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Error("Просроченная запись не должна возвращаться")
+	}
+	if value, ok := c.Get("forever"); !ok || string(value) != "2" {
+		t.Errorf("Ожидалось бессрочное значение 2, получено %q", value)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Просроченная запись должна быть удалена, записей %d", c.Len())
+	}
+}
+
+func TestLRUDeleteAndOverwrite(t *testing.T) {
+	c := NewLRU(10)
+	c.Set("key", []byte("old"), 0)
+	c.Set("key", []byte("new"), 0)
+	if value, _ := c.Get("key"); string(value) != "new" {
+		t.Errorf("Ожидалось значение new, получено %q", value)
+	}
+	c.Delete("key")
+	if _, ok := c.Get("key"); ok {
+		t.Error("Удалённая запись не должна возвращаться")
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Activity — событие активности по посту: новый комментарий или реакция
+// на пост либо его комментарий. Из таких событий складывается горячая лента.
+type Activity struct {
+	PostID int
+	// Вид реакции; пустой, если событие — комментарий
+	Reaction  string
+	CreatedAt time.Time
+}
+
+// HotPost — пост горячей ленты с его текущей оценкой.
+type HotPost struct {
+	Post
+	Score float64
+}
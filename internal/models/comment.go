@@ -9,4 +9,15 @@ type Comment struct {
 	Text            string
 	Author          string
 	CreatedAt       time.Time
+	// Решение модерации при создании (пусто, mask или hold) и его причина
+	ModerationAction string
+	ModerationReason string
+	// Статус модерации: pending, approved или rejected
+	Status string
+	// Версия записи: 1 при создании, растёт при каждом изменении
+	Version int
+	// Время последнего изменения записи, в том числе её реакций
+	UpdatedAt time.Time
+	// Число реакций каждого вида, заполняется при чтении
+	Reactions map[string]int
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyRecord — запрос с заголовком Idempotency-Key и ответ на него.
+// Повтор запроса с тем же ключом получает сохранённый ответ.
+type IdempotencyRecord struct {
+	// Пользователь или IP анонимного клиента: ключи разных клиентов не пересекаются
+	Owner string
+	Key   string
+	// SHA-256 метода, пути и тела запроса
+	RequestHash string
+	// Код ответа; ноль — запрос ещё выполняется
+	StatusCode  int
+	ContentType string
+	// Прочие заголовки ответа, которые получает повтор (ETag, Location и т. п.)
+	Headers   map[string]string
+	Body      []byte
+	CreatedAt time.Time
+}
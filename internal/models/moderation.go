@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Статусы модерации постов и комментариев. Всем, кроме автора,
+// видны только одобренные.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+const (
+	ModerationTargetPost    = "post"
+	ModerationTargetComment = "comment"
+)
+
+// ModerationItem — пост или комментарий в очереди модерации.
+// Title пуст у комментария, PostID у поста совпадает с ID.
+type ModerationItem struct {
+	Type             string
+	ID               int
+	PostID           int
+	Title            string
+	Text             string
+	Author           string
+	CreatedAt        time.Time
+	ModerationAction string
+	ModerationReason string
+}
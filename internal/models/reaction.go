@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+
+	ReactionUpvote   = "upvote"
+	ReactionDownvote = "downvote"
+)
+
+// Reaction — реакция пользователя на пост или комментарий: голос
+// (upvote, downvote) или эмодзи из настроенного набора. У автора может быть
+// только одна реакция на каждую цель, новая заменяет прежнюю.
+type Reaction struct {
+	TargetType string
+	TargetID   int
+	// Пост, к которому относится цель; для поста совпадает с TargetID
+	PostID int
+	Author string
+	Kind   string
+	// Время установки реакции; у снятой реакции — время снятия
+	CreatedAt time.Time
+}
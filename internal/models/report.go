@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+
+	ReportReasonSpam     = "spam"
+	ReportReasonAbuse    = "abuse"
+	ReportReasonOfftopic = "offtopic"
+	ReportReasonOther    = "other"
+
+	// Решения модератора по жалобам: оставить цель или убрать её
+	ReportDismiss = "dismiss"
+	ReportRemove  = "remove"
+)
+
+// Report — жалоба читателя на пост или комментарий. Пользователь может
+// пожаловаться на каждую цель только один раз.
+type Report struct {
+	TargetType string
+	TargetID   int
+	// Пост, к которому относится цель; для поста совпадает с TargetID
+	PostID    int
+	Reporter  string
+	Reason    string
+	Text      string
+	CreatedAt time.Time
+	// Жалоба довела число открытых жалоб до порога и скрыла цель
+	HidTarget bool
+	// Решение модератора; пусто у открытой жалобы
+	Resolution string
+	ResolvedBy string
+}
@@ -0,0 +1,16 @@
+package models
+
+const (
+	SearchResultPost    = "post"
+	SearchResultComment = "comment"
+)
+
+// SearchResult — пост или комментарий, найденный полнотекстовым поиском.
+// Snippet содержит фрагмент текста, где совпавшие слова обёрнуты в <b></b>.
+type SearchResult struct {
+	Type    string
+	ID      int
+	PostID  int
+	Rank    float64
+	Snippet string
+}
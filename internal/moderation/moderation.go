@@ -0,0 +1,169 @@
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"ozon_test/config"
+)
+
+// Action — решение модерации. Действия упорядочены по строгости:
+// итоговое решение цепочки — самое строгое из решений её правил.
+type Action string
+
+const (
+	// ActionAllow — текст сохраняется без изменений.
+	ActionAllow Action = ""
+	// ActionMask — нарушающие фрагменты заменяются звёздочками.
+	ActionMask Action = "mask"
+	// ActionHold — текст сохраняется, но требует проверки модератором.
+	ActionHold Action = "hold"
+	// ActionReject — текст не сохраняется.
+	ActionReject Action = "reject"
+)
+
+var ErrRejected = errors.New("текст отклонён модерацией")
+
+func (a Action) severity() int {
+	switch a {
+	case ActionMask:
+		return 1
+	case ActionHold:
+		return 2
+	case ActionReject:
+		return 3
+	}
+	return 0
+}
+
+// ParseAction разбирает действие из конфигурации; allow там не нужен.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case ActionMask, ActionHold, ActionReject:
+		return a, nil
+	}
+	return "", fmt.Errorf("неизвестное действие модерации %q", s)
+}
+
+// Verdict — решение одного правила по одному тексту.
+type Verdict struct {
+	Action Action
+	Reason string
+	// Текст с замаскированными фрагментами; заполняется при ActionMask
+	Text string
+}
+
+// Rule — правило модерации.
+type Rule interface {
+	Check(text string) Verdict
+}
+
+// Decision — итог проверки поста или комментария цепочкой правил.
+// Title и Text содержат текст после маскирования.
+type Decision struct {
+	Action Action
+	Reason string
+	Title  string
+	Text   string
+}
+
+// Chain применяет правила по порядку к каждому полю текста. Маскирование
+// правила видят следующие правила; отклонение прекращает проверку.
+// Нулевая цепочка пропускает любой текст.
+type Chain struct {
+	rules []Rule
+}
+
+func NewChain(rules ...Rule) *Chain {
+	return &Chain{rules: rules}
+}
+
+// NewChainFromConfig собирает цепочку из правил секции moderation:
+// запрещённые слова, ограничение ссылок и регулярные выражения.
+func NewChainFromConfig(cfg *config.Config) (*Chain, error) {
+	mc := cfg.Moderation
+	var rules []Rule
+	if len(mc.BannedWords.Words) > 0 {
+		action, err := ParseAction(mc.BannedWords.Action)
+		if err != nil {
+			return nil, fmt.Errorf("moderation.banned_words: %w", err)
+		}
+		rules = append(rules, NewBannedWords(mc.BannedWords.Words, action))
+	}
+	if mc.Links.Max >= 0 {
+		action, err := ParseAction(mc.Links.Action)
+		if err != nil {
+			return nil, fmt.Errorf("moderation.links: %w", err)
+		}
+		rules = append(rules, NewLinkLimit(mc.Links.Max, action))
+	}
+	for _, rc := range mc.Rules {
+		action, err := ParseAction(rc.Action)
+		if err != nil {
+			return nil, fmt.Errorf("moderation.rules %q: %w", rc.Name, err)
+		}
+		re, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("moderation.rules %q: %w", rc.Name, err)
+		}
+		rules = append(rules, NewPattern(rc.Name, re, action))
+	}
+	return NewChain(rules...), nil
+}
+
+// Moderate проверяет заголовок (пустой у комментария) и текст.
+func (c *Chain) Moderate(title, text string) Decision {
+	decision := Decision{Title: title, Text: text}
+	if c == nil {
+		return decision
+	}
+	var reasons []string
+	for _, field := range []*string{&decision.Title, &decision.Text} {
+		if *field == "" {
+			continue
+		}
+		for _, rule := range c.rules {
+			verdict := rule.Check(*field)
+			if verdict.Action == ActionAllow {
+				continue
+			}
+			if verdict.Action == ActionMask {
+				*field = verdict.Text
+			}
+			if verdict.Action.severity() > decision.Action.severity() {
+				decision.Action = verdict.Action
+			}
+			if !slices.Contains(reasons, verdict.Reason) {
+				reasons = append(reasons, verdict.Reason)
+			}
+			if verdict.Action == ActionReject {
+				decision.Reason = strings.Join(reasons, "; ")
+				return decision
+			}
+		}
+	}
+	decision.Reason = strings.Join(reasons, "; ")
+	return decision
+}
+
+// maskRunes заменяет звёздочками непробельные руны runes[start:end).
+func maskRunes(runes []rune, start, end int) {
+	for i := start; i < end; i++ {
+		if !unicode.IsSpace(runes[i]) {
+			runes[i] = '*'
+		}
+	}
+}
+
+// maskMatches заменяет звёздочками фрагменты, найденные re.
+func maskMatches(re *regexp.Regexp, text string) string {
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		runes := []rune(match)
+		maskRunes(runes, 0, len(runes))
+		return string(runes)
+	})
+}
@@ -0,0 +1,89 @@
+package moderation
+
+import (
+	"regexp"
+	"testing"
+
+	"ozon_test/config"
+)
+
+func TestBannedWordsHomoglyphs(t *testing.T) {
+	rule := NewBannedWords([]string{"спам", "дурак*"}, ActionMask)
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Латинские c, a и цифра 0 вместо кириллических букв
+		{"Это cпaм!", "Это ****!"},
+		{"СПАМ и спамер", "**** и спамер"},
+		{"Сами вы дураки, и дуrак", "Сами вы ******, и дуrак"},
+		{"Д0РАК? нет, дурак", "Д0РАК? нет, *****"},
+		{"Нормальный текст", "Нормальный текст"},
+	}
+	for _, tt := range tests {
+		verdict := rule.Check(tt.text)
+		got := tt.text
+		if verdict.Action == ActionMask {
+			got = verdict.Text
+		}
+		if got != tt.want {
+			t.Errorf("%q: ожидалось %q, получено %q", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestLinkLimitMasksExcess(t *testing.T) {
+	rule := NewLinkLimit(1, ActionMask)
+	verdict := rule.Check("см. https://a.ru и www.b.ru")
+	if verdict.Action != ActionMask || verdict.Text != "см. https://a.ru и ********" {
+		t.Errorf("Ожидалось скрытие второй ссылки, получено %+v", verdict)
+	}
+	if verdict := rule.Check("только https://a.ru"); verdict.Action != ActionAllow {
+		t.Errorf("Ссылка в пределах лимита не должна срабатывать, получено %+v", verdict)
+	}
+}
+
+func TestChainTakesStrictestAction(t *testing.T) {
+	chain := NewChain(
+		NewBannedWords([]string{"спам"}, ActionMask),
+		NewPattern("phone", regexp.MustCompile(`\+7\d{10}`), ActionHold),
+	)
+	decision := chain.Moderate("Спам", "звоните +79001234567, это спам")
+	if decision.Action != ActionHold || decision.Reason != "запрещённые слова; правило phone" {
+		t.Errorf("Ожидалось hold с двумя причинами, получено %+v", decision)
+	}
+	if decision.Title != "****" || decision.Text != "звоните +79001234567, это ****" {
+		t.Errorf("Ожидалось маскирование только запрещённых слов, получено %q, %q", decision.Title, decision.Text)
+	}
+
+	reject := NewChain(NewPattern("casino", regexp.MustCompile(`(?i)казино`), ActionReject), NewLinkLimit(0, ActionHold))
+	if decision := reject.Moderate("", "Казино http://x.ru"); decision.Action != ActionReject || decision.Reason != "правило casino" {
+		t.Errorf("Ожидалось отклонение без дальнейших проверок, получено %+v", decision)
+	}
+
+	var nilChain *Chain
+	if decision := nilChain.Moderate("a", "b"); decision.Action != ActionAllow || decision.Text != "b" {
+		t.Errorf("Пустая цепочка должна пропускать текст, получено %+v", decision)
+	}
+}
+
+func TestNewChainFromConfig(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Moderation.Links.Max = -1
+	cfg.Moderation.Rules = []config.ModerationRule{{Name: "bad", Pattern: "(", Action: "reject"}}
+	if _, err := NewChainFromConfig(cfg); err == nil {
+		t.Error("Ожидалась ошибка неверного регулярного выражения")
+	}
+	cfg.Moderation.Rules = []config.ModerationRule{{Name: "bad", Pattern: "x", Action: "ban"}}
+	if _, err := NewChainFromConfig(cfg); err == nil {
+		t.Error("Ожидалась ошибка неизвестного действия")
+	}
+	cfg.Moderation.Rules[0].Action = "hold"
+	chain, err := NewChainFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision := chain.Moderate("", "x"); decision.Action != ActionHold {
+		t.Errorf("Ожидалось hold, получено %+v", decision)
+	}
+}
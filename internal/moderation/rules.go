@@ -0,0 +1,140 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// homoglyphs сводит кириллические буквы к похожим латинским, чтобы слово,
+// набранное смесью алфавитов («cпaм» с латинскими c и a), совпадало
+// с запрещённым «спам». Цифра 0 часто заменяет букву o.
+var homoglyphs = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	'і': 'i', 'ј': 'j', '0': 'o',
+}
+
+// Normalize приводит слово к нижнему регистру и заменяет похожие буквы одним написанием.
+func Normalize(word string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if mapped, ok := homoglyphs[r]; ok {
+			return mapped
+		}
+		return r
+	}, word)
+}
+
+// BannedWords находит запрещённые слова. Слово в списке, оканчивающееся
+// на «*», запрещает все слова с этой основой: «дурак*» находит и «дураки».
+type BannedWords struct {
+	exact    map[string]bool
+	prefixes []string
+	action   Action
+}
+
+func NewBannedWords(words []string, action Action) *BannedWords {
+	b := &BannedWords{exact: make(map[string]bool), action: action}
+	for _, word := range words {
+		if stem, ok := strings.CutSuffix(word, "*"); ok {
+			b.prefixes = append(b.prefixes, Normalize(stem))
+		} else {
+			b.exact[Normalize(word)] = true
+		}
+	}
+	return b
+}
+
+func (b *BannedWords) banned(word string) bool {
+	word = Normalize(word)
+	if b.exact[word] {
+		return true
+	}
+	for _, prefix := range b.prefixes {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (b *BannedWords) Check(text string) Verdict {
+	runes := []rune(text)
+	found := 0
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if b.banned(string(runes[start:end])) {
+			found++
+			maskRunes(runes, start, end)
+		}
+		start = end
+	}
+	if found == 0 {
+		return Verdict{}
+	}
+	return Verdict{Action: b.action, Reason: "запрещённые слова", Text: string(runes)}
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkLimit ограничивает число ссылок в тексте. При маскировании
+// скрываются только ссылки сверх лимита.
+type LinkLimit struct {
+	max    int
+	action Action
+}
+
+func NewLinkLimit(max int, action Action) *LinkLimit {
+	return &LinkLimit{max: max, action: action}
+}
+
+func (l *LinkLimit) Check(text string) Verdict {
+	links := linkPattern.FindAllStringIndex(text, -1)
+	if len(links) <= l.max {
+		return Verdict{}
+	}
+	var masked strings.Builder
+	last := 0
+	for _, link := range links[l.max:] {
+		masked.WriteString(text[last:link[0]])
+		masked.WriteString(maskMatches(linkPattern, text[link[0]:link[1]]))
+		last = link[1]
+	}
+	masked.WriteString(text[last:])
+	return Verdict{
+		Action: l.action,
+		Reason: fmt.Sprintf("ссылок больше %d", l.max),
+		Text:   masked.String(),
+	}
+}
+
+// Pattern срабатывает на текст, в котором есть совпадение с регулярным выражением.
+type Pattern struct {
+	name   string
+	re     *regexp.Regexp
+	action Action
+}
+
+func NewPattern(name string, re *regexp.Regexp, action Action) *Pattern {
+	return &Pattern{name: name, re: re, action: action}
+}
+
+func (p *Pattern) Check(text string) Verdict {
+	if !p.re.MatchString(text) {
+		return Verdict{}
+	}
+	return Verdict{Action: p.action, Reason: "правило " + p.name, Text: maskMatches(p.re, text)}
+}
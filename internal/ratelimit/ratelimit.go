@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit — параметры корзины токенов: Rate токенов в секунду, не больше Burst
+// одновременно. Полная корзина позволяет выполнить Burst запросов подряд.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result — итог попытки забрать токен.
+type Result struct {
+	Allowed bool
+	// Оставшиеся целые токены после попытки
+	Remaining int
+	// Через сколько появится следующий токен; ноль, если токены есть
+	RetryAfter time.Duration
+	// Через сколько корзина снова заполнится целиком
+	Reset time.Duration
+}
+
+// Store хранит корзины токенов по ключам. Интерфейс позволяет заменить
+// локальное хранилище общим (например, Redis), чтобы лимиты действовали
+// на все экземпляры сервиса.
+type Store interface {
+	// Take забирает токен из корзины key, создавая полную корзину при первом обращении.
+	Take(key string, limit Limit) Result
+}
+
+// MemoryStore хранит корзины в памяти процесса. Заполненные корзины
+// удаляются при периодической очистке: они неотличимы от новых.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// refill начисляет токены, накопившиеся с прошлого обращения.
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.updated = now
+	}
+}
+
+// after возвращает время, за которое накопится n токенов.
+func (b *bucket) after(n float64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	if b.limit.Rate <= 0 {
+		return math.MaxInt64
+	}
+	return time.Duration(math.Ceil(n / b.limit.Rate * float64(time.Second)))
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	result := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = b.after(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = b.after(float64(limit.Burst) - b.tokens)
+	return result
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// Len возвращает число хранимых корзин.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
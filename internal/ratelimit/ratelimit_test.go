@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreBurstAndRefill(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if r := s.Take("alice", limit); !r.Allowed || r.Remaining != 2-i {
+			t.Fatalf("Запрос %d: ожидался пропуск с остатком %d, получено %+v", i, 2-i, r)
+		}
+	}
+	r := s.Take("alice", limit)
+	if r.Allowed || r.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Ожидался отказ с ожиданием 500ms, получено %+v", r)
+	}
+	if r.Reset != 1500*time.Millisecond {
+		t.Errorf("Ожидалось заполнение через 1.5s, получено %v", r.Reset)
+	}
+	if r := s.Take("bob", limit); !r.Allowed {
+		t.Error("Корзины разных ключей не должны зависеть друг от друга")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if r := s.Take("alice", limit); !r.Allowed || r.Remaining != 0 {
+		t.Errorf("Ожидался пропуск после пополнения, получено %+v", r)
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	s.Take("idle", Limit{Rate: 1, Burst: 1})
+	s.Take("busy", Limit{Rate: 0.001, Burst: 1})
+
+	now = now.Add(2 * sweepInterval)
+	s.Take("other", Limit{Rate: 1, Burst: 1})
+	if s.Len() != 2 {
+		t.Errorf("Ожидалось удаление заполненной корзины, корзин %d", s.Len())
+	}
+}
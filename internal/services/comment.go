@@ -2,41 +2,81 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"ozon_test/internal/models"
+	"ozon_test/internal/moderation"
+	"ozon_test/internal/spam"
 	"ozon_test/internal/storage"
 )
 
 type CommentService struct {
-	storage     storage.CommentStorage
-	postStorage storage.PostStorage
+	posts      storage.PostStorage
+	storage    storage.CommentStorage
+	txManager  storage.TxManager
+	moderation *moderation.Chain
+	spam       *spam.Detector
 }
 
-func NewCommentService(storage storage.CommentStorage, postStorage storage.PostStorage) *CommentService {
-	return &CommentService{storage: storage, postStorage: postStorage}
+func NewCommentService(posts storage.PostStorage, storage storage.CommentStorage, txManager storage.TxManager) *CommentService {
+	return &CommentService{posts: posts, storage: storage, txManager: txManager}
 }
 
-func (s *CommentService) CreateComment(postID int, parentCommentID *int, text, author string) (*models.Comment, error) {
+// SetModeration включает проверку новых комментариев цепочкой правил.
+func (s *CommentService) SetModeration(chain *moderation.Chain) {
+	s.moderation = chain
+}
+
+// SetSpamDetector включает отклонение повторов и серий комментариев одного автора.
+func (s *CommentService) SetSpamDetector(detector *spam.Detector) {
+	s.spam = detector
+}
+
+// CreateComment создаёт комментарий author (пустой для анонимного).
+// client — ключ клиента, по которому детектор спама ищет повторы и серии:
+// анонимные клиенты различаются по адресу, а не делят пустое имя автора.
+func (s *CommentService) CreateComment(postID int, parentCommentID *int, text, author, client string) (*models.Comment, error) {
 	if len(text) > 2000 {
 		return nil, errors.New("текст комментария превышает 2000 символов")
 	}
-	post, err := s.postStorage.GetPostByID(postID)
-	if err != nil {
-		return nil, err
+	decision := s.moderation.Moderate("", text)
+	if decision.Action == moderation.ActionReject {
+		return nil, fmt.Errorf("%w: %s", moderation.ErrRejected, decision.Reason)
 	}
-	if !post.AllowComments {
-		return nil, storage.ErrCommentsNotAllowed
+	verdict := s.spam.Reserve(client, postID, text)
+	if verdict.Err != nil {
+		log.Printf("Спам: комментарий %s к посту %d отклонён: %s", client, postID, verdict.Reason)
+		return nil, verdict.Err
 	}
 	comment := &models.Comment{
-		PostID:          postID,
-		ParentCommentID: parentCommentID,
-		Text:            text,
-		Author:          author,
-		CreatedAt:       time.Now(),
+		PostID:           postID,
+		ParentCommentID:  parentCommentID,
+		Text:             decision.Text,
+		Author:           author,
+		CreatedAt:        time.Now(),
+		ModerationAction: string(decision.Action),
+		ModerationReason: decision.Reason,
+		Status:           moderationStatus(decision),
 	}
-	err = s.storage.CreateComment(comment)
+	// Проверка и вставка в одной транзакции: отключение комментариев
+	// не может вклиниться между ними
+	err := s.txManager.WithinTx(func(tx storage.Tx) error {
+		post, err := tx.GetPostForShare(postID)
+		if err != nil {
+			return err
+		}
+		if !postVisible(post, author) {
+			return storage.ErrNotFound
+		}
+		if !post.AllowComments {
+			return storage.ErrCommentsNotAllowed
+		}
+		return tx.Comments().CreateComment(comment)
+	})
 	if err != nil {
+		s.spam.Release(client, verdict)
 		return nil, err
 	}
 	return comment, nil
@@ -45,3 +85,39 @@ func (s *CommentService) CreateComment(postID int, parentCommentID *int, text, a
 func (s *CommentService) GetCommentsByPostID(postID int, limit, offset int) ([]*models.Comment, error) {
 	return s.storage.GetCommentsByPostID(postID, limit, offset)
 }
+
+// GetVisibleComments возвращает одобренные комментарии поста
+// и неодобренные комментарии viewer. Если пост скрыт от viewer,
+// возвращает storage.ErrNotFound.
+func (s *CommentService) GetVisibleComments(postID int, viewer string, limit, offset int) ([]*models.Comment, error) {
+	if err := s.checkPost(postID, viewer); err != nil {
+		return nil, err
+	}
+	return s.storage.GetVisibleComments(postID, viewer, limit, offset)
+}
+
+// checkPost возвращает storage.ErrNotFound, если поста нет или он скрыт от viewer.
+func (s *CommentService) checkPost(postID int, viewer string) error {
+	post, err := s.posts.GetPostByID(postID)
+	if err != nil {
+		return err
+	}
+	if !postVisible(post, viewer) {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// LastModified возвращает время последнего изменения комментариев поста.
+func (s *CommentService) LastModified(postID int) (time.Time, error) {
+	return s.storage.LastModified(postID)
+}
+
+// GetCommentTree возвращает видимые viewer комментарии поста деревом, упорядочивая
+// каждую группу ответов по sort: new, old, top, controversial, hot или best.
+func (s *CommentService) GetCommentTree(postID int, viewer, sort string, limit, offset int) ([]*models.Comment, error) {
+	if err := s.checkPost(postID, viewer); err != nil {
+		return nil, err
+	}
+	return s.storage.GetCommentTree(postID, viewer, storage.CommentSort(sort), limit, offset)
+}
@@ -1,17 +1,23 @@
 package services
 
 import (
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"ozon_test/internal/moderation"
+	"ozon_test/internal/spam"
 	"ozon_test/internal/storage"
 )
 
 func TestCreateComment(t *testing.T) {
 	postStorage := storage.NewInMemoryPostStorage()
 	commentStorage := storage.NewInMemoryCommentStorage()
-	service := NewCommentService(commentStorage, postStorage)
-	post, _ := NewPostService(postStorage).CreatePost("Test", "Text", "Author")
-	comment, err := service.CreateComment(post.ID, nil, "Test comment", "User")
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	service := NewCommentService(postStorage, commentStorage, txManager)
+	post, _ := NewPostService(postStorage, txManager).CreatePost("Test", "Text", "Author")
+	comment, err := service.CreateComment(post.ID, nil, "Test comment", "User", "User")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -23,10 +29,11 @@ func TestCreateComment(t *testing.T) {
 func TestCreateCommentExceedsLimit(t *testing.T) {
 	postStorage := storage.NewInMemoryPostStorage()
 	commentStorage := storage.NewInMemoryCommentStorage()
-	service := NewCommentService(commentStorage, postStorage)
-	post, _ := NewPostService(postStorage).CreatePost("Test", "Text", "Author")
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	service := NewCommentService(postStorage, commentStorage, txManager)
+	post, _ := NewPostService(postStorage, txManager).CreatePost("Test", "Text", "Author")
 	longText := string(make([]byte, 2001))
-	_, err := service.CreateComment(post.ID, nil, longText, "User")
+	_, err := service.CreateComment(post.ID, nil, longText, "User", "User")
 	if err == nil {
 		t.Error("Ожидалась ошибка для текста, превышающего 2000 символов")
 	}
@@ -35,12 +42,118 @@ func TestCreateCommentExceedsLimit(t *testing.T) {
 func TestCreateCommentWhenCommentsDisabled(t *testing.T) {
 	postStorage := storage.NewInMemoryPostStorage()
 	commentStorage := storage.NewInMemoryCommentStorage()
-	postService := NewPostService(postStorage)
-	commentService := NewCommentService(commentStorage, postStorage)
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := NewPostService(postStorage, txManager)
+	commentService := NewCommentService(postStorage, commentStorage, txManager)
 	post, _ := postService.CreatePost("Test", "Text", "Author")
-	_ = postService.DisableComments(post.ID)
-	_, err := commentService.CreateComment(post.ID, nil, "Test comment", "User")
+	_, _ = postService.DisableComments(post.ID, AnyVersion)
+	_, err := commentService.CreateComment(post.ID, nil, "Test comment", "User", "User")
 	if err != storage.ErrCommentsNotAllowed {
 		t.Error("Ожидалась ошибка ErrCommentsNotAllowed")
 	}
 }
+
+// Запускается с -race: сервисы не должны разделять изменяемые модели с хранилищем.
+func TestConcurrentCommentsAndDisable(t *testing.T) {
+	postStorage := storage.NewInMemoryPostStorage()
+	commentStorage := storage.NewInMemoryCommentStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := NewPostService(postStorage, txManager)
+	commentService := NewCommentService(postStorage, commentStorage, txManager)
+	post, _ := postService.CreatePost("Test", "Text", "Author")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if _, err := postService.DisableComments(post.ID, AnyVersion); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := commentService.CreateComment(post.ID, nil, "Test comment", "User", "User")
+			if err != nil && err != storage.ErrCommentsNotAllowed {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			posts, err := postService.GetAllPosts()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, p := range posts {
+				_ = p.AllowComments
+			}
+		}()
+	}
+	wg.Wait()
+
+	updated, err := postStorage.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.AllowComments {
+		t.Error("Ожидалось, что комментарии будут отключены")
+	}
+}
+
+func TestCreateCommentSpam(t *testing.T) {
+	postStorage := storage.NewInMemoryPostStorage()
+	commentStorage := storage.NewInMemoryCommentStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	service := NewCommentService(postStorage, commentStorage, txManager)
+	service.SetSpamDetector(spam.NewDetector(spam.Config{DuplicateWindow: time.Hour, MaxDistance: 3, MinWords: 3}))
+	postService := NewPostService(postStorage, txManager)
+	first, _ := postService.CreatePost("First", "Text", "Author")
+	second, _ := postService.CreatePost("Second", "Text", "Author")
+
+	text := "Лучшие цены на телефоны только у нас"
+	// Несохранённый комментарий не считается образцом для повторов
+	if _, err := service.CreateComment(999, nil, text, "bot", "bot"); err == nil {
+		t.Fatal("Ожидалась ошибка для несуществующего поста")
+	}
+	if _, err := service.CreateComment(first.ID, nil, text, "bot", "bot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.CreateComment(second.ID, nil, text+"!", "bot", "bot"); !errors.Is(err, spam.ErrDuplicate) {
+		t.Errorf("Ожидалась ErrDuplicate, получено %v", err)
+	}
+	if page, _ := commentStorage.GetCommentsByPostID(second.ID, 10, 0); len(page) != 0 {
+		t.Errorf("Повтор не должен сохраняться, получено %d", len(page))
+	}
+}
+
+func TestCommentsOfHiddenPost(t *testing.T) {
+	postStorage := storage.NewInMemoryPostStorage()
+	commentStorage := storage.NewInMemoryCommentStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, commentStorage)
+	postService := NewPostService(postStorage, txManager)
+	postService.SetModeration(moderation.NewChain(moderation.NewLinkLimit(0, moderation.ActionHold)))
+	service := NewCommentService(postStorage, commentStorage, txManager)
+	post, err := postService.CreatePost("Test", "http://a.ru", "Author")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.CreateComment(post.ID, nil, "Comment", "User", "User"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Комментировать скрытый пост может только автор, получено %v", err)
+	}
+	if _, err := service.CreateComment(post.ID, nil, "Comment", "Author", "Author"); err != nil {
+		t.Fatal(err)
+	}
+	for _, viewer := range []string{"", "User"} {
+		if _, err := service.GetVisibleComments(post.ID, viewer, 10, 0); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Комментарии скрытого поста не должны быть видны %q, получено %v", viewer, err)
+		}
+		if _, err := service.GetCommentTree(post.ID, viewer, "old", 10, 0); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Дерево комментариев скрытого поста не должно быть видно %q, получено %v", viewer, err)
+		}
+	}
+	if page, err := service.GetVisibleComments(post.ID, "Author", 10, 0); err != nil || len(page) != 1 {
+		t.Errorf("Автор поста должен видеть комментарии, получено %d, %v", len(page), err)
+	}
+}
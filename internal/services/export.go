@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+var ErrInvalidExportTarget = errors.New("выгрузить можно только posts или comments")
+var ErrInvalidExportFormat = errors.New("неизвестный формат выгрузки: допустимы ndjson и csv")
+var ErrInvalidExportDate = errors.New("дата выгрузки должна быть в формате 2006-01-02 или RFC 3339")
+
+// Что выгружается
+const (
+	ExportPosts    = "posts"
+	ExportComments = "comments"
+)
+
+// Форматы выгрузки: запись JSON на строку или CSV со строкой заголовков
+const (
+	ExportNDJSON = "ndjson"
+	ExportCSV    = "csv"
+)
+
+// Колонки CSV. Счётчики реакций записываются объектом JSON.
+var exportColumns = map[string][]string{
+	ExportPosts: {"id", "title", "text", "allow_comments", "author", "created_at", "updated_at",
+		"status", "version", "moderation_action", "moderation_reason", "reactions"},
+	ExportComments: {"id", "post_id", "parent_comment_id", "text", "author", "created_at", "updated_at",
+		"status", "version", "moderation_action", "moderation_reason", "reactions"},
+}
+
+type ExportService struct {
+	storage storage.ExportStorage
+}
+
+func NewExportService(storage storage.ExportStorage) *ExportService {
+	return &ExportService{storage: storage}
+}
+
+// ParseExportDate разбирает границу выгрузки: дату (2006-01-02, полночь
+// UTC) или время в RFC 3339. Пустая строка означает отсутствие границы.
+func ParseExportDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidExportDate
+	}
+	return t, nil
+}
+
+// Export пишет в w посты или комментарии (target), отобранные filter, в
+// формате format по возрастанию ID и возвращает ID последней записанной
+// записи — курсор для продолжения выгрузки (filter.AfterID, если не записано
+// ничего). Неверные target и format возвращают ошибку до записи в w.
+func (s *ExportService) Export(w io.Writer, target, format string, filter storage.ExportFilter) (lastID int, err error) {
+	columns, ok := exportColumns[target]
+	if !ok {
+		return 0, ErrInvalidExportTarget
+	}
+	var write func(record interface{}, row func() []string) error
+	flush := func() error { return nil }
+	switch format {
+	case ExportNDJSON:
+		encoder := json.NewEncoder(w)
+		write = func(record interface{}, _ func() []string) error { return encoder.Encode(record) }
+	case ExportCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(columns)
+		write = func(_ interface{}, row func() []string) error { return writer.Write(row()) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		return 0, ErrInvalidExportFormat
+	}
+
+	lastID = filter.AfterID
+	if target == ExportPosts {
+		err = s.storage.EachPost(filter, func(post *models.Post) error {
+			if err := write(post, func() []string { return postRow(post) }); err != nil {
+				return err
+			}
+			lastID = post.ID
+			return nil
+		})
+	} else {
+		err = s.storage.EachComment(filter, func(comment *models.Comment) error {
+			if err := write(comment, func() []string { return commentRow(comment) }); err != nil {
+				return err
+			}
+			lastID = comment.ID
+			return nil
+		})
+	}
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	return lastID, err
+}
+
+func exportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func exportReactions(reactions map[string]int) string {
+	if len(reactions) == 0 {
+		return "{}"
+	}
+	encoded, _ := json.Marshal(reactions)
+	return string(encoded)
+}
+
+func postRow(post *models.Post) []string {
+	return []string{
+		strconv.Itoa(post.ID), post.Title, post.Text, strconv.FormatBool(post.AllowComments), post.Author,
+		exportTime(post.CreatedAt), exportTime(post.UpdatedAt), post.Status, strconv.Itoa(post.Version),
+		post.ModerationAction, post.ModerationReason, exportReactions(post.Reactions),
+	}
+}
+
+func commentRow(comment *models.Comment) []string {
+	parentID := ""
+	if comment.ParentCommentID != nil {
+		parentID = strconv.Itoa(*comment.ParentCommentID)
+	}
+	return []string{
+		strconv.Itoa(comment.ID), strconv.Itoa(comment.PostID), parentID, comment.Text, comment.Author,
+		exportTime(comment.CreatedAt), exportTime(comment.UpdatedAt), comment.Status, strconv.Itoa(comment.Version),
+		comment.ModerationAction, comment.ModerationReason, exportReactions(comment.Reactions),
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"ozon_test/config"
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+const (
+	// Оценка учитывает активность за столько периодов полураспада:
+	// более старая весит меньше 0,1%
+	feedHistoryHalfLives = 10
+	// Посты с меньшей оценкой в ленту не попадают
+	minHotScore = 0.001
+)
+
+// FeedService ведёт горячую ленту постов. Оценка поста — сумма весов его
+// комментариев и текущих реакций, каждый из которых уменьшается вдвое за
+// период полураспада. Оценки пересчитываются целиком по текущему состоянию
+// хранилища: снятая реакция перестаёт учитываться, а повторная реакция автора
+// не добавляет веса. Готовая лента хранится в памяти и отдаётся запросам
+// без обращения к хранилищу.
+type FeedService struct {
+	posts          storage.PostStorage
+	activity       storage.ActivityStorage
+	commentWeight  float64
+	reactionWeight float64
+	downvoteWeight float64
+	halfLife       time.Duration
+	size           int
+
+	// mu защищает оценки: обновления выполняются по одному
+	mu sync.Mutex
+	// Оценки постов на момент последнего обновления
+	scores map[int]float64
+
+	feedMu sync.RWMutex
+	feed   []*models.HotPost
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFeedService создаёт ленту и, если задан feed.refresh_interval,
+// запускает фоновое обновление; первое выполняется сразу.
+func NewFeedService(posts storage.PostStorage, activity storage.ActivityStorage, cfg *config.Config) *FeedService {
+	size := cfg.Feed.Size
+	if size < 1 {
+		size = 1
+	}
+	s := &FeedService{
+		posts:          posts,
+		activity:       activity,
+		commentWeight:  cfg.Feed.Weights.Comment,
+		reactionWeight: cfg.Feed.Weights.Reaction,
+		downvoteWeight: cfg.Feed.Weights.Downvote,
+		halfLife:       cfg.Feed.HalfLife,
+		size:           size,
+		scores:         make(map[int]float64),
+		feed:           []*models.HotPost{},
+		stop:           make(chan struct{}),
+	}
+	if interval := cfg.Feed.RefreshInterval; interval > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				if err := s.Refresh(time.Now()); err != nil {
+					log.Printf("Ошибка обновления горячей ленты: %v", err)
+				}
+				select {
+				case <-ticker.C:
+				case <-s.stop:
+					return
+				}
+			}
+		}()
+	}
+	return s
+}
+
+// Close останавливает фоновое обновление.
+func (s *FeedService) Close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// decay возвращает множитель затухания за время d. Нулевой период
+// полураспада отключает затухание.
+func (s *FeedService) decay(d time.Duration) float64 {
+	if s.halfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(d) / float64(s.halfLife))
+}
+
+func (s *FeedService) weight(a models.Activity) float64 {
+	switch a.Reaction {
+	case "":
+		return s.commentWeight
+	case models.ReactionDownvote:
+		return s.downvoteWeight
+	}
+	return s.reactionWeight
+}
+
+// Refresh пересчитывает оценки по активности за последние
+// feedHistoryHalfLives периодов полураспада (при нулевом периоде — за всё
+// время) и пересобирает ленту. При ошибке прежняя лента остаётся в силе.
+func (s *FeedService) Refresh(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var since time.Time
+	if s.halfLife > 0 {
+		since = now.Add(-feedHistoryHalfLives * s.halfLife)
+	}
+	activity, err := s.activity.GetActivity(since, now)
+	if err != nil {
+		return err
+	}
+	scores := make(map[int]float64)
+	for _, a := range activity {
+		scores[a.PostID] += s.weight(a) * s.decay(now.Sub(a.CreatedAt))
+	}
+	for id, score := range scores {
+		if math.Abs(score) < minHotScore {
+			delete(scores, id)
+		}
+	}
+	s.scores = scores
+	return s.rebuild()
+}
+
+// rebuild загружает посты с наибольшими оценками и заменяет ими ленту.
+// Вызывается под s.mu.
+func (s *FeedService) rebuild() error {
+	ids := make([]int, 0, len(s.scores))
+	for id, score := range s.scores {
+		if score > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if s.scores[ids[i]] != s.scores[ids[j]] {
+			return s.scores[ids[i]] > s.scores[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+
+	feed := make([]*models.HotPost, 0, s.size)
+	for _, id := range ids {
+		if len(feed) == s.size {
+			break
+		}
+		post, err := s.posts.GetPostByID(id)
+		if errors.Is(err, storage.ErrNotFound) {
+			delete(s.scores, id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Неодобренный пост вернётся в ленту после одобрения, при следующем пересчёте
+		if post.Status != models.StatusApproved {
+			continue
+		}
+		feed = append(feed, &models.HotPost{Post: *post, Score: s.scores[id]})
+	}
+
+	s.feedMu.Lock()
+	s.feed = feed
+	s.feedMu.Unlock()
+	return nil
+}
+
+// GetHotPosts возвращает страницу горячей ленты, собранной последним обновлением.
+func (s *FeedService) GetHotPosts(limit, offset int) []*models.HotPost {
+	s.feedMu.RLock()
+	defer s.feedMu.RUnlock()
+	if limit < 0 {
+		limit = 0
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(s.feed) {
+		offset = len(s.feed)
+	}
+	end := offset + limit
+	if end > len(s.feed) {
+		end = len(s.feed)
+	}
+	return append([]*models.HotPost{}, s.feed[offset:end]...)
+}
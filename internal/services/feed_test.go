@@ -0,0 +1,160 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"ozon_test/config"
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// fakeActivity отдаёт заданные события и запоминает запрошенные интервалы.
+type fakeActivity struct {
+	events  []models.Activity
+	windows [][2]time.Time
+}
+
+func (f *fakeActivity) GetActivity(since, until time.Time) ([]models.Activity, error) {
+	f.windows = append(f.windows, [2]time.Time{since, until})
+	var result []models.Activity
+	for _, a := range f.events {
+		if a.CreatedAt.After(since) && !a.CreatedAt.After(until) {
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
+func newTestFeed(activity storage.ActivityStorage) (*FeedService, *PostService) {
+	postStorage := storage.NewInMemoryPostStorage()
+	postService := NewPostService(postStorage, storage.NewInMemoryTxManager(postStorage, storage.NewInMemoryCommentStorage()))
+	cfg := &config.Config{}
+	cfg.Feed.HalfLife = time.Hour
+	cfg.Feed.Size = 2
+	cfg.Feed.Weights.Comment = 1
+	cfg.Feed.Weights.Reaction = 0.5
+	cfg.Feed.Weights.Downvote = 0
+	return NewFeedService(postStorage, activity, cfg), postService
+}
+
+func hotIDs(posts []*models.HotPost) []int {
+	ids := make([]int, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func TestFeedRanking(t *testing.T) {
+	now := time.Now()
+	activity := &fakeActivity{}
+	feed, postService := newTestFeed(activity)
+	for i := 0; i < 3; i++ {
+		_, _ = postService.CreatePost("Test", "Text", "Author")
+	}
+	activity.events = []models.Activity{
+		// Пост 1: два комментария трёхчасовой давности — 2 * 1/8
+		{PostID: 1, CreatedAt: now.Add(-3 * time.Hour)},
+		{PostID: 1, CreatedAt: now.Add(-3 * time.Hour)},
+		// Пост 2: свежий комментарий и реакция — 1 + 0.5
+		{PostID: 2, CreatedAt: now.Add(-time.Minute)},
+		{PostID: 2, Reaction: "👍", CreatedAt: now.Add(-time.Minute)},
+		// Пост 3: только downvote с нулевым весом
+		{PostID: 3, Reaction: models.ReactionDownvote, CreatedAt: now.Add(-time.Minute)},
+	}
+	if err := feed.Refresh(now); err != nil {
+		t.Fatal(err)
+	}
+
+	got := feed.GetHotPosts(10, 0)
+	if ids := hotIDs(got); len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Fatalf("Ожидался порядок [2 1], получено %v", ids)
+	}
+	if math.Abs(got[1].Score-0.25) > 0.001 {
+		t.Errorf("Ожидалась оценка 0.25, получено %v", got[1].Score)
+	}
+	if ids := hotIDs(feed.GetHotPosts(1, 1)); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Ожидалась страница [1], получено %v", ids)
+	}
+	if got := feed.GetHotPosts(10, 5); len(got) != 0 {
+		t.Errorf("Ожидалась пустая страница, получено %v", hotIDs(got))
+	}
+}
+
+func TestFeedRefreshRecomputes(t *testing.T) {
+	start := time.Now()
+	activity := &fakeActivity{}
+	feed, postService := newTestFeed(activity)
+	_, _ = postService.CreatePost("Test", "Text", "Author")
+	_, _ = postService.CreatePost("Test", "Text", "Author")
+
+	activity.events = []models.Activity{{PostID: 1, CreatedAt: start.Add(-time.Hour)}}
+	if err := feed.Refresh(start); err != nil {
+		t.Fatal(err)
+	}
+	// Через два часа оценка поста 1 падает вчетверо, а у поста 2 появляется свежий комментарий
+	activity.events = append(activity.events, models.Activity{PostID: 2, CreatedAt: start.Add(time.Hour)})
+	if err := feed.Refresh(start.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Каждое обновление читает всю учитываемую историю
+	if len(activity.windows) != 2 || !activity.windows[1][0].Equal(start.Add(2*time.Hour-10*time.Hour)) {
+		t.Errorf("Ожидалось чтение за 10 периодов полураспада, получено %v", activity.windows)
+	}
+	got := feed.GetHotPosts(10, 0)
+	if ids := hotIDs(got); len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Fatalf("Ожидался порядок [2 1], получено %v", ids)
+	}
+	if math.Abs(got[1].Score-0.125) > 0.001 || math.Abs(got[0].Score-0.5) > 0.001 {
+		t.Errorf("Ожидались оценки 0.5 и 0.125, получено %v и %v", got[0].Score, got[1].Score)
+	}
+
+	// Исчезнувшая активность перестаёт учитываться
+	activity.events = activity.events[1:]
+	if err := feed.Refresh(start.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ids := hotIDs(feed.GetHotPosts(10, 0)); len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("Ожидался только пост 2, получено %v", ids)
+	}
+}
+
+func TestFeedRepeatedReaction(t *testing.T) {
+	posts, comments := storage.NewInMemoryPostStorage(), storage.NewInMemoryCommentStorage()
+	postService := NewPostService(posts, storage.NewInMemoryTxManager(posts, comments))
+	reactionService := NewReactionService(storage.NewInMemoryReactionStorage(posts, comments), nil)
+	cfg := &config.Config{}
+	cfg.Feed.HalfLife = time.Hour
+	cfg.Feed.Size = 2
+	cfg.Feed.Weights.Reaction = 0.5
+	feed := NewFeedService(posts, storage.NewInMemoryActivityStorage(posts, comments), cfg)
+	post, _ := postService.CreatePost("Test", "Text", "Author")
+
+	// Повторы одной реакции автора учитываются один раз
+	for i := 0; i < 10; i++ {
+		if _, err := reactionService.AddReaction(models.ReactionTargetPost, post.ID, "alice", models.ReactionUpvote); err != nil {
+			t.Fatal(err)
+		}
+		if err := feed.Refresh(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := feed.GetHotPosts(10, 0)
+	if len(got) != 1 || math.Abs(got[0].Score-0.5) > 0.001 {
+		t.Fatalf("Ожидалась оценка 0.5, получено %v", got)
+	}
+
+	// Снятая реакция перестаёт учитываться
+	if err := reactionService.RemoveReaction(models.ReactionTargetPost, post.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.Refresh(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := feed.GetHotPosts(10, 0); len(got) != 0 {
+		t.Errorf("Ожидалась пустая лента, получено %v", hotIDs(got))
+	}
+}
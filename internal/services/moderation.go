@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/moderation"
+	"ozon_test/internal/storage"
+)
+
+var ErrInvalidModerationTarget = errors.New("модерировать можно только пост или комментарий")
+var ErrInvalidModerationAction = errors.New("неизвестное действие модерации")
+
+// Действия модератора над записью из очереди.
+const (
+	ModerationApprove = "approve"
+	ModerationReject  = "reject"
+)
+
+// moderationStatus возвращает статус новой записи по решению цепочки:
+// отложенные ждут модератора, остальные публикуются сразу.
+func moderationStatus(decision moderation.Decision) string {
+	if decision.Action == moderation.ActionHold {
+		return models.StatusPending
+	}
+	return models.StatusApproved
+}
+
+// ModerationTarget — пост или комментарий, над которым выполняется действие.
+type ModerationTarget struct {
+	Type string
+	ID   int
+}
+
+// ModerationResult — итог действия над одной записью пакета;
+// Error пуст при успехе.
+type ModerationResult struct {
+	Type  string
+	ID    int
+	Error string
+}
+
+type ModerationService struct {
+	storage storage.ModerationStorage
+}
+
+func NewModerationService(storage storage.ModerationStorage) *ModerationService {
+	return &ModerationService{storage: storage}
+}
+
+// Queue возвращает страницу записей, ожидающих проверки, старые первыми.
+func (s *ModerationService) Queue(limit, offset int) ([]*models.ModerationItem, error) {
+	return s.storage.GetModerationQueue(limit, offset)
+}
+
+// Approve публикует запись.
+func (s *ModerationService) Approve(moderator string, target ModerationTarget) error {
+	return s.apply(moderator, ModerationApprove, target)
+}
+
+// Reject скрывает запись от всех, кроме автора.
+func (s *ModerationService) Reject(moderator string, target ModerationTarget) error {
+	return s.apply(moderator, ModerationReject, target)
+}
+
+// Bulk выполняет action над каждой записью. Ошибка одной записи
+// не прерывает остальные и попадает в её результат.
+func (s *ModerationService) Bulk(moderator, action string, targets []ModerationTarget) ([]ModerationResult, error) {
+	if action != ModerationApprove && action != ModerationReject {
+		return nil, ErrInvalidModerationAction
+	}
+	results := make([]ModerationResult, 0, len(targets))
+	for _, target := range targets {
+		result := ModerationResult{Type: target.Type, ID: target.ID}
+		if err := s.apply(moderator, action, target); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *ModerationService) apply(moderator, action string, target ModerationTarget) error {
+	if target.Type != models.ModerationTargetPost && target.Type != models.ModerationTargetComment {
+		return ErrInvalidModerationTarget
+	}
+	status := models.StatusApproved
+	if action == ModerationReject {
+		status = models.StatusRejected
+	}
+	if _, err := s.storage.SetStatus(target.Type, target.ID, status); err != nil {
+		return err
+	}
+	log.Printf("Модерация: %s %s %d, модератор %s", action, target.Type, target.ID, moderator)
+	return nil
+}
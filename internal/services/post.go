@@ -1,27 +1,43 @@
 package services
 
 import (
+	"fmt"
 	"time"
 
 	"ozon_test/internal/models"
+	"ozon_test/internal/moderation"
 	"ozon_test/internal/storage"
 )
 
 type PostService struct {
-	storage storage.PostStorage
+	storage    storage.PostStorage
+	txManager  storage.TxManager
+	moderation *moderation.Chain
 }
 
-func NewPostService(storage storage.PostStorage) *PostService {
-	return &PostService{storage: storage}
+func NewPostService(storage storage.PostStorage, txManager storage.TxManager) *PostService {
+	return &PostService{storage: storage, txManager: txManager}
+}
+
+// SetModeration включает проверку новых постов цепочкой правил.
+func (s *PostService) SetModeration(chain *moderation.Chain) {
+	s.moderation = chain
 }
 
 func (s *PostService) CreatePost(title, text, author string) (*models.Post, error) {
+	decision := s.moderation.Moderate(title, text)
+	if decision.Action == moderation.ActionReject {
+		return nil, fmt.Errorf("%w: %s", moderation.ErrRejected, decision.Reason)
+	}
 	post := &models.Post{
-		Title:         title,
-		Text:          text,
-		AllowComments: true,
-		Author:        author,
-		CreatedAt:     time.Now(),
+		Title:            decision.Title,
+		Text:             decision.Text,
+		AllowComments:    true,
+		Author:           author,
+		CreatedAt:        time.Now(),
+		ModerationAction: string(decision.Action),
+		ModerationReason: decision.Reason,
+		Status:           moderationStatus(decision),
 	}
 	err := s.storage.CreatePost(post)
 	if err != nil {
@@ -34,11 +50,56 @@ func (s *PostService) GetAllPosts() ([]*models.Post, error) {
 	return s.storage.GetAllPosts()
 }
 
-func (s *PostService) DisableComments(postID int) error {
-	post, err := s.storage.GetPostByID(postID)
+// GetVisiblePosts возвращает одобренные посты и неодобренные посты viewer.
+func (s *PostService) GetVisiblePosts(viewer string) ([]*models.Post, error) {
+	return s.storage.GetVisiblePosts(viewer)
+}
+
+// LastModified возвращает время последнего изменения постов.
+func (s *PostService) LastModified() (time.Time, error) {
+	return s.storage.LastModified()
+}
+
+// GetPost возвращает пост, если он виден viewer; иначе — storage.ErrNotFound.
+func (s *PostService) GetPost(id int, viewer string) (*models.Post, error) {
+	post, err := s.storage.GetPostByID(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	post.AllowComments = false
-	return s.storage.UpdatePost(post)
+	if !postVisible(post, viewer) {
+		return nil, storage.ErrNotFound
+	}
+	return post, nil
+}
+
+// postVisible сообщает, виден ли пост viewer: неодобренный пост видит
+// только его автор, а вместе с постом скрыты и его комментарии.
+func postVisible(post *models.Post, viewer string) bool {
+	return post.Status == models.StatusApproved || (viewer != "" && post.Author == viewer)
+}
+
+// AnyVersion в качестве ожидаемой версии отключает её проверку.
+const AnyVersion = 0
+
+// DisableComments отключает комментарии к посту, если его версия равна
+// version, и возвращает пост с новой версией. Если версия другая,
+// возвращает storage.ErrVersionConflict.
+func (s *PostService) DisableComments(postID, version int) (*models.Post, error) {
+	var post *models.Post
+	err := s.txManager.WithinTx(func(tx storage.Tx) error {
+		var err error
+		post, err = tx.GetPostForUpdate(postID)
+		if err != nil {
+			return err
+		}
+		if version != AnyVersion && post.Version != version {
+			return storage.ErrVersionConflict
+		}
+		post.AllowComments = false
+		return tx.Posts().UpdatePost(post)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
 }
@@ -1,14 +1,18 @@
 package services
 
 import (
+	"errors"
+	"regexp"
 	"testing"
 
+	"ozon_test/internal/moderation"
 	"ozon_test/internal/storage"
 )
 
 func TestCreatePost(t *testing.T) {
 	postStorage := storage.NewInMemoryPostStorage()
-	service := NewPostService(postStorage)
+	txManager := storage.NewInMemoryTxManager(postStorage, storage.NewInMemoryCommentStorage())
+	service := NewPostService(postStorage, txManager)
 	post, err := service.CreatePost("Test", "Text", "Author")
 	if err != nil {
 		t.Fatal(err)
@@ -20,12 +24,19 @@ func TestCreatePost(t *testing.T) {
 
 func TestDisableComments(t *testing.T) {
 	postStorage := storage.NewInMemoryPostStorage()
-	service := NewPostService(postStorage)
+	txManager := storage.NewInMemoryTxManager(postStorage, storage.NewInMemoryCommentStorage())
+	service := NewPostService(postStorage, txManager)
 	post, _ := service.CreatePost("Test", "Text", "Author")
-	err := service.DisableComments(post.ID)
+	if _, err := service.DisableComments(post.ID, post.Version+1); err != storage.ErrVersionConflict {
+		t.Errorf("Ожидалась ErrVersionConflict для чужой версии, получено %v", err)
+	}
+	disabled, err := service.DisableComments(post.ID, post.Version)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if disabled.Version != post.Version+1 {
+		t.Errorf("Ожидалась версия %d, получена %d", post.Version+1, disabled.Version)
+	}
 	updatedPost, err := postStorage.GetPostByID(post.ID)
 	if err != nil {
 		t.Fatal(err)
@@ -34,3 +45,30 @@ func TestDisableComments(t *testing.T) {
 		t.Error("Ожидалось, что комментарии будут отключены")
 	}
 }
+
+func TestCreatePostModeration(t *testing.T) {
+	postStorage := storage.NewInMemoryPostStorage()
+	txManager := storage.NewInMemoryTxManager(postStorage, storage.NewInMemoryCommentStorage())
+	service := NewPostService(postStorage, txManager)
+	service.SetModeration(moderation.NewChain(
+		moderation.NewBannedWords([]string{"спам"}, moderation.ActionMask),
+		moderation.NewLinkLimit(1, moderation.ActionHold),
+		moderation.NewPattern("casino", regexp.MustCompile(`(?i)казино`), moderation.ActionReject),
+	))
+
+	if _, err := service.CreatePost("Казино", "Text", "Author"); !errors.Is(err, moderation.ErrRejected) {
+		t.Errorf("Ожидалась ошибка ErrRejected, получено %v", err)
+	}
+	if posts, _ := postStorage.GetAllPosts(); len(posts) != 0 {
+		t.Errorf("Отклонённый пост не должен сохраняться, получено %d", len(posts))
+	}
+
+	post, err := service.CreatePost("Не спам", "http://a.ru http://b.ru", "Author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := postStorage.GetPostByID(post.ID)
+	if got.Title != "Не ****" || got.ModerationAction != "hold" || got.ModerationReason != "запрещённые слова; ссылок больше 1" {
+		t.Errorf("Ожидалось сохранённое решение модерации, получено %+v", got)
+	}
+}
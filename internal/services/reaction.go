@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+var ErrInvalidReactionKind = errors.New("неизвестный вид реакции")
+var ErrInvalidReactionTarget = errors.New("реакцию можно оставить только на пост или комментарий")
+var ErrEmptyReactionAuthor = errors.New("не указан автор реакции")
+
+type ReactionService struct {
+	storage storage.ReactionStorage
+	kinds   map[string]bool
+}
+
+// NewReactionService создаёт сервис, принимающий голоса upvote и downvote
+// и эмодзи из набора emoji.
+func NewReactionService(storage storage.ReactionStorage, emoji []string) *ReactionService {
+	kinds := map[string]bool{models.ReactionUpvote: true, models.ReactionDownvote: true}
+	for _, e := range emoji {
+		kinds[e] = true
+	}
+	return &ReactionService{storage: storage, kinds: kinds}
+}
+
+// AddReaction ставит реакцию kind автора на цель, заменяя его прежнюю реакцию.
+func (s *ReactionService) AddReaction(targetType string, targetID int, author, kind string) (*models.Reaction, error) {
+	if !s.kinds[kind] {
+		return nil, ErrInvalidReactionKind
+	}
+	reaction, err := newReaction(targetType, targetID, author)
+	if err != nil {
+		return nil, err
+	}
+	reaction.Kind = kind
+	reaction.CreatedAt = time.Now()
+	if err := s.storage.SetReaction(reaction); err != nil {
+		return nil, err
+	}
+	return reaction, nil
+}
+
+// RemoveReaction снимает реакцию автора с цели.
+func (s *ReactionService) RemoveReaction(targetType string, targetID int, author string) error {
+	reaction, err := newReaction(targetType, targetID, author)
+	if err != nil {
+		return err
+	}
+	reaction.CreatedAt = time.Now()
+	return s.storage.RemoveReaction(reaction)
+}
+
+func newReaction(targetType string, targetID int, author string) (*models.Reaction, error) {
+	if targetType != models.ReactionTargetPost && targetType != models.ReactionTargetComment {
+		return nil, ErrInvalidReactionTarget
+	}
+	if strings.TrimSpace(author) == "" {
+		return nil, ErrEmptyReactionAuthor
+	}
+	return &models.Reaction{TargetType: targetType, TargetID: targetID, Author: author}, nil
+}
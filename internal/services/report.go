@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+var ErrInvalidReportTarget = errors.New("пожаловаться можно только на пост или комментарий")
+var ErrInvalidReportReason = errors.New("неизвестная причина жалобы: допустимы spam, abuse, offtopic и other")
+var ErrInvalidReportResolution = errors.New("неизвестное решение по жалобе: допустимы dismiss и remove")
+var ErrEmptyReporter = errors.New("жаловаться могут только авторизованные пользователи")
+var ErrReportTextTooLong = errors.New("текст жалобы превышает 1000 символов")
+
+var reportReasons = map[string]bool{
+	models.ReportReasonSpam:     true,
+	models.ReportReasonAbuse:    true,
+	models.ReportReasonOfftopic: true,
+	models.ReportReasonOther:    true,
+}
+
+type ReportService struct {
+	reports storage.ReportStorage
+	hideAt  int
+}
+
+// NewReportService создаёт сервис жалоб. Цель, на которую пожаловались
+// hideThreshold разных пользователей, скрывается до решения модератора;
+// ноль отключает скрытие.
+func NewReportService(reports storage.ReportStorage, hideThreshold int) *ReportService {
+	return &ReportService{reports: reports, hideAt: hideThreshold}
+}
+
+// Report сохраняет жалобу reporter на цель.
+func (s *ReportService) Report(reporter, targetType string, targetID int, reason, text string) (*models.Report, error) {
+	if reporter == "" {
+		return nil, ErrEmptyReporter
+	}
+	if targetType != models.ReportTargetPost && targetType != models.ReportTargetComment {
+		return nil, ErrInvalidReportTarget
+	}
+	if !reportReasons[reason] {
+		return nil, ErrInvalidReportReason
+	}
+	if len(text) > 1000 {
+		return nil, ErrReportTextTooLong
+	}
+	report := &models.Report{
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reporter:   reporter,
+		Reason:     reason,
+		Text:       text,
+		CreatedAt:  time.Now(),
+	}
+	hidden, err := s.reports.CreateReport(report, s.hideAt)
+	if err != nil {
+		return nil, err
+	}
+	if hidden {
+		log.Printf("Жалобы: %s %d скрыт до проверки модератором", targetType, targetID)
+	}
+	return report, nil
+}
+
+// OpenReports возвращает страницу открытых жалоб, старые первыми.
+func (s *ReportService) OpenReports(limit, offset int) ([]*models.Report, error) {
+	return s.reports.GetOpenReports(limit, offset)
+}
+
+// Resolve закрывает открытые жалобы на цель и применяет решение: remove
+// отклоняет цель, dismiss возвращает одобрение цели, скрытой этими жалобами.
+// Цель, ожидавшая модератора по другой причине, остаётся в очереди.
+// Возвращает число закрытых жалоб.
+func (s *ReportService) Resolve(moderator, targetType string, targetID int, resolution string) (int, error) {
+	if targetType != models.ReportTargetPost && targetType != models.ReportTargetComment {
+		return 0, ErrInvalidReportTarget
+	}
+	if resolution != models.ReportDismiss && resolution != models.ReportRemove {
+		return 0, ErrInvalidReportResolution
+	}
+	n, _, err := s.reports.ResolveReports(targetType, targetID, resolution, moderator)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Жалобы: %s %s %d (жалоб: %d), модератор %s", resolution, targetType, targetID, n, moderator)
+	return n, nil
+}
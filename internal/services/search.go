@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+const (
+	maxSearchQueryLength = 200
+	maxSearchLimit       = 100
+)
+
+var ErrEmptySearchQuery = errors.New("пустой поисковый запрос")
+var ErrSearchQueryTooLong = errors.New("поисковый запрос превышает 200 символов")
+
+type SearchService struct {
+	storage storage.SearchStorage
+}
+
+func NewSearchService(storage storage.SearchStorage) *SearchService {
+	return &SearchService{storage: storage}
+}
+
+// Search ищет посты и комментарии, содержащие все слова запроса.
+// limit ограничен сверху maxSearchLimit.
+func (s *SearchService) Search(query string, limit, offset int) ([]*models.SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	if len([]rune(query)) > maxSearchQueryLength {
+		return nil, ErrSearchQueryTooLong
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	return s.storage.Search(query, limit, offset)
+}
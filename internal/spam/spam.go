@@ -0,0 +1,259 @@
+package spam
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"ozon_test/config"
+	"ozon_test/internal/moderation"
+)
+
+var ErrDuplicate = errors.New("комментарий повторяет недавний комментарий автора")
+var ErrTooFast = errors.New("слишком много комментариев к разным постам подряд")
+
+// shingleSize — число слов в шингле: порядок слов важнее их набора.
+const shingleSize = 3
+
+// Fingerprint — simhash нормализованного текста. Тексты, отличающиеся
+// несколькими словами, дают отпечатки, отличающиеся несколькими битами.
+type Fingerprint uint64
+
+// Distance возвращает число различающихся битов отпечатков.
+func (f Fingerprint) Distance(other Fingerprint) int {
+	return bits.OnesCount64(uint64(f ^ other))
+}
+
+// words разбивает текст на слова в нижнем регистре с заменой похожих букв:
+// пунктуация, регистр и смесь алфавитов не меняют отпечаток.
+func words(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, field := range fields {
+		fields[i] = moderation.Normalize(field)
+	}
+	return fields
+}
+
+// fingerprint считает simhash по шинглам из shingleSize слов; текст короче
+// шингла хешируется целиком.
+func fingerprint(words []string) Fingerprint {
+	var weights [64]int
+	add := func(shingle []string) {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(shingle, " ")))
+		sum := h.Sum64()
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	if len(words) < shingleSize {
+		add(words)
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		add(words[i : i+shingleSize])
+	}
+	var f Fingerprint
+	for bit, weight := range weights {
+		if weight > 0 {
+			f |= 1 << bit
+		}
+	}
+	return f
+}
+
+// Config — пороги детектора. Нулевые окна отключают соответствующую проверку.
+type Config struct {
+	// Окно поиска повторов среди комментариев клиента
+	DuplicateWindow time.Duration
+	// Наибольшее число различающихся битов отпечатков у повтора
+	MaxDistance int
+	// Тексты короче MinWords слов не проверяются на повтор: «Спасибо!»
+	// под разными постами — не спам
+	MinWords int
+	// Не больше RapidCount комментариев за RapidWindow, если они
+	// оставлены к RapidPosts и более разным постам
+	RapidCount  int
+	RapidWindow time.Duration
+	RapidPosts  int
+}
+
+type entry struct {
+	// Номер резерва для Release
+	id          uint64
+	postID      int
+	fingerprint Fingerprint
+	// Короткие тексты не участвуют в поиске повторов
+	checked bool
+	at      time.Time
+}
+
+// Detector хранит недавние комментарии клиентов в памяти процесса и находит
+// среди них повторы и серии комментариев к разным постам. Клиент — ключ
+// пользователя или адреса анонимного клиента (см. api.clientKey). Нулевой
+// детектор пропускает любой комментарий.
+type Detector struct {
+	cfg       Config
+	mu        sync.Mutex
+	clients   map[string][]entry
+	nextID    uint64
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewDetector(cfg Config) *Detector {
+	return &Detector{cfg: cfg, clients: make(map[string][]entry), now: time.Now}
+}
+
+// NewDetectorFromConfig собирает детектор из секции spam; при выключенной
+// проверке возвращает nil.
+func NewDetectorFromConfig(cfg *config.Config) *Detector {
+	sc := cfg.Spam
+	if !sc.Enabled {
+		return nil
+	}
+	return NewDetector(Config{
+		DuplicateWindow: sc.Duplicates.Window,
+		MaxDistance:     sc.Duplicates.MaxDistance,
+		MinWords:        sc.Duplicates.MinWords,
+		RapidCount:      sc.Rapid.Count,
+		RapidWindow:     sc.Rapid.Window,
+		RapidPosts:      sc.Rapid.Posts,
+	})
+}
+
+// Verdict — решение детектора по одному комментарию.
+type Verdict struct {
+	// ErrDuplicate, ErrTooFast или nil
+	Err error
+	// Подробности решения для журнала
+	Reason      string
+	Fingerprint Fingerprint
+	// Номер запомненного комментария; 0, если ничего не запомнено
+	id uint64
+}
+
+// Reserve проверяет комментарий клиента key к посту postID и, если он не
+// спам, сразу запоминает его под той же блокировкой: параллельные запросы
+// клиента не проходят проверку по одной и той же истории. Если комментарий
+// не удалось сохранить, резерв снимается через Release.
+func (d *Detector) Reserve(key string, postID int, text string) Verdict {
+	if d == nil {
+		return Verdict{}
+	}
+	ws := words(text)
+	verdict := Verdict{Fingerprint: fingerprint(ws)}
+	checked := len(ws) >= d.cfg.MinWords
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	history := d.recent(key, now)
+
+	if checked && d.cfg.DuplicateWindow > 0 {
+		for _, e := range history {
+			if !e.checked || now.Sub(e.at) >= d.cfg.DuplicateWindow {
+				continue
+			}
+			if dist := verdict.Fingerprint.Distance(e.fingerprint); dist <= d.cfg.MaxDistance {
+				verdict.Err = ErrDuplicate
+				verdict.Reason = fmt.Sprintf("похож на комментарий к посту %d от %s (различается битов: %d)",
+					e.postID, e.at.Format(time.RFC3339), dist)
+				return verdict
+			}
+		}
+	}
+
+	if d.cfg.RapidCount > 0 && d.cfg.RapidWindow > 0 {
+		count := 1
+		posts := map[int]bool{postID: true}
+		for _, e := range history {
+			if now.Sub(e.at) < d.cfg.RapidWindow {
+				count++
+				posts[e.postID] = true
+			}
+		}
+		if count > d.cfg.RapidCount && len(posts) >= d.cfg.RapidPosts {
+			verdict.Err = ErrTooFast
+			verdict.Reason = fmt.Sprintf("%d комментариев к %d постам за %s", count, len(posts), d.cfg.RapidWindow)
+			return verdict
+		}
+	}
+
+	d.nextID++
+	verdict.id = d.nextID
+	d.clients[key] = append(history, entry{
+		id:          verdict.id,
+		postID:      postID,
+		fingerprint: verdict.Fingerprint,
+		checked:     checked,
+		at:          now,
+	})
+	return verdict
+}
+
+// Release забывает комментарий, запомненный Reserve, если его не удалось
+// сохранить: несохранённый комментарий не считается образцом для повторов.
+func (d *Detector) Release(key string, verdict Verdict) {
+	if d == nil || verdict.id == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	history := d.clients[key]
+	for i, e := range history {
+		if e.id == verdict.id {
+			d.clients[key] = append(history[:i:i], history[i+1:]...)
+			return
+		}
+	}
+}
+
+// recent возвращает комментарии клиента, ещё попадающие в одно из окон,
+// и отбрасывает остальные. Вызывается под блокировкой.
+func (d *Detector) recent(key string, now time.Time) []entry {
+	if now.Sub(d.lastSweep) >= sweepInterval {
+		d.sweep(now)
+	}
+	history := d.clients[key]
+	keep := d.keep()
+	i := 0
+	for i < len(history) && now.Sub(history[i].at) >= keep {
+		i++
+	}
+	return history[i:]
+}
+
+// keep — сколько хранить комментарий: наибольшее из окон.
+func (d *Detector) keep() time.Duration {
+	return max(d.cfg.DuplicateWindow, d.cfg.RapidWindow)
+}
+
+func (d *Detector) sweep(now time.Time) {
+	keep := d.keep()
+	for key, history := range d.clients {
+		if len(history) == 0 || now.Sub(history[len(history)-1].at) >= keep {
+			delete(d.clients, key)
+		}
+	}
+	d.lastSweep = now
+}
+
+// Len возвращает число клиентов с недавними комментариями.
+func (d *Detector) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.clients)
+}
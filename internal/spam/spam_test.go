@@ -0,0 +1,151 @@
+package spam
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFingerprintNearDuplicates(t *testing.T) {
+	base := fingerprint(words("Заходите на наш сайт, там лучшие цены на телефоны и ноутбуки каждый день"))
+	tests := []struct {
+		text string
+		near bool
+	}{
+		// Регистр, пунктуация и латинские буквы вместо кириллических не важны
+		{"ЗАХОДИТЕ на наш caйт!!! Там лучшие цены на телефоны и ноутбуки каждый день.", true},
+		{"Заходите на наш сайт, там лучшие цены на телефоны и ноутбуки каждый вечер", true},
+		{"Отличная статья, спасибо автору за подробный разбор миграций и индексов", false},
+	}
+	for _, tt := range tests {
+		dist := base.Distance(fingerprint(words(tt.text)))
+		if near := dist <= 10; near != tt.near {
+			t.Errorf("%q: различается битов %d, ожидалась близость %v", tt.text, dist, tt.near)
+		}
+	}
+}
+
+func TestDetectorDuplicates(t *testing.T) {
+	now := time.Now()
+	d := NewDetector(Config{DuplicateWindow: time.Hour, MaxDistance: 3, MinWords: 3})
+	d.now = func() time.Time { return now }
+
+	text := "Лучшие цены на телефоны только у нас, заходите"
+	if verdict := d.Reserve("bot", 1, text); verdict.Err != nil {
+		t.Fatalf("Первый комментарий не должен отклоняться: %v", verdict.Err)
+	}
+
+	if verdict := d.Reserve("bot", 2, "лучшие цены на ТЕЛЕФОНЫ только у нас — заходите!"); verdict.Err != ErrDuplicate {
+		t.Errorf("Ожидался ErrDuplicate, получено %+v", verdict)
+	}
+	if verdict := d.Reserve("alice", 2, text); verdict.Err != nil {
+		t.Errorf("Повтор чужого текста не должен отклоняться, получено %v", verdict.Err)
+	}
+	// Короткие тексты не проверяются на повтор
+	d.Reserve("bot", 1, "Спасибо!")
+	if verdict := d.Reserve("bot", 2, "Спасибо!"); verdict.Err != nil {
+		t.Errorf("Короткий повтор не должен отклоняться, получено %v", verdict.Err)
+	}
+
+	now = now.Add(time.Hour)
+	if verdict := d.Reserve("bot", 2, text); verdict.Err != nil {
+		t.Errorf("Повтор за пределами окна не должен отклоняться, получено %v", verdict.Err)
+	}
+}
+
+func TestDetectorRapidFire(t *testing.T) {
+	now := time.Now()
+	d := NewDetector(Config{RapidCount: 3, RapidWindow: time.Minute, RapidPosts: 2})
+	d.now = func() time.Time { return now }
+	post := func(client string, postID int) error {
+		return d.Reserve(client, postID, "текст").Err
+	}
+
+	// Обсуждение под одним постом — не серия
+	for i := 0; i < 5; i++ {
+		if err := post("alice", 1); err != nil {
+			t.Fatalf("Комментарий %d к одному посту не должен отклоняться: %v", i, err)
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := post("bot", i); err != nil {
+			t.Fatalf("Комментарий %d не должен отклоняться: %v", i, err)
+		}
+		now = now.Add(time.Second)
+	}
+	if err := post("bot", 4); err != ErrTooFast {
+		t.Errorf("Ожидался ErrTooFast, получено %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := post("bot", 4); err != nil {
+		t.Errorf("После окна комментарий не должен отклоняться: %v", err)
+	}
+}
+
+func TestDetectorSweepsIdleAuthors(t *testing.T) {
+	now := time.Now()
+	d := NewDetector(Config{DuplicateWindow: time.Hour, RapidCount: 5, RapidWindow: time.Minute})
+	d.now = func() time.Time { return now }
+	d.Reserve("idle", 1, "текст")
+
+	now = now.Add(30 * time.Minute)
+	d.Reserve("active", 1, "текст")
+	if d.Len() != 2 {
+		t.Fatalf("Ожидалось 2 автора, получено %d", d.Len())
+	}
+	now = now.Add(45 * time.Minute)
+	d.Reserve("active", 1, "текст")
+	if d.Len() != 1 {
+		t.Errorf("Автор без комментариев в окне должен удаляться, осталось %d", d.Len())
+	}
+}
+
+func TestNilDetectorAllows(t *testing.T) {
+	var d *Detector
+	verdict := d.Reserve("bot", 1, "текст")
+	if verdict.Err != nil {
+		t.Errorf("Нулевой детектор должен пропускать комментарии, получено %v", verdict.Err)
+	}
+	d.Release("bot", verdict)
+}
+
+func TestDetectorRelease(t *testing.T) {
+	d := NewDetector(Config{DuplicateWindow: time.Hour, MinWords: 3})
+	text := "Лучшие цены на телефоны только у нас"
+	first := d.Reserve("bot", 1, text)
+	d.Reserve("bot", 2, "Совсем другой текст про погоду и прогулки")
+	// Несохранённый комментарий не считается образцом для повторов
+	d.Release("bot", first)
+	if verdict := d.Reserve("bot", 3, text); verdict.Err != nil {
+		t.Errorf("После Release повтор не должен отклоняться, получено %v", verdict.Err)
+	}
+	// Отклонённый комментарий не резервируется: Release его не трогает
+	d.Release("bot", d.Reserve("bot", 4, text))
+	if verdict := d.Reserve("bot", 5, text); verdict.Err != ErrDuplicate {
+		t.Errorf("Ожидался ErrDuplicate, получено %v", verdict.Err)
+	}
+}
+
+// Параллельные запросы клиента не проходят проверку по одной истории
+func TestDetectorReserveConcurrent(t *testing.T) {
+	d := NewDetector(Config{DuplicateWindow: time.Hour, MinWords: 3})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(postID int) {
+			defer wg.Done()
+			if d.Reserve("bot", postID, "Лучшие цены на телефоны только у нас").Err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("Ожидался один принятый комментарий, принято %d", accepted)
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// ActivityStorage отдаёт свежую активность по постам для горячей ленты.
+type ActivityStorage interface {
+	// GetActivity возвращает комментарии и текущие реакции, созданные
+	// в полуинтервале (since, until], в любом порядке: по одной реакции
+	// на автора и цель. Реакция, заменённая реакцией другого вида, считается
+	// созданной в момент замены, удалённые реакции не возвращаются.
+	GetActivity(since, until time.Time) ([]models.Activity, error)
+}
+
+// InMemoryActivityStorage просматривает данные in-memory хранилищ целиком:
+// отдельного индекса по времени у них нет.
+type InMemoryActivityStorage struct {
+	posts    *InMemoryPostStorage
+	comments *InMemoryCommentStorage
+}
+
+func NewInMemoryActivityStorage(posts *InMemoryPostStorage, comments *InMemoryCommentStorage) *InMemoryActivityStorage {
+	return &InMemoryActivityStorage{posts: posts, comments: comments}
+}
+
+func inWindow(t, since, until time.Time) bool {
+	return t.After(since) && !t.After(until)
+}
+
+func (s *InMemoryActivityStorage) GetActivity(since, until time.Time) ([]models.Activity, error) {
+	activity := []models.Activity{}
+	collect := func(reactions reactionSet) {
+		for _, byAuthor := range reactions {
+			for _, reaction := range byAuthor {
+				if inWindow(reaction.CreatedAt, since, until) {
+					activity = append(activity, models.Activity{PostID: reaction.PostID, Reaction: reaction.Kind, CreatedAt: reaction.CreatedAt})
+				}
+			}
+		}
+	}
+
+	s.posts.mu.RLock()
+	collect(s.posts.reactions)
+	s.posts.mu.RUnlock()
+
+	s.comments.mu.RLock()
+	defer s.comments.mu.RUnlock()
+	for _, comment := range s.comments.comments {
+		if inWindow(comment.CreatedAt, since, until) {
+			activity = append(activity, models.Activity{PostID: comment.PostID, CreatedAt: comment.CreatedAt})
+		}
+	}
+	collect(s.comments.reactions)
+	return activity, nil
+}
+
+const postgresActivityQuery = `
+SELECT post_id, '', created_at FROM comments WHERE created_at > $1 AND created_at <= $2
+UNION ALL
+SELECT post_id, kind, created_at FROM post_reactions WHERE created_at > $1 AND created_at <= $2
+UNION ALL
+SELECT c.post_id, r.kind, r.created_at FROM comment_reactions r JOIN comments c ON c.id = r.comment_id
+WHERE r.created_at > $1 AND r.created_at <= $2`
+
+type PostgresActivityStorage struct {
+	db pgQuerier
+}
+
+// NewPostgresActivityStorage создаёт хранилище, читающее активность с основного
+// сервера и при настроенных репликах: оценки ленты должны отражать уже
+// применённые изменения, в том числе снятые реакции.
+func NewPostgresActivityStorage(pool *pgxpool.Pool) *PostgresActivityStorage {
+	return &PostgresActivityStorage{db: pool}
+}
+
+func (s *PostgresActivityStorage) GetActivity(since, until time.Time) ([]models.Activity, error) {
+	rows, err := s.db.Query(context.Background(), postgresActivityQuery, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []models.Activity{}
+	for rows.Next() {
+		var a models.Activity
+		if err := rows.Scan(&a.PostID, &a.Reaction, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// Драйвер SQLite сохраняет время строкой, формат которой зависит от часового
+// пояса значения, поэтому точное сравнение в SQL невозможно. Запрос отбирает
+// строки не раньше даты since минус сутки (любой формат начинается с даты
+// в своём поясе, а строка с датой не меньше самой даты), а точные границы
+// проверяются после разбора времени.
+const sqliteActivityQuery = `
+SELECT post_id, '', created_at FROM comments WHERE created_at >= ?
+UNION ALL
+SELECT post_id, kind, created_at FROM post_reactions WHERE created_at >= ?
+UNION ALL
+SELECT c.post_id, r.kind, r.created_at FROM comment_reactions r JOIN comments c ON c.id = r.comment_id
+WHERE r.created_at >= ?`
+
+type SQLiteActivityStorage struct {
+	db sqlQuerier
+}
+
+func NewSQLiteActivityStorage(db *sql.DB) *SQLiteActivityStorage {
+	return &SQLiteActivityStorage{db: db}
+}
+
+func (s *SQLiteActivityStorage) GetActivity(since, until time.Time) ([]models.Activity, error) {
+	day := since.UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	rows, err := s.db.Query(sqliteActivityQuery, day, day, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []models.Activity{}
+	for rows.Next() {
+		var a models.Activity
+		if err := rows.Scan(&a.PostID, &a.Reaction, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if inWindow(a.CreatedAt, since, until) {
+			activity = append(activity, a)
+		}
+	}
+	return activity, rows.Err()
+}
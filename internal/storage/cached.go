@@ -0,0 +1,374 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"ozon_test/config"
+	"ozon_test/internal/cache"
+	"ozon_test/internal/models"
+)
+
+// CacheLayer кэширует самые частые чтения: пост по ID и первую страницу
+// комментариев к посту, всех и видимых анонимно. Значения хранятся в JSON, поэтому кэш можно заменить
+// внешним. Одновременные промахи по одному ключу выполняют один запрос к хранилищу.
+//
+// Записи через обёрнутые хранилища и транзакции сбрасывают затронутые ключи.
+// Чтение, начавшееся до записи, может вернуть в кэш старое значение,
+// поэтому устаревание ограничено временем жизни записи (cache.ttl).
+type CacheLayer struct {
+	cache    cache.Cache
+	ttl      time.Duration
+	pageSize int
+	group    singleflight.Group
+	hits     atomic.Int64
+	misses   atomic.Int64
+	loads    atomic.Int64
+}
+
+// CacheStats — счётчики кэша для мониторинга. Loads меньше Misses,
+// когда одновременные промахи объединяются в один запрос к хранилищу.
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Loads  int64 `json:"loads"`
+}
+
+func NewCacheLayer(cfg *config.Config, c cache.Cache) *CacheLayer {
+	pageSize := cfg.Cache.CommentsPageSize
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	return &CacheLayer{cache: c, ttl: cfg.Cache.TTL, pageSize: pageSize}
+}
+
+func (l *CacheLayer) Stats() CacheStats {
+	return CacheStats{Hits: l.hits.Load(), Misses: l.misses.Load(), Loads: l.loads.Load()}
+}
+
+// PostStorage оборачивает хранилище постов.
+func (l *CacheLayer) PostStorage(next PostStorage) PostStorage {
+	return &cachedPostStorage{next: next, layer: l}
+}
+
+// CommentStorage оборачивает хранилище комментариев.
+func (l *CacheLayer) CommentStorage(next CommentStorage) CommentStorage {
+	return &cachedCommentStorage{next: next, layer: l}
+}
+
+// ReactionStorage оборачивает хранилище реакций: изменение реакции сбрасывает
+// закэшированную цель, ведь счётчики реакций входят в пост и комментарии.
+func (l *CacheLayer) ReactionStorage(next ReactionStorage) ReactionStorage {
+	return &cachedReactionStorage{next: next, layer: l}
+}
+
+// ModerationStorage оборачивает хранилище очереди модерации: смена статуса
+// сбрасывает закэшированную цель.
+func (l *CacheLayer) ModerationStorage(next ModerationStorage) ModerationStorage {
+	return &cachedModerationStorage{next: next, layer: l}
+}
+
+// ReportStorage оборачивает хранилище жалоб: скрытие цели по жалобам
+// и решение по ним сбрасывают её закэшированную версию.
+func (l *CacheLayer) ReportStorage(next ReportStorage) ReportStorage {
+	return &cachedReportStorage{next: next, layer: l}
+}
+
+// TxManager оборачивает менеджер транзакций: ключи, затронутые записью
+// в транзакции, сбрасываются после её завершения. Чтения внутри
+// транзакции кэш не используют.
+func (l *CacheLayer) TxManager(next TxManager) TxManager {
+	return &cachedTxManager{next: next, layer: l}
+}
+
+func postCacheKey(id int) string {
+	return "post:" + strconv.Itoa(id)
+}
+
+func commentsCacheKey(postID int) string {
+	return "comments:" + strconv.Itoa(postID)
+}
+
+func visibleCommentsCacheKey(postID int) string {
+	return "comments:visible:" + strconv.Itoa(postID)
+}
+
+// commentsCacheKeys возвращает все ключи с комментариями поста.
+func commentsCacheKeys(postID int) []string {
+	return []string{commentsCacheKey(postID), visibleCommentsCacheKey(postID)}
+}
+
+// load заполняет dst из кэша или, при промахе, результатом fetch.
+func (l *CacheLayer) load(key string, dst interface{}, fetch func() (interface{}, error)) error {
+	if data, ok := l.cache.Get(key); ok {
+		if err := json.Unmarshal(data, dst); err == nil {
+			l.hits.Add(1)
+			return nil
+		}
+		l.cache.Delete(key)
+	}
+	l.misses.Add(1)
+
+	data, err, _ := l.group.Do(key, func() (interface{}, error) {
+		l.loads.Add(1)
+		value, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		l.cache.Set(key, data, l.ttl)
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data.([]byte), dst)
+}
+
+func (l *CacheLayer) invalidate(keys ...string) {
+	for _, key := range keys {
+		l.group.Forget(key)
+		l.cache.Delete(key)
+	}
+}
+
+type cachedPostStorage struct {
+	next  PostStorage
+	layer *CacheLayer
+}
+
+func (s *cachedPostStorage) CreatePost(post *models.Post) error {
+	return s.next.CreatePost(post)
+}
+
+func (s *cachedPostStorage) GetPostByID(id int) (*models.Post, error) {
+	var post models.Post
+	err := s.layer.load(postCacheKey(id), &post, func() (interface{}, error) {
+		return s.next.GetPostByID(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (s *cachedPostStorage) GetAllPosts() ([]*models.Post, error) {
+	return s.next.GetAllPosts()
+}
+
+func (s *cachedPostStorage) GetVisiblePosts(viewer string) ([]*models.Post, error) {
+	return s.next.GetVisiblePosts(viewer)
+}
+
+func (s *cachedPostStorage) LastModified() (time.Time, error) {
+	return s.next.LastModified()
+}
+
+func (s *cachedPostStorage) UpdatePost(post *models.Post) error {
+	defer s.layer.invalidate(postCacheKey(post.ID))
+	return s.next.UpdatePost(post)
+}
+
+// cachedCommentStorage хранит для каждого поста первые pageSize комментариев
+// и отвечает из них на любой запрос с нулевым смещением и limit <= pageSize.
+type cachedCommentStorage struct {
+	next  CommentStorage
+	layer *CacheLayer
+}
+
+func (s *cachedCommentStorage) CreateComment(comment *models.Comment) error {
+	defer s.layer.invalidate(commentsCacheKeys(comment.PostID)...)
+	return s.next.CreateComment(comment)
+}
+
+func (s *cachedCommentStorage) GetCommentsByPostID(postID int, limit, offset int) ([]*models.Comment, error) {
+	return s.firstPage(commentsCacheKey(postID), limit, offset, func(limit, offset int) ([]*models.Comment, error) {
+		return s.next.GetCommentsByPostID(postID, limit, offset)
+	})
+}
+
+// GetVisibleComments кэширует только анонимный просмотр: у автора
+// неодобренных комментариев своя выдача.
+func (s *cachedCommentStorage) GetVisibleComments(postID int, viewer string, limit, offset int) ([]*models.Comment, error) {
+	if viewer != "" {
+		return s.next.GetVisibleComments(postID, viewer, limit, offset)
+	}
+	return s.firstPage(visibleCommentsCacheKey(postID), limit, offset, func(limit, offset int) ([]*models.Comment, error) {
+		return s.next.GetVisibleComments(postID, "", limit, offset)
+	})
+}
+
+// firstPage отвечает из закэшированной под key первой страницы или,
+// если запрос за неё выходит, напрямую через fetch.
+func (s *cachedCommentStorage) firstPage(key string, limit, offset int, fetch func(limit, offset int) ([]*models.Comment, error)) ([]*models.Comment, error) {
+	limit, offset = normalizePage(limit, offset)
+	pageSize := s.layer.pageSize
+	if offset != 0 || limit > pageSize {
+		return fetch(limit, offset)
+	}
+
+	var comments []*models.Comment
+	err := s.layer.load(key, &comments, func() (interface{}, error) {
+		return fetch(pageSize, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if comments == nil {
+		comments = []*models.Comment{}
+	}
+	if len(comments) > limit {
+		comments = comments[:limit]
+	}
+	return comments, nil
+}
+
+func (s *cachedCommentStorage) LastModified(postID int) (time.Time, error) {
+	return s.next.LastModified(postID)
+}
+
+func (s *cachedCommentStorage) GetCommentTree(postID int, viewer string, order CommentSort, limit, offset int) ([]*models.Comment, error) {
+	return s.next.GetCommentTree(postID, viewer, order, limit, offset)
+}
+
+type cachedReactionStorage struct {
+	next  ReactionStorage
+	layer *CacheLayer
+}
+
+func (s *cachedReactionStorage) SetReaction(reaction *models.Reaction) error {
+	if err := s.next.SetReaction(reaction); err != nil {
+		return err
+	}
+	s.layer.invalidate(reactionCacheKeys(reaction)...)
+	return nil
+}
+
+func (s *cachedReactionStorage) RemoveReaction(reaction *models.Reaction) error {
+	if err := s.next.RemoveReaction(reaction); err != nil {
+		return err
+	}
+	s.layer.invalidate(reactionCacheKeys(reaction)...)
+	return nil
+}
+
+// reactionCacheKeys возвращает ключи, в которые входит цель реакции.
+func reactionCacheKeys(reaction *models.Reaction) []string {
+	if reaction.TargetType == models.ReactionTargetPost {
+		return []string{postCacheKey(reaction.TargetID)}
+	}
+	return commentsCacheKeys(reaction.PostID)
+}
+
+type cachedModerationStorage struct {
+	next  ModerationStorage
+	layer *CacheLayer
+}
+
+func (s *cachedModerationStorage) GetModerationQueue(limit, offset int) ([]*models.ModerationItem, error) {
+	return s.next.GetModerationQueue(limit, offset)
+}
+
+func (s *cachedModerationStorage) SetStatus(targetType string, id int, status string) (int, error) {
+	postID, err := s.next.SetStatus(targetType, id, status)
+	if err != nil {
+		return 0, err
+	}
+	if targetType == models.ModerationTargetPost {
+		s.layer.invalidate(postCacheKey(postID))
+	} else {
+		s.layer.invalidate(commentsCacheKeys(postID)...)
+	}
+	return postID, nil
+}
+
+type cachedReportStorage struct {
+	next  ReportStorage
+	layer *CacheLayer
+}
+
+func (s *cachedReportStorage) CreateReport(report *models.Report, hideAt int) (bool, error) {
+	hidden, err := s.next.CreateReport(report, hideAt)
+	if err != nil {
+		return false, err
+	}
+	if hidden {
+		if report.TargetType == models.ReportTargetPost {
+			s.layer.invalidate(postCacheKey(report.PostID))
+		} else {
+			s.layer.invalidate(commentsCacheKeys(report.PostID)...)
+		}
+	}
+	return hidden, nil
+}
+
+func (s *cachedReportStorage) GetOpenReports(limit, offset int) ([]*models.Report, error) {
+	return s.next.GetOpenReports(limit, offset)
+}
+
+// ResolveReports сбрасывает закэшированную цель: решение могло сменить её статус.
+func (s *cachedReportStorage) ResolveReports(targetType string, targetID int, resolution, moderator string) (int, int, error) {
+	n, postID, err := s.next.ResolveReports(targetType, targetID, resolution, moderator)
+	if err != nil {
+		return 0, 0, err
+	}
+	if targetType == models.ReportTargetPost {
+		s.layer.invalidate(postCacheKey(postID))
+	} else {
+		s.layer.invalidate(commentsCacheKeys(postID)...)
+	}
+	return n, postID, nil
+}
+
+type cachedTxManager struct {
+	next  TxManager
+	layer *CacheLayer
+}
+
+func (m *cachedTxManager) WithinTx(fn func(tx Tx) error) error {
+	var keys []string
+	defer func() { m.layer.invalidate(keys...) }()
+	return m.next.WithinTx(func(tx Tx) error {
+		return fn(&cachedTx{Tx: tx, keys: &keys})
+	})
+}
+
+// cachedTx запоминает ключи, затронутые записью в транзакции.
+type cachedTx struct {
+	Tx
+	keys *[]string
+}
+
+func (t *cachedTx) Posts() PostStorage {
+	return &txPostStorage{PostStorage: t.Tx.Posts(), keys: t.keys}
+}
+
+func (t *cachedTx) Comments() CommentStorage {
+	return &txCommentStorage{CommentStorage: t.Tx.Comments(), keys: t.keys}
+}
+
+type txPostStorage struct {
+	PostStorage
+	keys *[]string
+}
+
+func (s *txPostStorage) UpdatePost(post *models.Post) error {
+	*s.keys = append(*s.keys, postCacheKey(post.ID))
+	return s.PostStorage.UpdatePost(post)
+}
+
+type txCommentStorage struct {
+	CommentStorage
+	keys *[]string
+}
+
+func (s *txCommentStorage) CreateComment(comment *models.Comment) error {
+	*s.keys = append(*s.keys, commentsCacheKeys(comment.PostID)...)
+	return s.CommentStorage.CreateComment(comment)
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ozon_test/config"
+	"ozon_test/internal/cache"
+	"ozon_test/internal/models"
+)
+
+func newTestCacheLayer(pageSize int) *CacheLayer {
+	cfg := &config.Config{}
+	cfg.Cache.TTL = time.Minute
+	cfg.Cache.CommentsPageSize = pageSize
+	return NewCacheLayer(cfg, cache.NewLRU(100))
+}
+
+// countingPostStorage считает обращения к GetPostByID и может задерживать их.
+type countingPostStorage struct {
+	PostStorage
+	reads   atomic.Int64
+	release chan struct{}
+}
+
+func (s *countingPostStorage) GetPostByID(id int) (*models.Post, error) {
+	s.reads.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	return s.PostStorage.GetPostByID(id)
+}
+
+func TestCachedPostStorage(t *testing.T) {
+	layer := newTestCacheLayer(10)
+	inner := &countingPostStorage{PostStorage: NewInMemoryPostStorage()}
+	posts := layer.PostStorage(inner)
+	post := createTestPost(t, posts, "Cached")
+
+	for i := 0; i < 3; i++ {
+		got, err := posts.GetPostByID(post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "Cached" {
+			t.Errorf("Ожидался заголовок 'Cached', получено '%s'", got.Title)
+		}
+		// Изменение полученной копии не затрагивает кэш
+		got.Title = "Changed"
+	}
+	if inner.reads.Load() != 1 {
+		t.Errorf("Ожидалось 1 обращение к хранилищу, получено %d", inner.reads.Load())
+	}
+
+	post.AllowComments = false
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := posts.GetPostByID(post.ID)
+	if got.AllowComments || got.Title != "Cached" {
+		t.Errorf("Ожидался обновлённый пост после сброса кэша, получено %+v", got)
+	}
+	if stats := layer.Stats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("Ожидалось 2 попадания и 2 промаха, получено %+v", stats)
+	}
+
+	if _, err := posts.GetPostByID(42); err != ErrNotFound {
+		t.Errorf("Ожидалась ошибка ErrNotFound, получено %v", err)
+	}
+}
+
+func TestCachedPostStorageSingleflight(t *testing.T) {
+	layer := newTestCacheLayer(10)
+	inner := &countingPostStorage{PostStorage: NewInMemoryPostStorage()}
+	post := createTestPost(t, inner.PostStorage, "Hot")
+	inner.release = make(chan struct{})
+	posts := layer.PostStorage(inner)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := posts.GetPostByID(post.ID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Даём горутинам дойти до общего запроса
+	for layer.Stats().Misses < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	close(inner.release)
+	wg.Wait()
+
+	if inner.reads.Load() != 1 || layer.Stats().Loads != 1 {
+		t.Errorf("Ожидался 1 запрос к хранилищу, получено %d", inner.reads.Load())
+	}
+}
+
+func TestCachedCommentStorage(t *testing.T) {
+	layer := newTestCacheLayer(3)
+	comments := layer.CommentStorage(NewInMemoryCommentStorage())
+	for i := 0; i < 5; i++ {
+		createTestComment(t, comments, 1)
+	}
+
+	page, _ := comments.GetCommentsByPostID(1, 2, 0)
+	if len(page) != 2 || page[0].ID != 1 {
+		t.Fatalf("Ожидались 2 первых комментария, получено %+v", page)
+	}
+	page, _ = comments.GetCommentsByPostID(1, 3, 0)
+	if len(page) != 3 || layer.Stats().Hits != 1 {
+		t.Errorf("Ожидалось 3 комментария из кэша, получено %d, %+v", len(page), layer.Stats())
+	}
+	// Страницы за пределами кэша читаются из хранилища
+	page, _ = comments.GetCommentsByPostID(1, 10, 0)
+	if len(page) != 5 || layer.Stats().Misses != 1 {
+		t.Errorf("Ожидалось 5 комментариев мимо кэша, получено %d, %+v", len(page), layer.Stats())
+	}
+
+	empty, err := comments.GetCommentsByPostID(2, 3, 0)
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("Ожидался пустой срез (не nil), получено %v, %v", empty, err)
+	}
+}
+
+func TestCacheLayerInvalidatesAfterTx(t *testing.T) {
+	layer := newTestCacheLayer(10)
+	innerPosts, innerComments := NewInMemoryPostStorage(), NewInMemoryCommentStorage()
+	posts, comments := layer.PostStorage(innerPosts), layer.CommentStorage(innerComments)
+	txManager := layer.TxManager(NewInMemoryTxManager(innerPosts, innerComments))
+	post := createTestPost(t, posts, "Test")
+
+	posts.GetPostByID(post.ID)
+	comments.GetCommentsByPostID(post.ID, 10, 0)
+	err := txManager.WithinTx(func(tx Tx) error {
+		locked, err := tx.GetPostForUpdate(post.ID)
+		if err != nil {
+			return err
+		}
+		locked.Title = "Updated"
+		if err := tx.Posts().UpdatePost(locked); err != nil {
+			return err
+		}
+		return tx.Comments().CreateComment(&models.Comment{PostID: post.ID, Text: "New", Author: "User", CreatedAt: time.Now()})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := posts.GetPostByID(post.ID); got.Title != "Updated" {
+		t.Errorf("Ожидался заголовок 'Updated', получено '%s'", got.Title)
+	}
+	if page, _ := comments.GetCommentsByPostID(post.ID, 10, 0); len(page) != 1 {
+		t.Errorf("Ожидался 1 комментарий после сброса кэша, получено %d", len(page))
+	}
+}
+
+func TestCacheLayerInvalidatesOnStatusChange(t *testing.T) {
+	layer := newTestCacheLayer(10)
+	innerPosts, innerComments := NewInMemoryPostStorage(), NewInMemoryCommentStorage()
+	posts, comments := layer.PostStorage(innerPosts), layer.CommentStorage(innerComments)
+	moderation := layer.ModerationStorage(NewInMemoryModerationStorage(innerPosts, innerComments))
+	post := createTestPost(t, posts, "Test")
+	comment := createTestComment(t, comments, post.ID)
+
+	posts.GetPostByID(post.ID)
+	comments.GetVisibleComments(post.ID, "", 10, 0)
+	if _, err := moderation.SetStatus(models.ModerationTargetComment, comment.ID, models.StatusRejected); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := moderation.SetStatus(models.ModerationTargetPost, post.ID, models.StatusPending); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := posts.GetPostByID(post.ID); got.Status != models.StatusPending {
+		t.Errorf("Ожидался статус pending после сброса кэша, получен %q", got.Status)
+	}
+	if page, _ := comments.GetVisibleComments(post.ID, "", 10, 0); len(page) != 0 {
+		t.Errorf("Отклонённый комментарий остался в кэше: %d", len(page))
+	}
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// ExportFilter отбирает записи для выгрузки: с ID больше AfterID и временем
+// создания в полуинтервале [From, To). Нулевое время снимает границу.
+type ExportFilter struct {
+	AfterID int
+	From    time.Time
+	To      time.Time
+}
+
+func (f ExportFilter) matches(createdAt time.Time) bool {
+	return (f.From.IsZero() || !createdAt.Before(f.From)) && (f.To.IsZero() || createdAt.Before(f.To))
+}
+
+// ExportStorage перебирает все посты и комментарии независимо от статуса
+// модерации в порядке ID. Записи читаются порциями по exportBatchSize:
+// выгрузка не держит данные в памяти целиком и не блокирует хранилище
+// надолго. Ошибка fn останавливает перебор и возвращается.
+type ExportStorage interface {
+	EachPost(filter ExportFilter, fn func(*models.Post) error) error
+	EachComment(filter ExportFilter, fn func(*models.Comment) error) error
+}
+
+const exportBatchSize = 500
+
+// eachBatch читает порции, пока они не кончатся: batch обрабатывает порцию
+// после курсора afterID и возвращает ID последней просмотренной записи
+// либо 0, если записей больше нет.
+func eachBatch(afterID int, batch func(afterID int) (lastID int, err error)) error {
+	for {
+		lastID, err := batch(afterID)
+		if err != nil || lastID == 0 {
+			return err
+		}
+		afterID = lastID
+	}
+}
+
+// exportCondition отбирает порцию после afterID с временем создания
+// в [from, to); nil снимает границу.
+func exportCondition(afterID int, from, to interface{}) squirrel.And {
+	where := squirrel.And{squirrel.Gt{"id": afterID}}
+	if from != nil {
+		where = append(where, squirrel.GtOrEq{"created_at": from})
+	}
+	if to != nil {
+		where = append(where, squirrel.Lt{"created_at": to})
+	}
+	return where
+}
+
+// InMemoryExportStorage просматривает ID подряд: они назначаются
+// по возрастанию и не переиспользуются.
+type InMemoryExportStorage struct {
+	posts    *InMemoryPostStorage
+	comments *InMemoryCommentStorage
+}
+
+func NewInMemoryExportStorage(posts *InMemoryPostStorage, comments *InMemoryCommentStorage) *InMemoryExportStorage {
+	return &InMemoryExportStorage{posts: posts, comments: comments}
+}
+
+func (s *InMemoryExportStorage) EachPost(filter ExportFilter, fn func(*models.Post) error) error {
+	return eachBatch(filter.AfterID, func(afterID int) (int, error) {
+		posts, lastID := s.postBatch(filter, afterID)
+		for _, post := range posts {
+			if err := fn(post); err != nil {
+				return 0, err
+			}
+		}
+		return lastID, nil
+	})
+}
+
+// postBatch копирует под блокировкой до exportBatchSize подходящих постов
+// после afterID и возвращает ID последнего просмотренного.
+func (s *InMemoryExportStorage) postBatch(filter ExportFilter, afterID int) ([]*models.Post, int) {
+	s.posts.mu.RLock()
+	defer s.posts.mu.RUnlock()
+	var posts []*models.Post
+	lastID := 0
+	for id := afterID + 1; id < s.posts.nextID && len(posts) < exportBatchSize; id++ {
+		lastID = id
+		if post, exists := s.posts.posts[id]; exists && filter.matches(post.CreatedAt) {
+			posts = append(posts, s.posts.read(post))
+		}
+	}
+	return posts, lastID
+}
+
+func (s *InMemoryExportStorage) EachComment(filter ExportFilter, fn func(*models.Comment) error) error {
+	return eachBatch(filter.AfterID, func(afterID int) (int, error) {
+		comments, lastID := s.commentBatch(filter, afterID)
+		for _, comment := range comments {
+			if err := fn(comment); err != nil {
+				return 0, err
+			}
+		}
+		return lastID, nil
+	})
+}
+
+func (s *InMemoryExportStorage) commentBatch(filter ExportFilter, afterID int) ([]*models.Comment, int) {
+	s.comments.mu.RLock()
+	defer s.comments.mu.RUnlock()
+	var ids []int
+	lastID := 0
+	for id := afterID + 1; id < s.comments.nextID && len(ids) < exportBatchSize; id++ {
+		lastID = id
+		if comment, exists := s.comments.comments[id]; exists && filter.matches(comment.CreatedAt) {
+			ids = append(ids, id)
+		}
+	}
+	return s.comments.page(ids, len(ids), 0), lastID
+}
+
+type PostgresExportStorage struct {
+	posts    *PostgresPostStorage
+	comments *PostgresCommentStorage
+}
+
+func NewPostgresExportStorage(pool *pgxpool.Pool) *PostgresExportStorage {
+	return &PostgresExportStorage{posts: NewPostgresPostStorage(pool), comments: NewPostgresCommentStorage(pool)}
+}
+
+// NewReplicatedPostgresExportStorage создаёт хранилище, читающее выгрузку с реплик.
+func NewReplicatedPostgresExportStorage(pool *pgxpool.Pool, replicas *ReplicaSet) *PostgresExportStorage {
+	return &PostgresExportStorage{
+		posts:    NewReplicatedPostgresPostStorage(pool, replicas),
+		comments: NewReplicatedPostgresCommentStorage(pool, replicas),
+	}
+}
+
+// postgresExportCondition сравнивает время создания точно: оно хранится в TIMESTAMPTZ.
+func postgresExportCondition(afterID int, filter ExportFilter) squirrel.And {
+	var from, to interface{}
+	if !filter.From.IsZero() {
+		from = filter.From
+	}
+	if !filter.To.IsZero() {
+		to = filter.To
+	}
+	return exportCondition(afterID, from, to)
+}
+
+func (s *PostgresExportStorage) EachPost(filter ExportFilter, fn func(*models.Post) error) error {
+	return eachBatch(filter.AfterID, func(afterID int) (int, error) {
+		posts, err := s.posts.list(squirrel.Select(postColumns...).
+			Where(postgresExportCondition(afterID, filter)).Limit(exportBatchSize))
+		if err != nil || len(posts) == 0 {
+			return 0, err
+		}
+		for _, post := range posts {
+			if err := fn(post); err != nil {
+				return 0, err
+			}
+		}
+		return posts[len(posts)-1].ID, nil
+	})
+}
+
+func (s *PostgresExportStorage) EachComment(filter ExportFilter, fn func(*models.Comment) error) error {
+	return eachBatch(filter.AfterID, func(afterID int) (int, error) {
+		comments, err := s.comments.list(postgresExportCondition(afterID, filter), exportBatchSize, 0)
+		if err != nil || len(comments) == 0 {
+			return 0, err
+		}
+		for _, comment := range comments {
+			if err := fn(comment); err != nil {
+				return 0, err
+			}
+		}
+		return comments[len(comments)-1].ID, nil
+	})
+}
+
+type SQLiteExportStorage struct {
+	posts    *SQLitePostStorage
+	comments *SQLiteCommentStorage
+}
+
+func NewSQLiteExportStorage(db *sql.DB) *SQLiteExportStorage {
+	return &SQLiteExportStorage{posts: NewSQLitePostStorage(db), comments: NewSQLiteCommentStorage(db)}
+}
+
+// sqliteExportCondition сужает выборку по датам с запасом в сутки в каждую
+// сторону: время хранится строкой в поясе значения (см. sqliteActivityQuery).
+// Точные границы проверяются после разбора времени.
+func sqliteExportCondition(afterID int, filter ExportFilter) squirrel.And {
+	var from, to interface{}
+	if !filter.From.IsZero() {
+		from = filter.From.UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.UTC().AddDate(0, 0, 2).Format("2006-01-02")
+	}
+	return exportCondition(afterID, from, to)
+}
+
+func (s *SQLiteExportStorage) EachPost(filter ExportFilter, fn func(*models.Post) error) error {
+	return eachBatch(filter.AfterID, func(afterID int) (int, error) {
+		posts, err := s.posts.list(squirrel.Select(postColumns...).
+			Where(sqliteExportCondition(afterID, filter)).Limit(exportBatchSize))
+		if err != nil || len(posts) == 0 {
+			return 0, err
+		}
+		for _, post := range posts {
+			if !filter.matches(post.CreatedAt) {
+				continue
+			}
+			if err := fn(post); err != nil {
+				return 0, err
+			}
+		}
+		return posts[len(posts)-1].ID, nil
+	})
+}
+
+func (s *SQLiteExportStorage) EachComment(filter ExportFilter, fn func(*models.Comment) error) error {
+	return eachBatch(filter.AfterID, func(afterID int) (int, error) {
+		comments, err := s.comments.list(sqliteExportCondition(afterID, filter), exportBatchSize, 0)
+		if err != nil || len(comments) == 0 {
+			return 0, err
+		}
+		for _, comment := range comments {
+			if !filter.matches(comment.CreatedAt) {
+				continue
+			}
+			if err := fn(comment); err != nil {
+				return 0, err
+			}
+		}
+		return comments[len(comments)-1].ID, nil
+	})
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// IdempotencyStorage хранит запросы с ключами идемпотентности и ответы на них.
+type IdempotencyStorage interface {
+	// ReserveIdempotencyKey занимает ключ record.Owner/record.Key. Если ключ
+	// уже занят, возвращает его запись; запись, созданная раньше expiredBefore,
+	// и незавершённая запись, созданная раньше abandonedBefore, заменяются.
+	ReserveIdempotencyKey(record *models.IdempotencyRecord, expiredBefore, abandonedBefore time.Time) (*models.IdempotencyRecord, error)
+	// SaveIdempotentResponse сохраняет ответ на запрос, занявший ключ.
+	SaveIdempotentResponse(record *models.IdempotencyRecord) error
+	// ReleaseIdempotencyKey освобождает ключ, ответ на который не сохраняется.
+	ReleaseIdempotencyKey(owner, key string) error
+	// PurgeIdempotencyKeys удаляет записи, созданные раньше before.
+	PurgeIdempotencyKeys(before time.Time) error
+}
+
+// replaceable сообщает, можно ли занять ключ поверх существующей записи.
+func replaceable(record *models.IdempotencyRecord, expiredBefore, abandonedBefore time.Time) bool {
+	return record.CreatedAt.Before(expiredBefore) ||
+		record.StatusCode == 0 && record.CreatedAt.Before(abandonedBefore)
+}
+
+// InMemoryIdempotencyStorage хранит ключи в памяти процесса: в отличие
+// от постов, они не попадают в журнал и не переживают перезапуск.
+type InMemoryIdempotencyStorage struct {
+	mu      sync.Mutex
+	records map[idempotencyKey]*models.IdempotencyRecord
+}
+
+type idempotencyKey struct {
+	owner, key string
+}
+
+func NewInMemoryIdempotencyStorage() *InMemoryIdempotencyStorage {
+	return &InMemoryIdempotencyStorage{records: make(map[idempotencyKey]*models.IdempotencyRecord)}
+}
+
+func cloneIdempotencyRecord(record *models.IdempotencyRecord) *models.IdempotencyRecord {
+	clone := *record
+	clone.Body = append([]byte(nil), record.Body...)
+	if record.Headers != nil {
+		clone.Headers = make(map[string]string, len(record.Headers))
+		for name, value := range record.Headers {
+			clone.Headers[name] = value
+		}
+	}
+	return &clone
+}
+
+func (s *InMemoryIdempotencyStorage) ReserveIdempotencyKey(record *models.IdempotencyRecord, expiredBefore, abandonedBefore time.Time) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{record.Owner, record.Key}
+	if existing, ok := s.records[k]; ok && !replaceable(existing, expiredBefore, abandonedBefore) {
+		return cloneIdempotencyRecord(existing), nil
+	}
+	s.records[k] = cloneIdempotencyRecord(record)
+	return nil, nil
+}
+
+func (s *InMemoryIdempotencyStorage) SaveIdempotentResponse(record *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{record.Owner, record.Key}
+	if _, ok := s.records[k]; !ok {
+		return ErrNotFound
+	}
+	s.records[k] = cloneIdempotencyRecord(record)
+	return nil
+}
+
+func (s *InMemoryIdempotencyStorage) ReleaseIdempotencyKey(owner, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, idempotencyKey{owner, key})
+	return nil
+}
+
+func (s *InMemoryIdempotencyStorage) PurgeIdempotencyKeys(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, record := range s.records {
+		if record.CreatedAt.Before(before) {
+			delete(s.records, k)
+		}
+	}
+	return nil
+}
+
+// staleIdempotencyKey отбирает запись ключа, которую можно заменить.
+func staleIdempotencyKey(owner, key string, expiredBefore, abandonedBefore interface{}) squirrel.And {
+	return squirrel.And{
+		squirrel.Eq{"owner": owner, "key": key},
+		squirrel.Or{
+			squirrel.Lt{"created_at": expiredBefore},
+			squirrel.And{squirrel.Eq{"status_code": 0}, squirrel.Lt{"created_at": abandonedBefore}},
+		},
+	}
+}
+
+var idempotencyColumns = []string{"owner", "key", "request_hash", "status_code", "content_type", "headers", "body", "created_at"}
+
+// encodeHeaders кодирует заголовки ответа для колонки headers.
+func encodeHeaders(headers map[string]string) (string, error) {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	data, err := json.Marshal(headers)
+	return string(data), err
+}
+
+// decodeHeaders разбирает колонку headers.
+func decodeHeaders(data string) (map[string]string, error) {
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(data), &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+type PostgresIdempotencyStorage struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresIdempotencyStorage(pool *pgxpool.Pool) *PostgresIdempotencyStorage {
+	return &PostgresIdempotencyStorage{pool: pool}
+}
+
+// ReserveIdempotencyKey выполняется в транзакции: одновременная вставка того
+// же ключа ждёт её завершения, а затем видит занявшую ключ запись.
+func (s *PostgresIdempotencyStorage) ReserveIdempotencyKey(record *models.IdempotencyRecord, expiredBefore, abandonedBefore time.Time) (*models.IdempotencyRecord, error) {
+	ctx := context.Background()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback(ctx)
+
+	sql, args, err := squirrel.Delete("idempotency_keys").
+		Where(staleIdempotencyKey(record.Owner, record.Key, expiredBefore, abandonedBefore)).
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return nil, err
+	}
+
+	sql, args, err = squirrel.Insert("idempotency_keys").Columns("owner", "key", "request_hash", "created_at").
+		Values(record.Owner, record.Key, record.RequestHash, record.CreatedAt).
+		Suffix("ON CONFLICT DO NOTHING").PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected() == 1 {
+		return nil, tx.Commit(ctx)
+	}
+
+	sql, args, err = squirrel.Select(idempotencyColumns...).From("idempotency_keys").
+		Where(squirrel.Eq{"owner": record.Owner, "key": record.Key}).PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	existing := &models.IdempotencyRecord{}
+	var headers string
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&existing.Owner, &existing.Key, &existing.RequestHash,
+		&existing.StatusCode, &existing.ContentType, &headers, &existing.Body, &existing.CreatedAt); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if existing.Headers, err = decodeHeaders(headers); err != nil {
+		return nil, err
+	}
+	return existing, tx.Commit(ctx)
+}
+
+func (s *PostgresIdempotencyStorage) SaveIdempotentResponse(record *models.IdempotencyRecord) error {
+	headers, err := encodeHeaders(record.Headers)
+	if err != nil {
+		return err
+	}
+	sql, args, err := squirrel.Update("idempotency_keys").
+		Set("status_code", record.StatusCode).Set("content_type", record.ContentType).
+		Set("headers", headers).Set("body", record.Body).
+		Where(squirrel.Eq{"owner": record.Owner, "key": record.Key}).PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+	result, err := s.pool.Exec(context.Background(), sql, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresIdempotencyStorage) ReleaseIdempotencyKey(owner, key string) error {
+	sql, args, err := squirrel.Delete("idempotency_keys").Where(squirrel.Eq{"owner": owner, "key": key}).
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(context.Background(), sql, args...)
+	return err
+}
+
+func (s *PostgresIdempotencyStorage) PurgeIdempotencyKeys(before time.Time) error {
+	sql, args, err := squirrel.Delete("idempotency_keys").Where(squirrel.Lt{"created_at": before}).
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(context.Background(), sql, args...)
+	return err
+}
+
+// SQLiteIdempotencyStorage хранит created_at в наносекундах Unix,
+// чтобы сравнивать время в запросах.
+type SQLiteIdempotencyStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteIdempotencyStorage(db *sql.DB) *SQLiteIdempotencyStorage {
+	return &SQLiteIdempotencyStorage{db: db}
+}
+
+func (s *SQLiteIdempotencyStorage) ReserveIdempotencyKey(record *models.IdempotencyRecord, expiredBefore, abandonedBefore time.Time) (*models.IdempotencyRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sqlStr, args, err := squirrel.Delete("idempotency_keys").
+		Where(staleIdempotencyKey(record.Owner, record.Key, expiredBefore.UnixNano(), abandonedBefore.UnixNano())).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(sqlStr, args...); err != nil {
+		return nil, err
+	}
+
+	sqlStr, args, err = squirrel.Insert("idempotency_keys").Columns("owner", "key", "request_hash", "created_at").
+		Values(record.Owner, record.Key, record.RequestHash, record.CreatedAt.UnixNano()).
+		Suffix("ON CONFLICT DO NOTHING").ToSql()
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 1 {
+		return nil, tx.Commit()
+	}
+
+	sqlStr, args, err = squirrel.Select(idempotencyColumns...).From("idempotency_keys").
+		Where(squirrel.Eq{"owner": record.Owner, "key": record.Key}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	existing := &models.IdempotencyRecord{}
+	var headers string
+	var createdAt int64
+	if err := tx.QueryRow(sqlStr, args...).Scan(&existing.Owner, &existing.Key, &existing.RequestHash,
+		&existing.StatusCode, &existing.ContentType, &headers, &existing.Body, &createdAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if existing.Headers, err = decodeHeaders(headers); err != nil {
+		return nil, err
+	}
+	existing.CreatedAt = time.Unix(0, createdAt)
+	return existing, tx.Commit()
+}
+
+func (s *SQLiteIdempotencyStorage) SaveIdempotentResponse(record *models.IdempotencyRecord) error {
+	headers, err := encodeHeaders(record.Headers)
+	if err != nil {
+		return err
+	}
+	sqlStr, args, err := squirrel.Update("idempotency_keys").
+		Set("status_code", record.StatusCode).Set("content_type", record.ContentType).
+		Set("headers", headers).Set("body", record.Body).
+		Where(squirrel.Eq{"owner": record.Owner, "key": record.Key}).ToSql()
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(sqlStr, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteIdempotencyStorage) ReleaseIdempotencyKey(owner, key string) error {
+	sqlStr, args, err := squirrel.Delete("idempotency_keys").Where(squirrel.Eq{"owner": owner, "key": key}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(sqlStr, args...)
+	return err
+}
+
+func (s *SQLiteIdempotencyStorage) PurgeIdempotencyKeys(before time.Time) error {
+	sqlStr, args, err := squirrel.Delete("idempotency_keys").Where(squirrel.Lt{"created_at": before.UnixNano()}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(sqlStr, args...)
+	return err
+}
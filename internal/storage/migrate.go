@@ -1,52 +1,66 @@
 package storage
 
 import (
-	"context"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/jackc/pgx/v4/pgxpool"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"ozon_test/config"
+	"ozon_test/migrations"
 )
 
-func ApplyMigrations(cfg *config.Config) error {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName)
+// NewMigrate создаёт мигратор встроенных миграций для хранилища storageType (postgres или sqlite).
+func NewMigrate(cfg *config.Config, storageType string) (*migrate.Migrate, error) {
+	var dir, dsn string
+	switch storageType {
+	case "postgres":
+		dir = migrations.PostgresDir
+		dsn = PostgresDSN(cfg)
 
-	// Ожидание готовности базы данных
-	if err := waitForDB(dsn); err != nil {
-		return fmt.Errorf("ошибка ожидания базы данных: %w", err)
+		// Ожидание готовности базы данных
+		if err := waitForDB(cfg); err != nil {
+			return nil, fmt.Errorf("ошибка ожидания базы данных: %w", err)
+		}
+	case "sqlite":
+		dir = migrations.SQLiteDir
+		dsn = "sqlite://" + cfg.SQLite.Path
+	default:
+		return nil, fmt.Errorf("хранилище %q не использует миграции", storageType)
 	}
 
-	m, err := migrate.New("file://migrations", dsn)
+	source, err := iofs.New(migrations.FS, dir)
 	if err != nil {
-		return fmt.Errorf("ошибка создания миграции: %w", err)
+		return nil, fmt.Errorf("ошибка чтения встроенных миграций: %w", err)
 	}
-
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("ошибка применения миграций: %w", err)
+	m, err := migrate.NewWithSourceInstance("iofs", source, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания миграции: %w", err)
 	}
+	return m, nil
+}
 
-	log.Println("Миграции успешно применены")
-	return nil
+func ApplyMigrations(cfg *config.Config) error {
+	return applyMigrations(cfg, "postgres")
 }
 
-func waitForDB(dsn string) error {
-	const maxAttempts = 10
-	const delay = 2 * time.Second
+func ApplySQLiteMigrations(cfg *config.Config) error {
+	return applyMigrations(cfg, "sqlite")
+}
 
-	for i := 0; i < maxAttempts; i++ {
-		pool, err := pgxpool.Connect(context.Background(), dsn)
-		if err == nil {
-			pool.Close()
-			return nil
-		}
-		log.Printf("База данных недоступна, попытка %d/%d: %v", i+1, maxAttempts, err)
-		time.Sleep(delay)
+func applyMigrations(cfg *config.Config, storageType string) error {
+	m, err := NewMigrate(cfg, storageType)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("база данных недоступна после %d попыток", maxAttempts)
+	defer m.Close()
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("ошибка применения миграций: %w", err)
+	}
+
+	log.Printf("Миграции %s успешно применены", storageType)
+	return nil
 }
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// ModerationStorage хранит очередь модерации: посты и комментарии
+// со статусом pending.
+type ModerationStorage interface {
+	// GetModerationQueue возвращает страницу очереди, старые записи первыми.
+	GetModerationQueue(limit, offset int) ([]*models.ModerationItem, error)
+	// SetStatus меняет статус поста или комментария и возвращает ID поста,
+	// к которому относится цель. Если цели нет, возвращает ErrNotFound.
+	SetStatus(targetType string, id int, status string) (postID int, err error)
+}
+
+// sortModerationQueue упорядочивает очередь по времени создания;
+// при равном времени пост идёт раньше комментария.
+func sortModerationQueue(items []*models.ModerationItem) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.Type != b.Type {
+			return a.Type > b.Type
+		}
+		return a.ID < b.ID
+	})
+}
+
+// pageModerationQueue возвращает страницу упорядоченной очереди.
+func pageModerationQueue(items []*models.ModerationItem, limit, offset int) []*models.ModerationItem {
+	limit, offset = normalizePage(limit, offset)
+	if offset >= len(items) {
+		return []*models.ModerationItem{}
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
+
+type InMemoryModerationStorage struct {
+	posts    *InMemoryPostStorage
+	comments *InMemoryCommentStorage
+}
+
+func NewInMemoryModerationStorage(posts *InMemoryPostStorage, comments *InMemoryCommentStorage) *InMemoryModerationStorage {
+	return &InMemoryModerationStorage{posts: posts, comments: comments}
+}
+
+func (s *InMemoryModerationStorage) GetModerationQueue(limit, offset int) ([]*models.ModerationItem, error) {
+	items := []*models.ModerationItem{}
+
+	s.posts.mu.RLock()
+	for _, post := range s.posts.posts {
+		if post.Status == models.StatusPending {
+			items = append(items, &models.ModerationItem{
+				Type: models.ModerationTargetPost, ID: post.ID, PostID: post.ID,
+				Title: post.Title, Text: post.Text, Author: post.Author, CreatedAt: post.CreatedAt,
+				ModerationAction: post.ModerationAction, ModerationReason: post.ModerationReason,
+			})
+		}
+	}
+	s.posts.mu.RUnlock()
+
+	s.comments.mu.RLock()
+	for _, comment := range s.comments.comments {
+		if comment.Status == models.StatusPending {
+			items = append(items, &models.ModerationItem{
+				Type: models.ModerationTargetComment, ID: comment.ID, PostID: comment.PostID,
+				Text: comment.Text, Author: comment.Author, CreatedAt: comment.CreatedAt,
+				ModerationAction: comment.ModerationAction, ModerationReason: comment.ModerationReason,
+			})
+		}
+	}
+	s.comments.mu.RUnlock()
+
+	sortModerationQueue(items)
+	return pageModerationQueue(items, limit, offset), nil
+}
+
+func (s *InMemoryModerationStorage) SetStatus(targetType string, id int, status string) (int, error) {
+	switch targetType {
+	case models.ModerationTargetPost:
+		return id, s.posts.setStatus(id, status)
+	case models.ModerationTargetComment:
+		return s.comments.setStatus(id, status)
+	}
+	return 0, ErrNotFound
+}
+
+// setStatus меняет статус поста.
+func (s *InMemoryPostStorage) setStatus(id int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, exists := s.posts[id]
+	if !exists {
+		return ErrNotFound
+	}
+	return s.writeStatus(post, status)
+}
+
+// writeStatus записывает в журнал и сохраняет версию поста с новым статусом.
+// Вызывается под блокировкой.
+func (s *InMemoryPostStorage) writeStatus(post *models.Post, status string) error {
+	updated := clonePost(post)
+	updated.Status = status
+	updated.Version++
+	updated.UpdatedAt = changedAt(time.Now())
+	if err := s.journal.append(opUpdatePost, updated); err != nil {
+		return err
+	}
+	s.posts[post.ID] = updated
+	s.search.indexPost(updated)
+	return nil
+}
+
+// setStatus меняет статус комментария и возвращает ID его поста.
+func (s *InMemoryCommentStorage) setStatus(id int, status string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comment, exists := s.comments[id]
+	if !exists {
+		return 0, ErrNotFound
+	}
+	return comment.PostID, s.writeStatus(comment, status)
+}
+
+// writeStatus записывает в журнал и сохраняет версию комментария с новым
+// статусом. Вызывается под блокировкой.
+func (s *InMemoryCommentStorage) writeStatus(comment *models.Comment, status string) error {
+	updated := cloneComment(comment)
+	updated.Status = status
+	updated.Version++
+	updated.UpdatedAt = changedAt(time.Now())
+	if err := s.journal.append(opUpdateComment, updated); err != nil {
+		return err
+	}
+	s.comments[comment.ID] = updated
+	s.search.indexComment(updated)
+	return nil
+}
+
+// moderationTable возвращает таблицу цели и колонку с ID её поста.
+func moderationTable(targetType string) (table, postColumn string, err error) {
+	switch targetType {
+	case models.ModerationTargetPost:
+		return "posts", "id", nil
+	case models.ModerationTargetComment:
+		return "comments", "post_id", nil
+	}
+	return "", "", ErrNotFound
+}
+
+const moderationQueueQuery = `
+SELECT 'post' AS type, id, id AS post_id, title, text, author, created_at, moderation_action, moderation_reason
+FROM posts WHERE status = 'pending'
+UNION ALL
+SELECT 'comment', id, post_id, '', text, author, created_at, moderation_action, moderation_reason
+FROM comments WHERE status = 'pending'`
+
+func scanModerationItem(scan func(dest ...interface{}) error) (*models.ModerationItem, error) {
+	item := &models.ModerationItem{}
+	err := scan(&item.Type, &item.ID, &item.PostID, &item.Title, &item.Text, &item.Author,
+		&item.CreatedAt, &item.ModerationAction, &item.ModerationReason)
+	return item, err
+}
+
+type PostgresModerationStorage struct {
+	db pgQuerier
+}
+
+func NewPostgresModerationStorage(pool *pgxpool.Pool) *PostgresModerationStorage {
+	return &PostgresModerationStorage{db: pool}
+}
+
+func (s *PostgresModerationStorage) GetModerationQueue(limit, offset int) ([]*models.ModerationItem, error) {
+	limit, offset = normalizePage(limit, offset)
+	rows, err := s.db.Query(context.Background(),
+		moderationQueueQuery+"\nORDER BY created_at, type DESC, id LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*models.ModerationItem{}
+	for rows.Next() {
+		item, err := scanModerationItem(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *PostgresModerationStorage) SetStatus(targetType string, id int, status string) (int, error) {
+	table, postColumn, err := moderationTable(targetType)
+	if err != nil {
+		return 0, err
+	}
+	query := touch(squirrel.Update(table).Set("status", status), changedAt(time.Now())).Where(squirrel.Eq{"id": id}).
+		Suffix("RETURNING " + postColumn).PlaceholderFormat(squirrel.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var postID int
+	if err := s.db.QueryRow(context.Background(), sql, args...).Scan(&postID); err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return postID, nil
+}
+
+type SQLiteModerationStorage struct {
+	db sqlQuerier
+}
+
+func NewSQLiteModerationStorage(db *sql.DB) *SQLiteModerationStorage {
+	return &SQLiteModerationStorage{db: db}
+}
+
+// GetModerationQueue упорядочивает очередь после чтения: created_at
+// в SQLite хранится строкой в формате, зависящем от часового пояса.
+func (s *SQLiteModerationStorage) GetModerationQueue(limit, offset int) ([]*models.ModerationItem, error) {
+	rows, err := s.db.Query(moderationQueueQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*models.ModerationItem{}
+	for rows.Next() {
+		item, err := scanModerationItem(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortModerationQueue(items)
+	return pageModerationQueue(items, limit, offset), nil
+}
+
+func (s *SQLiteModerationStorage) SetStatus(targetType string, id int, status string) (int, error) {
+	table, postColumn, err := moderationTable(targetType)
+	if err != nil {
+		return 0, err
+	}
+	query := touch(squirrel.Update(table).Set("status", status), changedAt(time.Now())).Where(squirrel.Eq{"id": id}).
+		Suffix("RETURNING " + postColumn)
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var postID int
+	if err := s.db.QueryRow(sqlStr, args...).Scan(&postID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return postID, nil
+}
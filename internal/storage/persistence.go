@@ -0,0 +1,514 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"ozon_test/config"
+	"ozon_test/internal/models"
+)
+
+// Режимы сброса журнала на диск.
+const (
+	// FsyncAlways сбрасывает журнал после каждой записи.
+	FsyncAlways = "always"
+	// FsyncInterval сбрасывает журнал фоново раз в fsync_interval.
+	FsyncInterval = "interval"
+	// FsyncNever оставляет сброс на усмотрение операционной системы.
+	FsyncNever = "never"
+)
+
+const (
+	journalFileName  = "journal.log"
+	snapshotFileName = "snapshot.json"
+
+	// Заголовок записи журнала: длина полезной нагрузки и её CRC32
+	journalHeaderSize = 8
+	// Наибольшая полезная нагрузка записи. Обрыв при сбое оставляет
+	// в конце журнала меньше одной записи: длина больше этой — повреждение,
+	// а не неполная запись
+	journalMaxPayload = 4 << 20
+)
+
+const (
+	opCreatePost     = "create_post"
+	opUpdatePost     = "update_post"
+	opCreateComment  = "create_comment"
+	opUpdateComment  = "update_comment"
+	opSetReaction    = "set_reaction"
+	opRemoveReaction = "remove_reaction"
+	opCreateReport   = "create_report"
+	opResolveReports = "resolve_reports"
+)
+
+var ErrJournalCorrupted = errors.New("journal corrupted")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type journalRecord struct {
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+type snapshotData struct {
+	Posts     []*models.Post     `json:"posts"`
+	Comments  []*models.Comment  `json:"comments"`
+	Reactions []*models.Reaction `json:"reactions,omitempty"`
+	Reports   []*models.Report   `json:"reports,omitempty"`
+}
+
+// journal — журнал упреждающей записи: каждое изменение in-memory хранилищ
+// дописывается в файл до того, как становится видимым читателям.
+// Nil-журнал ничего не пишет, так хранилища работают без персистентности.
+type journal struct {
+	mu     sync.Mutex
+	file   *os.File
+	fsync  string
+	dirty  bool
+	closed bool
+}
+
+func (j *journal) append(op string, v interface{}) error {
+	if j == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(journalRecord{Op: op, Data: data})
+	if err != nil {
+		return err
+	}
+	if len(payload) > journalMaxPayload {
+		return fmt.Errorf("запись журнала %s больше %d байт", op, journalMaxPayload)
+	}
+
+	frame := make([]byte, journalHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[journalHeaderSize:], payload)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return fmt.Errorf("журнал закрыт")
+	}
+	if _, err := j.file.Write(frame); err != nil {
+		return fmt.Errorf("ошибка записи в журнал: %w", err)
+	}
+	if j.fsync == FsyncAlways {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("ошибка сброса журнала на диск: %w", err)
+		}
+		return nil
+	}
+	j.dirty = true
+	return nil
+}
+
+func (j *journal) sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.dirty || j.closed {
+		return nil
+	}
+	j.dirty = false
+	return j.file.Sync()
+}
+
+// reset очищает журнал после того, как его содержимое попало в снимок.
+// Вызывается под j.mu.
+func (j *journal) reset() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	j.dirty = false
+	return j.file.Sync()
+}
+
+// readJournal читает записи журнала. Недописанная или повреждённая последняя
+// запись (обрыв при сбое) отбрасывается, а файл обрезается до последней целой записи.
+// Повреждение в середине журнала и длина записи больше journalMaxPayload
+// считаются ошибкой: обрезка по такой длине отбросила бы целые записи.
+func readJournal(file *os.File) ([]journalRecord, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	var records []journalRecord
+	var offset int64
+	header := make([]byte, journalHeaderSize)
+	for offset < size {
+		if size-offset < journalHeaderSize {
+			break
+		}
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return nil, err
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if length > journalMaxPayload {
+			return nil, fmt.Errorf("%w: длина записи %d по смещению %d больше допустимой", ErrJournalCorrupted, length, offset)
+		}
+		end := offset + journalHeaderSize + length
+		// До конца файла меньше заголовка и наибольшей записи: неполная запись
+		if end > size {
+			break
+		}
+		payload := make([]byte, length)
+		if _, err := file.ReadAt(payload, offset+journalHeaderSize); err != nil {
+			return nil, err
+		}
+		var record journalRecord
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) ||
+			json.Unmarshal(payload, &record) != nil {
+			if end == size {
+				break
+			}
+			return nil, fmt.Errorf("%w: повреждена запись по смещению %d", ErrJournalCorrupted, offset)
+		}
+		records = append(records, record)
+		offset = end
+	}
+
+	if offset < size {
+		log.Printf("Журнал обрывается на смещении %d из %d, неполная запись отброшена", offset, size)
+		if err := file.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("ошибка обрезки журнала: %w", err)
+		}
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Persistence сохраняет in-memory хранилища в каталог: изменения пишутся
+// в журнал, а периодический снимок состояния позволяет журнал очищать.
+// При запуске состояние восстанавливается из снимка и журнала.
+type Persistence struct {
+	dir      string
+	journal  *journal
+	posts    *InMemoryPostStorage
+	comments *InMemoryCommentStorage
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewPersistentInMemoryStorage создаёт in-memory хранилища, восстановленные
+// из каталога cfg.InMemory.DataDir и сохраняющие в него все изменения.
+func NewPersistentInMemoryStorage(cfg *config.Config) (*InMemoryPostStorage, *InMemoryCommentStorage, *Persistence, error) {
+	opts := cfg.InMemory
+	switch opts.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, nil, nil, fmt.Errorf("неизвестный режим fsync: %q", opts.Fsync)
+	}
+	if opts.Fsync == FsyncInterval && opts.FsyncInterval <= 0 {
+		return nil, nil, nil, fmt.Errorf("режиму fsync %q нужен положительный fsync_interval, получено %s", opts.Fsync, opts.FsyncInterval)
+	}
+	if err := os.MkdirAll(opts.DataDir, 0o755); err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка создания каталога данных: %w", err)
+	}
+
+	p := &Persistence{
+		dir:      opts.DataDir,
+		posts:    NewInMemoryPostStorage(),
+		comments: NewInMemoryCommentStorage(),
+		stop:     make(chan struct{}),
+	}
+	if err := p.loadSnapshot(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(p.dir, journalFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка открытия журнала: %w", err)
+	}
+	records, err := readJournal(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, err
+	}
+	for _, record := range records {
+		if err := p.apply(record); err != nil {
+			file.Close()
+			return nil, nil, nil, err
+		}
+	}
+	log.Printf("Восстановлено постов: %d, комментариев: %d (записей журнала: %d)",
+		len(p.posts.posts), len(p.comments.comments), len(records))
+
+	p.journal = &journal{file: file, fsync: opts.Fsync}
+	p.posts.journal = p.journal
+	p.comments.journal = p.journal
+
+	if opts.Fsync == FsyncInterval {
+		p.every(opts.FsyncInterval, func() error { return p.journal.sync() })
+	}
+	if opts.SnapshotInterval > 0 {
+		p.every(opts.SnapshotInterval, p.Snapshot)
+	}
+
+	return p.posts, p.comments, p, nil
+}
+
+func (p *Persistence) every(interval time.Duration, fn func() error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := fn(); err != nil {
+					log.Printf("Ошибка сохранения in-memory хранилища: %v", err)
+				}
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Snapshot записывает текущее состояние хранилищ в снимок и очищает журнал.
+// На время записи изменения хранилищ блокируются.
+func (p *Persistence) Snapshot() error {
+	p.posts.mu.RLock()
+	defer p.posts.mu.RUnlock()
+	p.comments.mu.RLock()
+	defer p.comments.mu.RUnlock()
+	p.journal.mu.Lock()
+	defer p.journal.mu.Unlock()
+	if p.journal.closed {
+		return nil
+	}
+
+	data := snapshotData{
+		Posts:    make([]*models.Post, 0, len(p.posts.posts)),
+		Comments: make([]*models.Comment, 0, len(p.comments.comments)),
+	}
+	for _, post := range p.posts.posts {
+		data.Posts = append(data.Posts, post)
+	}
+	for _, comment := range p.comments.comments {
+		data.Comments = append(data.Comments, comment)
+	}
+	sort.Slice(data.Posts, func(i, j int) bool { return data.Posts[i].ID < data.Posts[j].ID })
+	sort.Slice(data.Comments, func(i, j int) bool { return data.Comments[i].ID < data.Comments[j].ID })
+	data.Reactions = append(p.posts.reactions.all(), p.comments.reactions.all()...)
+	all := func(*models.Report) bool { return true }
+	data.Reports = append(p.posts.reports.collect(all), p.comments.reports.collect(all)...)
+	sortReports(data.Reports)
+
+	if err := writeFileAtomic(filepath.Join(p.dir, snapshotFileName), data); err != nil {
+		return fmt.Errorf("ошибка записи снимка: %w", err)
+	}
+	// Если сбой произойдёт до очистки, журнал будет повторно применён
+	// поверх нового снимка: повторное применение записей идемпотентно
+	if err := p.journal.reset(); err != nil {
+		return fmt.Errorf("ошибка очистки журнала: %w", err)
+	}
+	return nil
+}
+
+// Close останавливает фоновые задачи, сбрасывает журнал на диск и закрывает его.
+func (p *Persistence) Close() error {
+	close(p.stop)
+	p.wg.Wait()
+
+	p.journal.mu.Lock()
+	defer p.journal.mu.Unlock()
+	p.journal.closed = true
+	if err := p.journal.file.Sync(); err != nil {
+		p.journal.file.Close()
+		return err
+	}
+	return p.journal.file.Close()
+}
+
+func (p *Persistence) loadSnapshot() error {
+	raw, err := os.ReadFile(filepath.Join(p.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения снимка: %w", err)
+	}
+
+	var data snapshotData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("ошибка разбора снимка: %w", err)
+	}
+	for _, post := range data.Posts {
+		p.posts.restore(post)
+	}
+	for _, comment := range data.Comments {
+		p.comments.restore(comment)
+	}
+	for _, reaction := range data.Reactions {
+		if err := p.restoreReaction(opSetReaction, reaction); err != nil {
+			return fmt.Errorf("ошибка разбора снимка: %w", err)
+		}
+	}
+	for _, report := range data.Reports {
+		if err := p.restoreReport(opCreateReport, report); err != nil {
+			return fmt.Errorf("ошибка разбора снимка: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Persistence) apply(record journalRecord) error {
+	switch record.Op {
+	case opCreatePost, opUpdatePost:
+		post := &models.Post{}
+		if err := json.Unmarshal(record.Data, post); err != nil {
+			return fmt.Errorf("%w: %v", ErrJournalCorrupted, err)
+		}
+		p.posts.restore(post)
+	case opCreateComment, opUpdateComment:
+		comment := &models.Comment{}
+		if err := json.Unmarshal(record.Data, comment); err != nil {
+			return fmt.Errorf("%w: %v", ErrJournalCorrupted, err)
+		}
+		p.comments.restore(comment)
+	case opSetReaction, opRemoveReaction:
+		reaction := &models.Reaction{}
+		if err := json.Unmarshal(record.Data, reaction); err != nil {
+			return fmt.Errorf("%w: %v", ErrJournalCorrupted, err)
+		}
+		return p.restoreReaction(record.Op, reaction)
+	case opCreateReport, opResolveReports:
+		report := &models.Report{}
+		if err := json.Unmarshal(record.Data, report); err != nil {
+			return fmt.Errorf("%w: %v", ErrJournalCorrupted, err)
+		}
+		return p.restoreReport(record.Op, report)
+	default:
+		return fmt.Errorf("%w: неизвестная операция %q", ErrJournalCorrupted, record.Op)
+	}
+	return nil
+}
+
+// restoreReaction повторяет установку или удаление реакции; повторное
+// применение даёт тот же результат.
+func (p *Persistence) restoreReaction(op string, reaction *models.Reaction) error {
+	var reactions reactionSet
+	var touch func(id int, at time.Time)
+	switch reaction.TargetType {
+	case models.ReactionTargetPost:
+		reactions, touch = p.posts.reactions, p.posts.touch
+	case models.ReactionTargetComment:
+		reactions, touch = p.comments.reactions, p.comments.touch
+	default:
+		return fmt.Errorf("%w: неизвестная цель реакции %q", ErrJournalCorrupted, reaction.TargetType)
+	}
+	if op == opSetReaction {
+		reactions.set(reaction)
+	} else {
+		reactions.remove(reaction.TargetID, reaction.Author)
+	}
+	// Реакции, снятые до появления UpdatedAt, записаны без времени
+	if !reaction.CreatedAt.IsZero() {
+		touch(reaction.TargetID, changedAt(reaction.CreatedAt))
+	}
+	return nil
+}
+
+// restoreReport повторяет создание жалобы или закрытие жалоб на цель;
+// повторное применение даёт тот же результат.
+func (p *Persistence) restoreReport(op string, report *models.Report) error {
+	var reports reportSet
+	switch report.TargetType {
+	case models.ReportTargetPost:
+		reports = p.posts.reports
+	case models.ReportTargetComment:
+		reports = p.comments.reports
+	default:
+		return fmt.Errorf("%w: неизвестная цель жалобы %q", ErrJournalCorrupted, report.TargetType)
+	}
+	if op == opCreateReport {
+		reports.add(report)
+	} else {
+		reports.resolve(report)
+	}
+	return nil
+}
+
+// restore кладёт восстановленный пост на его место. Записи, сохранённые
+// до появления модерации, статуса не имеют и считаются одобренными,
+// а сохранённые до появления версий получают версию 1.
+func (s *InMemoryPostStorage) restore(post *models.Post) {
+	post.Reactions = nil
+	post.Status = newStatus(post.Status)
+	post.Version = max(post.Version, 1)
+	s.posts[post.ID] = post
+	s.search.indexPost(post)
+	if post.ID >= s.nextID {
+		s.nextID = post.ID + 1
+	}
+}
+
+// restore кладёт восстановленный комментарий на его место; повторное
+// восстановление уже известного комментария индексы не дублирует.
+func (s *InMemoryCommentStorage) restore(comment *models.Comment) {
+	comment.Reactions = nil
+	comment.Status = newStatus(comment.Status)
+	comment.Version = max(comment.Version, 1)
+	if _, exists := s.comments[comment.ID]; exists {
+		s.comments[comment.ID] = comment
+		s.search.indexComment(comment)
+		return
+	}
+	s.insert(comment)
+	if comment.ID >= s.nextID {
+		s.nextID = comment.ID + 1
+	}
+}
+
+func writeFileAtomic(path string, v interface{}) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,354 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ozon_test/config"
+	"ozon_test/internal/models"
+)
+
+func newPersistenceConfig(dir string) *config.Config {
+	cfg := &config.Config{}
+	cfg.InMemory.DataDir = dir
+	cfg.InMemory.Fsync = FsyncAlways
+	return cfg
+}
+
+func openPersistent(t *testing.T, dir string) (*InMemoryPostStorage, *InMemoryCommentStorage, *Persistence) {
+	t.Helper()
+	posts, comments, p, err := NewPersistentInMemoryStorage(newPersistenceConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return posts, comments, p
+}
+
+func createTestPost(t *testing.T, store PostStorage, title string) *models.Post {
+	t.Helper()
+	post := &models.Post{Title: title, Text: "Text", AllowComments: true, Author: "Author", CreatedAt: time.Now()}
+	if err := store.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func createTestComment(t *testing.T, store CommentStorage, postID int) *models.Comment {
+	t.Helper()
+	comment := &models.Comment{PostID: postID, Text: "Comment", Author: "User", CreatedAt: time.Now()}
+	if err := store.CreateComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	return comment
+}
+
+func TestPersistenceRestore(t *testing.T) {
+	dir := t.TempDir()
+	posts, comments, p := openPersistent(t, dir)
+	post := createTestPost(t, posts, "First")
+	createTestPost(t, posts, "Second")
+	createTestComment(t, comments, post.ID)
+	post.AllowComments = false
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, comments, p = openPersistent(t, dir)
+	defer p.Close()
+	restored, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "First" || restored.AllowComments {
+		t.Errorf("Пост восстановлен неверно: %+v", restored)
+	}
+	page, _ := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if len(page) != 1 {
+		t.Errorf("Ожидался 1 комментарий, получено %d", len(page))
+	}
+	if next := createTestPost(t, posts, "Third"); next.ID != 3 {
+		t.Errorf("Ожидался ID 3 для нового поста, получено %d", next.ID)
+	}
+}
+
+func TestPersistenceRestoresModerationStatus(t *testing.T) {
+	dir := t.TempDir()
+	posts, comments, p := openPersistent(t, dir)
+	moderation := NewInMemoryModerationStorage(posts, comments)
+	post := createTestPost(t, posts, "Test")
+	comment := &models.Comment{PostID: post.ID, Text: "Comment", Author: "User", CreatedAt: time.Now(), Status: models.StatusPending}
+	if err := comments.CreateComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := moderation.SetStatus(models.ModerationTargetPost, post.ID, models.StatusRejected); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := moderation.SetStatus(models.ModerationTargetComment, comment.ID, models.StatusApproved); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, comments, p = openPersistent(t, dir)
+	defer p.Close()
+	if restored, _ := posts.GetPostByID(post.ID); restored.Status != models.StatusRejected {
+		t.Errorf("Ожидался статус поста rejected, получен %q", restored.Status)
+	}
+	if page, _ := comments.GetVisibleComments(post.ID, "", 10, 0); len(page) != 1 {
+		t.Errorf("Одобренный комментарий должен быть виден после восстановления, получено %d", len(page))
+	}
+	search := NewInMemorySearchStorage(posts, comments)
+	if results, _ := search.Search("test", 10, 0); len(results) != 0 {
+		t.Errorf("Отклонённый пост не должен находиться, получено %+v", results)
+	}
+	if results, _ := search.Search("comment", 10, 0); len(results) != 0 {
+		t.Errorf("Комментарий отклонённого поста не должен находиться, получено %+v", results)
+	}
+}
+
+func TestPersistenceRestoresReports(t *testing.T) {
+	dir := t.TempDir()
+	posts, comments, p := openPersistent(t, dir)
+	reports := NewInMemoryReportStorage(posts, comments)
+	post := createTestPost(t, posts, "Test")
+	other := createTestPost(t, posts, "Other")
+	report := func(id int, reporter string) *models.Report {
+		return &models.Report{TargetType: models.ReportTargetPost, TargetID: id, Reporter: reporter,
+			Reason: models.ReportReasonSpam, CreatedAt: time.Now()}
+	}
+	if _, err := reports.CreateReport(report(post.ID, "alice"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := reports.ResolveReports(models.ReportTargetPost, post.ID, models.ReportDismiss, "moder"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	// Жалоба после снимка восстанавливается из журнала и скрывает пост
+	if hidden, err := reports.CreateReport(report(other.ID, "bob"), 1); err != nil || !hidden {
+		t.Fatalf("Ожидалось скрытие поста: %v, %v", hidden, err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, comments, p = openPersistent(t, dir)
+	defer p.Close()
+	reports = NewInMemoryReportStorage(posts, comments)
+	open, _ := reports.GetOpenReports(10, 0)
+	if len(open) != 1 || open[0].TargetID != other.ID || open[0].Reporter != "bob" {
+		t.Errorf("Ожидалась одна открытая жалоба bob, получено %+v", open)
+	}
+	if _, err := reports.CreateReport(report(post.ID, "alice"), 0); err != ErrDuplicateReport {
+		t.Errorf("Закрытая жалоба должна восстановиться, получено %v", err)
+	}
+	if restored, _ := posts.GetPostByID(other.ID); restored.Status != models.StatusPending {
+		t.Errorf("Ожидался статус pending, получен %q", restored.Status)
+	}
+}
+
+func TestPersistenceSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	posts, comments, p := openPersistent(t, dir)
+	post := createTestPost(t, posts, "Before snapshot")
+	createTestComment(t, comments, post.ID)
+	if err := p.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, journalFileName)); err != nil || info.Size() != 0 {
+		t.Fatalf("Ожидался пустой журнал после снимка: %v, %v", info, err)
+	}
+	createTestComment(t, comments, post.ID)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, comments, p = openPersistent(t, dir)
+	defer p.Close()
+	if all, _ := posts.GetAllPosts(); len(all) != 1 {
+		t.Errorf("Ожидался 1 пост, получено %d", len(all))
+	}
+	if page, _ := comments.GetCommentsByPostID(post.ID, 10, 0); len(page) != 2 {
+		t.Errorf("Ожидалось 2 комментария, получено %d", len(page))
+	}
+}
+
+func TestPersistenceReplayAfterSnapshotIsIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	posts, comments, p := openPersistent(t, dir)
+	post := createTestPost(t, posts, "Test")
+	createTestComment(t, comments, post.ID)
+	createTestComment(t, comments, post.ID)
+	journalPath := filepath.Join(dir, journalFileName)
+	saved, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Имитация сбоя между записью снимка и очисткой журнала
+	if err := os.WriteFile(journalPath, saved, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, comments, p = openPersistent(t, dir)
+	defer p.Close()
+	if page, _ := comments.GetCommentsByPostID(post.ID, 10, 0); len(page) != 2 {
+		t.Errorf("Ожидалось 2 комментария, получено %d", len(page))
+	}
+}
+
+func TestPersistenceTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+	posts, _, p := openPersistent(t, dir)
+	for _, title := range []string{"First", "Second", "Third"} {
+		createTestPost(t, posts, title)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath := filepath.Join(dir, journalFileName)
+	info, err := os.Stat(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(journalPath, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, _, p = openPersistent(t, dir)
+	if all, _ := posts.GetAllPosts(); len(all) != 2 {
+		t.Fatalf("Ожидалось 2 поста после отбрасывания неполной записи, получено %d", len(all))
+	}
+	// Новая запись дописывается после последней целой
+	createTestPost(t, posts, "Third again")
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, _, p = openPersistent(t, dir)
+	defer p.Close()
+	all, _ := posts.GetAllPosts()
+	if len(all) != 3 || all[2].Title != "Third again" {
+		t.Errorf("Ожидалось 3 поста, последний 'Third again', получено %+v", all)
+	}
+}
+
+func TestPersistenceCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	posts, _, p := openPersistent(t, dir)
+	createTestPost(t, posts, "First")
+	createTestPost(t, posts, "Second")
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath := filepath.Join(dir, journalFileName)
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[journalHeaderSize+2] ^= 0xFF
+	if err := os.WriteFile(journalPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, _, err = NewPersistentInMemoryStorage(newPersistenceConfig(dir))
+	if !errors.Is(err, ErrJournalCorrupted) {
+		t.Errorf("Ожидалась ошибка ErrJournalCorrupted, получено %v", err)
+	}
+}
+
+// Длина записи, уходящая за конец файла, не принимается за обрыв,
+// если она больше любой записи журнала
+func TestPersistenceCorruptedLength(t *testing.T) {
+	dir := t.TempDir()
+	posts, _, p := openPersistent(t, dir)
+	createTestPost(t, posts, "First")
+	createTestPost(t, posts, "Second")
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath := filepath.Join(dir, journalFileName)
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0x40
+	if err := os.WriteFile(journalPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, _, err = NewPersistentInMemoryStorage(newPersistenceConfig(dir))
+	if !errors.Is(err, ErrJournalCorrupted) {
+		t.Errorf("Ожидалась ошибка ErrJournalCorrupted, получено %v", err)
+	}
+	if info, _ := os.Stat(journalPath); info.Size() != int64(len(data)) {
+		t.Errorf("Повреждённый журнал не должен обрезаться, размер %d из %d", info.Size(), len(data))
+	}
+}
+
+func TestPersistenceRejectsZeroFsyncInterval(t *testing.T) {
+	cfg := newPersistenceConfig(t.TempDir())
+	cfg.InMemory.Fsync = FsyncInterval
+	if _, _, _, err := NewPersistentInMemoryStorage(cfg); err == nil {
+		t.Error("Ожидалась ошибка для режима interval без fsync_interval")
+	}
+}
+
+func TestPersistenceReactions(t *testing.T) {
+	dir := t.TempDir()
+	posts, comments, p := openPersistent(t, dir)
+	post := createTestPost(t, posts, "Test")
+	comment := createTestComment(t, comments, post.ID)
+	reactions := NewInMemoryReactionStorage(posts, comments)
+	for _, r := range []*models.Reaction{
+		{TargetType: models.ReactionTargetPost, TargetID: post.ID, Author: "alice", Kind: models.ReactionUpvote},
+		{TargetType: models.ReactionTargetPost, TargetID: post.ID, Author: "bob", Kind: models.ReactionUpvote},
+		{TargetType: models.ReactionTargetComment, TargetID: comment.ID, Author: "alice", Kind: "👍"},
+	} {
+		if err := reactions.SetReaction(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	// После снимка изменение попадает только в журнал
+	removedAt := time.Now().Add(time.Hour)
+	if err := reactions.RemoveReaction(&models.Reaction{TargetType: models.ReactionTargetPost, TargetID: post.ID, Author: "bob", CreatedAt: removedAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, comments, p = openPersistent(t, dir)
+	defer p.Close()
+	restored, _ := posts.GetPostByID(post.ID)
+	if len(restored.Reactions) != 1 || restored.Reactions[models.ReactionUpvote] != 1 {
+		t.Errorf("Ожидался 1 upvote у поста, получено %v", restored.Reactions)
+	}
+	if !restored.UpdatedAt.Equal(changedAt(removedAt)) {
+		t.Errorf("Ожидалось время изменения поста %v, получено %v", changedAt(removedAt), restored.UpdatedAt)
+	}
+	page, _ := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if len(page) != 1 || page[0].Reactions["👍"] != 1 {
+		t.Errorf("Ожидалась реакция 👍 у комментария, получено %+v", page)
+	}
+}
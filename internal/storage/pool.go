@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/config"
+)
+
+// PostgresDSN собирает строку подключения к Postgres из конфигурации.
+// Учётные данные и имя базы экранируются, поэтому допускают любые символы.
+// Строку понимают и pgx, и драйвер миграций.
+func PostgresDSN(cfg *config.Config) string {
+	db := cfg.Database
+	query := url.Values{}
+	setIfNotEmpty := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	setIfNotEmpty("sslmode", db.SSLMode)
+	setIfNotEmpty("sslrootcert", db.SSLRootCert)
+	setIfNotEmpty("sslcert", db.SSLCert)
+	setIfNotEmpty("sslkey", db.SSLKey)
+	if db.ConnectTimeout > 0 {
+		// connect_timeout задаётся в целых секундах
+		seconds := int(math.Ceil(db.ConnectTimeout.Seconds()))
+		query.Set("connect_timeout", strconv.Itoa(seconds))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(db.User, db.Password),
+		Host:     net.JoinHostPort(db.Host, db.Port),
+		Path:     "/" + db.DBName,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
+
+func CreateDBPool(cfg *config.Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(PostgresDSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора строки подключения: %w", err)
+	}
+
+	applyPoolSettings(poolConfig, cfg)
+
+	var dbPool *pgxpool.Pool
+	err = retryWithBackoff(cfg, func() error {
+		dbPool, err = pgxpool.ConnectConfig(context.Background(), poolConfig)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
+	}
+
+	return dbPool, nil
+}
+
+// applyPoolSettings переносит настройки database.pool в конфигурацию пула.
+// Нулевые значения оставляют умолчания pgx.
+func applyPoolSettings(poolConfig *pgxpool.Config, cfg *config.Config) {
+	pool := cfg.Database.Pool
+	if pool.MaxConns > 0 {
+		poolConfig.MaxConns = pool.MaxConns
+	}
+	poolConfig.MinConns = pool.MinConns
+	if pool.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = pool.MaxConnLifetime
+	}
+	if pool.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = pool.MaxConnIdleTime
+	}
+	if pool.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = pool.HealthCheckPeriod
+	}
+}
+
+// PoolStats — состояние пула подключений для мониторинга.
+type PoolStats struct {
+	MaxConns             int32         `json:"max_conns"`
+	TotalConns           int32         `json:"total_conns"`
+	AcquiredConns        int32         `json:"acquired_conns"`
+	IdleConns            int32         `json:"idle_conns"`
+	ConstructingConns    int32         `json:"constructing_conns"`
+	AcquireCount         int64         `json:"acquire_count"`
+	EmptyAcquireCount    int64         `json:"empty_acquire_count"`
+	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
+	AcquireDuration      time.Duration `json:"acquire_duration_ns"`
+}
+
+func GetPoolStats(pool *pgxpool.Pool) PoolStats {
+	stat := pool.Stat()
+	return PoolStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
+	}
+}
+
+func waitForDB(cfg *config.Config) error {
+	return retryWithBackoff(cfg, func() error {
+		pool, err := pgxpool.Connect(context.Background(), PostgresDSN(cfg))
+		if err != nil {
+			return err
+		}
+		pool.Close()
+		return nil
+	})
+}
+
+// retryWithBackoff повторяет op с экспоненциально растущей задержкой,
+// пока она не завершится успешно или не истечёт database.retry.max_elapsed_time.
+func retryWithBackoff(cfg *config.Config, op func() error) error {
+	retry := cfg.Database.Retry
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		delay := backoffDelay(retry.InitialInterval, retry.MaxInterval, retry.Multiplier, attempt)
+		if time.Since(start)+delay > retry.MaxElapsedTime {
+			return fmt.Errorf("база данных недоступна после %d попыток: %w", attempt, err)
+		}
+		log.Printf("База данных недоступна, попытка %d, повтор через %v: %v", attempt, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// backoffDelay возвращает задержку перед повтором после попытки attempt (начиная с 1).
+func backoffDelay(initial, max time.Duration, multiplier float64, attempt int) time.Duration {
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if max > 0 && delay > float64(max) {
+		return max
+	}
+	return time.Duration(delay)
+}
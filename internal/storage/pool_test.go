@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"ozon_test/config"
+)
+
+func TestPostgresDSNEscapesCredentials(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Host = "db.local"
+	cfg.Database.Port = "5433"
+	cfg.Database.User = "app user"
+	cfg.Database.Password = "p@ss:w/rd?#%&="
+	cfg.Database.DBName = "my db"
+	cfg.Database.SSLMode = "disable"
+	cfg.Database.ConnectTimeout = 1500 * time.Millisecond
+
+	dsn := PostgresDSN(cfg)
+	parsed, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("Ошибка разбора %q: %v", dsn, err)
+	}
+	if parsed.User != cfg.Database.User || parsed.Password != cfg.Database.Password {
+		t.Errorf("Учётные данные искажены: %q / %q", parsed.User, parsed.Password)
+	}
+	if parsed.Database != cfg.Database.DBName || parsed.Host != "db.local" || parsed.Port != 5433 {
+		t.Errorf("Адрес базы искажён: %s:%d/%s", parsed.Host, parsed.Port, parsed.Database)
+	}
+	if parsed.ConnectTimeout != 2*time.Second {
+		t.Errorf("Ожидался connect_timeout 2s, получено %v", parsed.ConnectTimeout)
+	}
+}
+
+func TestPostgresDSNTLSOptions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Host = "db"
+	cfg.Database.Port = "5432"
+	cfg.Database.SSLMode = "verify-full"
+	cfg.Database.SSLRootCert = "/etc/ssl/root.crt"
+	cfg.Database.SSLCert = "/etc/ssl/client.crt"
+	cfg.Database.SSLKey = "/etc/ssl/client.key"
+
+	u, err := url.Parse(PostgresDSN(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	for key, want := range map[string]string{
+		"sslmode":     "verify-full",
+		"sslrootcert": "/etc/ssl/root.crt",
+		"sslcert":     "/etc/ssl/client.crt",
+		"sslkey":      "/etc/ssl/client.key",
+	} {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s: ожидалось %q, получено %q", key, want, got)
+		}
+	}
+	if query.Has("connect_timeout") {
+		t.Error("Нулевой connect_timeout не должен попадать в строку подключения")
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	initial, max := 100*time.Millisecond, time.Second
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := backoffDelay(initial, max, 2, i+1); got != w*time.Millisecond {
+			t.Errorf("Попытка %d: ожидалась задержка %v, получено %v", i+1, w*time.Millisecond, got)
+		}
+	}
+}
+
+func TestRetryWithBackoffGivesUp(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Retry.InitialInterval = time.Millisecond
+	cfg.Database.Retry.MaxInterval = 4 * time.Millisecond
+	cfg.Database.Retry.Multiplier = 2
+	cfg.Database.Retry.MaxElapsedTime = 20 * time.Millisecond
+
+	attempts := 0
+	err := retryWithBackoff(cfg, func() error {
+		attempts++
+		if attempts == 3 {
+			return nil
+		}
+		return ErrNotFound
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("Ожидался успех на третьей попытке, получено %v после %d попыток", err, attempts)
+	}
+
+	err = retryWithBackoff(cfg, func() error { return ErrNotFound })
+	if err == nil {
+		t.Fatal("Ожидалась ошибка после истечения времени ожидания")
+	}
+}
@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// ReactionStorage хранит реакции на посты и комментарии.
+type ReactionStorage interface {
+	// SetReaction сохраняет реакцию, заменяя прежнюю реакцию автора на ту же
+	// цель, и заполняет reaction.PostID. Реакция того же вида не заменяется
+	// и сохраняет прежнее время. Если цели нет, возвращает ErrNotFound.
+	SetReaction(reaction *models.Reaction) error
+	// RemoveReaction удаляет реакцию reaction.Author на цель и заполняет
+	// reaction.PostID. Если цели или реакции нет, возвращает ErrNotFound.
+	RemoveReaction(reaction *models.Reaction) error
+}
+
+// reactionChangedAt возвращает время изменения реакций цели: время
+// реакции или, если оно не задано, текущее. Счётчики реакций входят в пост
+// и комментарий, поэтому изменение реакции переносит на это время UpdatedAt
+// цели, но не меняет её версию.
+func reactionChangedAt(reaction *models.Reaction) time.Time {
+	if reaction.CreatedAt.IsZero() {
+		return changedAt(time.Now())
+	}
+	return changedAt(reaction.CreatedAt)
+}
+
+// reactionSet хранит реакции на цели одного типа: ID цели → автор → реакция.
+type reactionSet map[int]map[string]*models.Reaction
+
+func (rs reactionSet) set(reaction *models.Reaction) {
+	byAuthor := rs[reaction.TargetID]
+	if byAuthor == nil {
+		byAuthor = make(map[string]*models.Reaction)
+		rs[reaction.TargetID] = byAuthor
+	}
+	// Повторная реакция того же вида сохраняет время первой: иначе каждый
+	// повтор выглядел бы для горячей ленты новой активностью
+	if existing := byAuthor[reaction.Author]; existing != nil && existing.Kind == reaction.Kind {
+		return
+	}
+	clone := *reaction
+	byAuthor[reaction.Author] = &clone
+}
+
+func (rs reactionSet) remove(targetID int, author string) bool {
+	if _, exists := rs[targetID][author]; !exists {
+		return false
+	}
+	delete(rs[targetID], author)
+	if len(rs[targetID]) == 0 {
+		delete(rs, targetID)
+	}
+	return true
+}
+
+func (rs reactionSet) counts(targetID int) map[string]int {
+	counts := make(map[string]int)
+	for _, reaction := range rs[targetID] {
+		counts[reaction.Kind]++
+	}
+	return counts
+}
+
+// votes возвращает число голосов upvote и downvote за цель.
+func (rs reactionSet) votes(targetID int) (ups, downs int) {
+	for _, reaction := range rs[targetID] {
+		switch reaction.Kind {
+		case models.ReactionUpvote:
+			ups++
+		case models.ReactionDownvote:
+			downs++
+		}
+	}
+	return ups, downs
+}
+
+// all возвращает все реакции в постоянном порядке.
+func (rs reactionSet) all() []*models.Reaction {
+	var reactions []*models.Reaction
+	for _, byAuthor := range rs {
+		for _, reaction := range byAuthor {
+			reactions = append(reactions, reaction)
+		}
+	}
+	sort.Slice(reactions, func(i, j int) bool {
+		if reactions[i].TargetID != reactions[j].TargetID {
+			return reactions[i].TargetID < reactions[j].TargetID
+		}
+		return reactions[i].Author < reactions[j].Author
+	})
+	return reactions
+}
+
+// InMemoryReactionStorage хранит реакции в самих in-memory хранилищах
+// постов и комментариев, поэтому счётчики читаются под той же блокировкой,
+// что и цель, и попадают в тот же журнал.
+type InMemoryReactionStorage struct {
+	posts    *InMemoryPostStorage
+	comments *InMemoryCommentStorage
+}
+
+func NewInMemoryReactionStorage(posts *InMemoryPostStorage, comments *InMemoryCommentStorage) *InMemoryReactionStorage {
+	return &InMemoryReactionStorage{posts: posts, comments: comments}
+}
+
+func (s *InMemoryReactionStorage) SetReaction(reaction *models.Reaction) error {
+	switch reaction.TargetType {
+	case models.ReactionTargetPost:
+		return s.posts.changeReaction(opSetReaction, reaction)
+	case models.ReactionTargetComment:
+		return s.comments.changeReaction(opSetReaction, reaction)
+	}
+	return ErrNotFound
+}
+
+func (s *InMemoryReactionStorage) RemoveReaction(reaction *models.Reaction) error {
+	switch reaction.TargetType {
+	case models.ReactionTargetPost:
+		return s.posts.changeReaction(opRemoveReaction, reaction)
+	case models.ReactionTargetComment:
+		return s.comments.changeReaction(opRemoveReaction, reaction)
+	}
+	return ErrNotFound
+}
+
+// changeReaction устанавливает (opSetReaction) или удаляет (opRemoveReaction) реакцию на пост.
+func (s *InMemoryPostStorage) changeReaction(op string, reaction *models.Reaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.posts[reaction.TargetID]; !exists {
+		return ErrNotFound
+	}
+	reaction.PostID = reaction.TargetID
+	if err := applyReaction(s.journal, s.reactions, op, reaction); err != nil {
+		return err
+	}
+	s.touch(reaction.TargetID, reactionChangedAt(reaction))
+	return nil
+}
+
+// touch переносит UpdatedAt поста на at, если оно позже. Вызывается под блокировкой.
+func (s *InMemoryPostStorage) touch(id int, at time.Time) {
+	if post, exists := s.posts[id]; exists && at.After(post.UpdatedAt) {
+		post.UpdatedAt = at
+	}
+}
+
+// changeReaction устанавливает (opSetReaction) или удаляет (opRemoveReaction) реакцию на комментарий.
+func (s *InMemoryCommentStorage) changeReaction(op string, reaction *models.Reaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comment, exists := s.comments[reaction.TargetID]
+	if !exists {
+		return ErrNotFound
+	}
+	reaction.PostID = comment.PostID
+	if err := applyReaction(s.journal, s.reactions, op, reaction); err != nil {
+		return err
+	}
+	s.touch(reaction.TargetID, reactionChangedAt(reaction))
+	return nil
+}
+
+// touch переносит UpdatedAt комментария на at, если оно позже. Вызывается под блокировкой.
+func (s *InMemoryCommentStorage) touch(id int, at time.Time) {
+	if comment, exists := s.comments[id]; exists && at.After(comment.UpdatedAt) {
+		comment.UpdatedAt = at
+	}
+}
+
+// applyReaction пишет изменение в журнал и применяет его. Вызывается под блокировкой хранилища.
+func applyReaction(j *journal, reactions reactionSet, op string, reaction *models.Reaction) error {
+	if op == opRemoveReaction {
+		if _, exists := reactions[reaction.TargetID][reaction.Author]; !exists {
+			return ErrNotFound
+		}
+	}
+	if err := j.append(op, reaction); err != nil {
+		return err
+	}
+	if op == opSetReaction {
+		reactions.set(reaction)
+	} else {
+		reactions.remove(reaction.TargetID, reaction.Author)
+	}
+	return nil
+}
+
+// reactionTable возвращает таблицу реакций цели, её колонку с ID цели
+// и запрос, находящий пост цели.
+func reactionTable(targetType string) (table, column string, postQuery squirrel.SelectBuilder, err error) {
+	switch targetType {
+	case models.ReactionTargetPost:
+		return "post_reactions", "post_id", squirrel.Select("id").From("posts"), nil
+	case models.ReactionTargetComment:
+		return "comment_reactions", "comment_id", squirrel.Select("post_id").From("comments"), nil
+	}
+	return "", "", squirrel.SelectBuilder{}, ErrNotFound
+}
+
+// reactionTargetTables — таблицы целей реакций по их типу.
+var reactionTargetTables = map[string]string{
+	models.ReactionTargetPost:    "posts",
+	models.ReactionTargetComment: "comments",
+}
+
+// touchReactionTarget возвращает UPDATE, переносящий время изменения цели
+// реакции на время изменения её реакций, если оно позже.
+func touchReactionTarget(reaction *models.Reaction) squirrel.UpdateBuilder {
+	at := reactionChangedAt(reaction)
+	return squirrel.Update(reactionTargetTables[reaction.TargetType]).Set("updated_at", at).
+		Where(squirrel.Eq{"id": reaction.TargetID}).Where(squirrel.Lt{"updated_at": at})
+}
+
+// reactionCountsColumn возвращает выражение, собирающее счётчики реакций
+// на строку owner в JSON-объект вида {"upvote": 3}. aggregate — функция
+// сборки объекта в диалекте базы.
+func reactionCountsColumn(aggregate, owner, table, column string) string {
+	return fmt.Sprintf("COALESCE((SELECT %s(kind, n) FROM (SELECT kind, count(*) AS n FROM %s WHERE %s.%s = %s.id GROUP BY kind) counts), '{}')",
+		aggregate, table, table, column, owner)
+}
+
+var (
+	postgresPostReactions    = reactionCountsColumn("json_object_agg", "posts", "post_reactions", "post_id")
+	postgresCommentReactions = reactionCountsColumn("json_object_agg", "comments", "comment_reactions", "comment_id")
+	sqlitePostReactions      = reactionCountsColumn("json_group_object", "posts", "post_reactions", "post_id")
+	sqliteCommentReactions   = reactionCountsColumn("json_group_object", "comments", "comment_reactions", "comment_id")
+)
+
+// decodeReactions разбирает счётчики, выбранные reactionCountsColumn.
+func decodeReactions(raw []byte) (map[string]int, error) {
+	counts := make(map[string]int)
+	if err := json.Unmarshal(raw, &counts); err != nil {
+		return nil, fmt.Errorf("ошибка разбора счётчиков реакций: %w", err)
+	}
+	return counts, nil
+}
+
+type PostgresReactionStorage struct {
+	db pgQuerier
+}
+
+func NewPostgresReactionStorage(pool *pgxpool.Pool) *PostgresReactionStorage {
+	return &PostgresReactionStorage{db: pool}
+}
+
+// targetPostID проверяет, что цель существует, и возвращает её пост.
+func (s *PostgresReactionStorage) targetPostID(postQuery squirrel.SelectBuilder, targetID int) (int, error) {
+	sql, args, err := postQuery.Where(squirrel.Eq{"id": targetID}).PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var postID int
+	if err := s.db.QueryRow(context.Background(), sql, args...).Scan(&postID); err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return postID, nil
+}
+
+func (s *PostgresReactionStorage) SetReaction(reaction *models.Reaction) error {
+	table, column, postQuery, err := reactionTable(reaction.TargetType)
+	if err != nil {
+		return err
+	}
+	if reaction.PostID, err = s.targetPostID(postQuery, reaction.TargetID); err != nil {
+		return err
+	}
+
+	query := squirrel.Insert(table).Columns(column, "author", "kind", "created_at").
+		Values(reaction.TargetID, reaction.Author, reaction.Kind, reaction.CreatedAt).
+		Suffix(fmt.Sprintf("ON CONFLICT (%[2]s, author) DO UPDATE SET kind = EXCLUDED.kind, created_at = EXCLUDED.created_at "+
+			"WHERE %[1]s.kind <> EXCLUDED.kind", table, column)).
+		PlaceholderFormat(squirrel.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = s.db.Exec(context.Background(), sql, args...); err != nil {
+		return err
+	}
+	return s.touch(reaction)
+}
+
+// touch переносит время изменения цели реакции (см. touchReactionTarget).
+func (s *PostgresReactionStorage) touch(reaction *models.Reaction) error {
+	sql, args, err := touchReactionTarget(reaction).PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(context.Background(), sql, args...)
+	return err
+}
+
+func (s *PostgresReactionStorage) RemoveReaction(reaction *models.Reaction) error {
+	table, column, postQuery, err := reactionTable(reaction.TargetType)
+	if err != nil {
+		return err
+	}
+	if reaction.PostID, err = s.targetPostID(postQuery, reaction.TargetID); err != nil {
+		return err
+	}
+
+	query := squirrel.Delete(table).Where(squirrel.Eq{column: reaction.TargetID, "author": reaction.Author}).
+		PlaceholderFormat(squirrel.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(context.Background(), sql, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return s.touch(reaction)
+}
+
+type SQLiteReactionStorage struct {
+	db sqlQuerier
+}
+
+func NewSQLiteReactionStorage(db *sql.DB) *SQLiteReactionStorage {
+	return &SQLiteReactionStorage{db: db}
+}
+
+func (s *SQLiteReactionStorage) targetPostID(postQuery squirrel.SelectBuilder, targetID int) (int, error) {
+	sqlStr, args, err := postQuery.Where(squirrel.Eq{"id": targetID}).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var postID int
+	if err := s.db.QueryRow(sqlStr, args...).Scan(&postID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return postID, nil
+}
+
+func (s *SQLiteReactionStorage) SetReaction(reaction *models.Reaction) error {
+	table, column, postQuery, err := reactionTable(reaction.TargetType)
+	if err != nil {
+		return err
+	}
+	if reaction.PostID, err = s.targetPostID(postQuery, reaction.TargetID); err != nil {
+		return err
+	}
+
+	query := squirrel.Insert(table).Columns(column, "author", "kind", "created_at").
+		Values(reaction.TargetID, reaction.Author, reaction.Kind, reaction.CreatedAt).
+		Suffix(fmt.Sprintf("ON CONFLICT (%[2]s, author) DO UPDATE SET kind = excluded.kind, created_at = excluded.created_at "+
+			"WHERE %[1]s.kind <> excluded.kind", table, column))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = s.db.Exec(sqlStr, args...); err != nil {
+		return err
+	}
+	return s.touch(reaction)
+}
+
+// touch переносит время изменения цели реакции (см. touchReactionTarget).
+func (s *SQLiteReactionStorage) touch(reaction *models.Reaction) error {
+	sqlStr, args, err := touchReactionTarget(reaction).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(sqlStr, args...)
+	return err
+}
+
+func (s *SQLiteReactionStorage) RemoveReaction(reaction *models.Reaction) error {
+	table, column, postQuery, err := reactionTable(reaction.TargetType)
+	if err != nil {
+		return err
+	}
+	if reaction.PostID, err = s.targetPostID(postQuery, reaction.TargetID); err != nil {
+		return err
+	}
+
+	query := squirrel.Delete(table).Where(squirrel.Eq{column: reaction.TargetID, "author": reaction.Author})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(sqlStr, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return s.touch(reaction)
+}
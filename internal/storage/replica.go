@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/config"
+)
+
+// ReplicaSet распределяет читающие запросы между репликами Postgres по кругу.
+// Реплика, вернувшая ошибку подключения или не ответившая на проверку,
+// исключается из ротации, пока фоновая проверка не увидит её снова живой.
+// Если здоровых реплик нет, чтение идёт в primary.
+//
+// На реплики уходят только чтения вне транзакций. Запись и чтение после
+// записи в рамках одного запроса выполняются в транзакции (см. TxManager),
+// то есть всегда на primary, поэтому отставание реплик им не мешает.
+type ReplicaSet struct {
+	primary  pgQuerier
+	replicas []*replica
+	next     atomic.Uint64
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type replica struct {
+	name    string
+	db      pgQuerier
+	ping    func(ctx context.Context) error
+	close   func()
+	healthy atomic.Bool
+	reads   atomic.Int64
+}
+
+// ReplicaStats — состояние реплики для мониторинга.
+type ReplicaStats struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Reads   int64  `json:"reads"`
+}
+
+// NewReplicaSet подключается к репликам из database.replicas.dsns.
+// Подключения ленивые: недоступная при запуске реплика не мешает старту,
+// а просто остаётся вне ротации до первой успешной проверки.
+func NewReplicaSet(cfg *config.Config, primary *pgxpool.Pool) (*ReplicaSet, error) {
+	var replicas []*replica
+	closeAll := func() {
+		for _, r := range replicas {
+			r.close()
+		}
+	}
+	for i, dsn := range cfg.Database.Replicas.DSNs {
+		poolConfig, err := pgxpool.ParseConfig(dsn)
+		if err != nil {
+			closeAll()
+			// Сама строка не выводится: в ней может быть пароль
+			return nil, fmt.Errorf("ошибка разбора строки подключения реплики %d: %w", i+1, err)
+		}
+		applyPoolSettings(poolConfig, cfg)
+		poolConfig.LazyConnect = true
+
+		pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("ошибка создания пула реплики %d: %w", i+1, err)
+		}
+		replicas = append(replicas, &replica{
+			name:  net.JoinHostPort(poolConfig.ConnConfig.Host, strconv.Itoa(int(poolConfig.ConnConfig.Port))),
+			db:    pool,
+			ping:  pool.Ping,
+			close: pool.Close,
+		})
+	}
+	return newReplicaSet(primary, replicas, cfg.Database.Replicas.HealthCheckInterval), nil
+}
+
+func newReplicaSet(primary pgQuerier, replicas []*replica, interval time.Duration) *ReplicaSet {
+	s := &ReplicaSet{
+		primary:  primary,
+		replicas: replicas,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	s.checkHealth()
+	if interval > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.checkHealth()
+				case <-s.stop:
+					return
+				}
+			}
+		}()
+	}
+	return s
+}
+
+// Reader возвращает pgQuerier, который читает с реплик, а пишет в primary.
+func (s *ReplicaSet) Reader() pgQuerier {
+	return replicaRouter{set: s}
+}
+
+// Stats возвращает состояние реплик в порядке их перечисления в конфигурации.
+func (s *ReplicaSet) Stats() []ReplicaStats {
+	stats := make([]ReplicaStats, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		stats = append(stats, ReplicaStats{Name: r.name, Healthy: r.healthy.Load(), Reads: r.reads.Load()})
+	}
+	return stats
+}
+
+// Close останавливает проверки и закрывает пулы реплик. Primary не закрывается.
+func (s *ReplicaSet) Close() {
+	close(s.stop)
+	s.wg.Wait()
+	for _, r := range s.replicas {
+		r.close()
+	}
+}
+
+// pick возвращает следующую здоровую реплику или nil, если таких нет.
+func (s *ReplicaSet) pick() *replica {
+	n := uint64(len(s.replicas))
+	if n == 0 {
+		return nil
+	}
+	start := s.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *ReplicaSet) checkHealth() {
+	timeout := s.interval
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.ping(ctx)
+		cancel()
+		if err != nil {
+			r.eject(err)
+		} else if !r.healthy.Swap(true) {
+			log.Printf("Реплика %s доступна, возвращена в ротацию", r.name)
+		}
+	}
+}
+
+func (r *replica) eject(err error) {
+	if r.healthy.Swap(false) {
+		log.Printf("Реплика %s исключена из ротации: %v", r.name, err)
+	}
+}
+
+// isConnError сообщает, что ошибка вызвана недоступностью сервера, а не
+// самим запросом: сбой до отправки запроса (pgconn.SafeToRetry), сетевая
+// ошибка, обрыв соединения или неудачное подключение. Остальные ошибки —
+// ответ Postgres, отсутствие строк, ошибка разбора результата, отмена
+// контекста вызывающей стороной — реплику не компрометируют.
+func isConnError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var retryable interface{ SafeToRetry() bool }
+	if errors.As(err, &retryable) && retryable.SafeToRetry() {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// Тип ошибки подключения pgconn не экспортирует, а причиной может быть
+	// и ответ сервера (например, отказ в аутентификации)
+	return strings.HasPrefix(err.Error(), "failed to connect to")
+}
+
+// replicaRouter направляет Query и QueryRow на реплику, а Exec — в primary.
+// При ошибке подключения реплика исключается, а запрос повторяется на primary.
+type replicaRouter struct {
+	set *ReplicaSet
+}
+
+func (rr replicaRouter) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return rr.set.primary.Exec(ctx, sql, args...)
+}
+
+func (rr replicaRouter) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	r := rr.set.pick()
+	if r == nil {
+		return rr.set.primary.Query(ctx, sql, args...)
+	}
+	r.reads.Add(1)
+	rows, err := r.db.Query(ctx, sql, args...)
+	if isConnError(err) {
+		r.eject(err)
+		return rr.set.primary.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
+
+func (rr replicaRouter) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return &replicaRow{set: rr.set, ctx: ctx, sql: sql, args: args}
+}
+
+// replicaRow откладывает выполнение запроса до Scan, чтобы при ошибке
+// подключения повторить его на primary.
+type replicaRow struct {
+	set  *ReplicaSet
+	ctx  context.Context
+	sql  string
+	args []interface{}
+}
+
+func (row *replicaRow) Scan(dest ...interface{}) error {
+	r := row.set.pick()
+	if r == nil {
+		return row.set.primary.QueryRow(row.ctx, row.sql, row.args...).Scan(dest...)
+	}
+	r.reads.Add(1)
+	err := r.db.QueryRow(row.ctx, row.sql, row.args...).Scan(dest...)
+	if isConnError(err) {
+		r.eject(err)
+		return row.set.primary.QueryRow(row.ctx, row.sql, row.args...).Scan(dest...)
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// fakeQuerier считает обращения и возвращает заданную ошибку.
+type fakeQuerier struct {
+	queries atomic.Int64
+	execs   atomic.Int64
+	err     error
+	pingErr error
+}
+
+type fakeRow struct{ err error }
+
+func (r fakeRow) Scan(dest ...interface{}) error { return r.err }
+
+func (q *fakeQuerier) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	q.execs.Add(1)
+	return nil, q.err
+}
+
+func (q *fakeQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	q.queries.Add(1)
+	return nil, q.err
+}
+
+func (q *fakeQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	q.queries.Add(1)
+	return fakeRow{err: q.err}
+}
+
+func newFakeReplica(name string, db *fakeQuerier) *replica {
+	return &replica{
+		name:  name,
+		db:    db,
+		ping:  func(ctx context.Context) error { return db.pingErr },
+		close: func() {},
+	}
+}
+
+func TestReplicaSetRoundRobin(t *testing.T) {
+	primary, first, second := &fakeQuerier{}, &fakeQuerier{}, &fakeQuerier{}
+	set := newReplicaSet(primary, []*replica{newFakeReplica("first", first), newFakeReplica("second", second)}, 0)
+	defer set.Close()
+	reader := set.Reader()
+
+	for i := 0; i < 4; i++ {
+		if _, err := reader.Query(context.Background(), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := reader.QueryRow(context.Background(), "SELECT 1").Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Exec(context.Background(), "UPDATE posts SET title = ''"); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.queries.Load() != 3 || second.queries.Load() != 2 {
+		t.Errorf("Ожидалось 3 и 2 чтения с реплик, получено %d и %d", first.queries.Load(), second.queries.Load())
+	}
+	if primary.queries.Load() != 0 || primary.execs.Load() != 1 {
+		t.Errorf("Ожидалась только запись в primary, получено %d чтений и %d записей",
+			primary.queries.Load(), primary.execs.Load())
+	}
+}
+
+func TestReplicaSetEjectsOnConnectionError(t *testing.T) {
+	primary, broken := &fakeQuerier{}, &fakeQuerier{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	set := newReplicaSet(primary, []*replica{newFakeReplica("broken", broken)}, 0)
+	defer set.Close()
+	reader := set.Reader()
+
+	if err := reader.QueryRow(context.Background(), "SELECT 1").Scan(); err != nil {
+		t.Fatalf("Ожидался повтор на primary без ошибки, получено %v", err)
+	}
+	if _, err := reader.Query(context.Background(), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if broken.queries.Load() != 1 || primary.queries.Load() != 2 {
+		t.Errorf("Ожидалось 1 чтение с реплики и 2 с primary, получено %d и %d",
+			broken.queries.Load(), primary.queries.Load())
+	}
+	if stats := set.Stats(); stats[0].Healthy {
+		t.Error("Реплика должна быть исключена из ротации")
+	}
+
+	// Проверка здоровья возвращает реплику в ротацию
+	broken.err = nil
+	set.checkHealth()
+	if _, err := reader.Query(context.Background(), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if broken.queries.Load() != 2 {
+		t.Errorf("Ожидалось чтение с восстановленной реплики, получено %d", broken.queries.Load())
+	}
+}
+
+func TestReplicaSetKeepsReplicaOnQueryError(t *testing.T) {
+	primary := &fakeQuerier{}
+	replicaDB := &fakeQuerier{err: pgx.ErrNoRows}
+	set := newReplicaSet(primary, []*replica{newFakeReplica("replica", replicaDB)}, 0)
+	defer set.Close()
+
+	err := set.Reader().QueryRow(context.Background(), "SELECT 1").Scan()
+	if !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Ожидалась ошибка pgx.ErrNoRows, получено %v", err)
+	}
+	replicaDB.err = &pgconn.PgError{Code: "42P01"}
+	if _, err := set.Reader().Query(context.Background(), "SELECT 1"); err == nil {
+		t.Error("Ожидалась ошибка запроса")
+	}
+	// Ошибка разбора результата возвращается как есть, без повтора на primary
+	scanErr := errors.New("can't scan into dest[0]: cannot convert")
+	replicaDB.err = scanErr
+	if err := set.Reader().QueryRow(context.Background(), "SELECT 1").Scan(); !errors.Is(err, scanErr) {
+		t.Errorf("Ожидалась ошибка разбора, получено %v", err)
+	}
+	if primary.queries.Load() != 0 || !set.Stats()[0].Healthy {
+		t.Error("Ошибка запроса не должна исключать реплику")
+	}
+}
+
+func TestReplicaSetFailedHealthCheck(t *testing.T) {
+	primary, down := &fakeQuerier{}, &fakeQuerier{pingErr: errors.New("timeout")}
+	set := newReplicaSet(primary, []*replica{newFakeReplica("down", down)}, 0)
+	defer set.Close()
+
+	if _, err := set.Reader().Query(context.Background(), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if down.queries.Load() != 0 || primary.queries.Load() != 1 {
+		t.Errorf("Ожидалось чтение с primary, получено %d с реплики и %d с primary",
+			down.queries.Load(), primary.queries.Load())
+	}
+}
+
+func TestIsConnError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"сеть", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{"обрыв", fmt.Errorf("receive message: %w", io.ErrUnexpectedEOF), true},
+		{"подключение", errors.New("failed to connect to `host=replica user=app database=app`: server error"), true},
+		{"ответ сервера", &pgconn.PgError{Code: "42P01"}, false},
+		{"нет строк", pgx.ErrNoRows, false},
+		{"разбор", errors.New("can't scan into dest[0]"), false},
+		{"отмена", context.Canceled, false},
+	} {
+		if got := isConnError(tc.err); got != tc.want {
+			t.Errorf("%s: ожидалось %v, получено %v", tc.name, tc.want, got)
+		}
+	}
+}
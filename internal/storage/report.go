@@ -0,0 +1,630 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// ReportStorage хранит жалобы на посты и комментарии.
+type ReportStorage interface {
+	// CreateReport сохраняет жалобу и заполняет report.PostID. Если открытых
+	// жалоб на цель стало не меньше hideAt (ноль отключает скрытие), одобренная
+	// цель переводится в статус pending, а жалоба отмечается report.HidTarget;
+	// hidden сообщает, что это произошло.
+	// Если цели нет, возвращает ErrNotFound, если reporter уже жаловался
+	// на неё — ErrDuplicateReport.
+	CreateReport(report *models.Report, hideAt int) (hidden bool, err error)
+	// GetOpenReports возвращает страницу открытых жалоб, старые первыми.
+	GetOpenReports(limit, offset int) ([]*models.Report, error)
+	// ResolveReports закрывает открытые жалобы на цель решением resolution
+	// и в той же транзакции применяет его к цели (см. resolvedStatus).
+	// Возвращает число закрытых жалоб и ID поста, к которому относится цель.
+	// Если открытых жалоб нет, возвращает ErrNotFound.
+	ResolveReports(targetType string, targetID int, resolution, moderator string) (resolved, postID int, err error)
+}
+
+// reportSet хранит жалобы на цели одного типа: ID цели → автор жалобы → жалоба.
+type reportSet map[int]map[string]*models.Report
+
+func (rs reportSet) add(report *models.Report) {
+	byReporter := rs[report.TargetID]
+	if byReporter == nil {
+		byReporter = make(map[string]*models.Report)
+		rs[report.TargetID] = byReporter
+	}
+	clone := *report
+	byReporter[report.Reporter] = &clone
+}
+
+// open возвращает число открытых жалоб на цель.
+func (rs reportSet) open(targetID int) int {
+	n := 0
+	for _, report := range rs[targetID] {
+		if report.Resolution == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// hidden сообщает, скрыта ли цель одной из открытых жалоб.
+func (rs reportSet) hidden(targetID int) bool {
+	for _, report := range rs[targetID] {
+		if report.Resolution == "" && report.HidTarget {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvedStatus возвращает статус цели со статусом status после решения
+// resolution или пустую строку, если статус не меняется. remove отклоняет
+// цель; dismiss возвращает одобрение, только если цель скрыли открытые
+// жалобы (hidden) и модератор ещё не решил её судьбу в очереди модерации.
+func resolvedStatus(resolution, status string, hidden bool) string {
+	switch {
+	case resolution == models.ReportRemove && status != models.StatusRejected:
+		return models.StatusRejected
+	case resolution == models.ReportDismiss && hidden && status == models.StatusPending:
+		return models.StatusApproved
+	}
+	return ""
+}
+
+// resolve закрывает открытые жалобы на цель решением из resolution.
+func (rs reportSet) resolve(resolution *models.Report) {
+	for _, report := range rs[resolution.TargetID] {
+		if report.Resolution == "" {
+			report.Resolution = resolution.Resolution
+			report.ResolvedBy = resolution.ResolvedBy
+		}
+	}
+}
+
+// collect возвращает копии жалоб, отобранных filter.
+func (rs reportSet) collect(filter func(*models.Report) bool) []*models.Report {
+	var reports []*models.Report
+	for _, byReporter := range rs {
+		for _, report := range byReporter {
+			if filter(report) {
+				clone := *report
+				reports = append(reports, &clone)
+			}
+		}
+	}
+	return reports
+}
+
+// sortReports упорядочивает жалобы по времени создания, затем по цели и автору.
+func sortReports(reports []*models.Report) {
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.TargetType != b.TargetType {
+			return a.TargetType > b.TargetType
+		}
+		if a.TargetID != b.TargetID {
+			return a.TargetID < b.TargetID
+		}
+		return a.Reporter < b.Reporter
+	})
+}
+
+func pageReports(reports []*models.Report, limit, offset int) []*models.Report {
+	limit, offset = normalizePage(limit, offset)
+	if offset >= len(reports) {
+		return []*models.Report{}
+	}
+	end := offset + limit
+	if end > len(reports) {
+		end = len(reports)
+	}
+	return reports[offset:end]
+}
+
+// InMemoryReportStorage хранит жалобы в самих in-memory хранилищах постов
+// и комментариев: жалоба и скрытие цели выполняются под одной блокировкой
+// и попадают в тот же журнал.
+type InMemoryReportStorage struct {
+	posts    *InMemoryPostStorage
+	comments *InMemoryCommentStorage
+}
+
+func NewInMemoryReportStorage(posts *InMemoryPostStorage, comments *InMemoryCommentStorage) *InMemoryReportStorage {
+	return &InMemoryReportStorage{posts: posts, comments: comments}
+}
+
+func (s *InMemoryReportStorage) CreateReport(report *models.Report, hideAt int) (bool, error) {
+	switch report.TargetType {
+	case models.ReportTargetPost:
+		return s.posts.createReport(report, hideAt)
+	case models.ReportTargetComment:
+		return s.comments.createReport(report, hideAt)
+	}
+	return false, ErrNotFound
+}
+
+func (s *InMemoryReportStorage) GetOpenReports(limit, offset int) ([]*models.Report, error) {
+	open := func(report *models.Report) bool { return report.Resolution == "" }
+	s.posts.mu.RLock()
+	reports := s.posts.reports.collect(open)
+	s.posts.mu.RUnlock()
+	s.comments.mu.RLock()
+	reports = append(reports, s.comments.reports.collect(open)...)
+	s.comments.mu.RUnlock()
+
+	sortReports(reports)
+	return pageReports(reports, limit, offset), nil
+}
+
+func (s *InMemoryReportStorage) ResolveReports(targetType string, targetID int, resolution, moderator string) (int, int, error) {
+	r := &models.Report{TargetType: targetType, TargetID: targetID, Resolution: resolution, ResolvedBy: moderator}
+	switch targetType {
+	case models.ReportTargetPost:
+		return s.posts.resolveReports(r)
+	case models.ReportTargetComment:
+		return s.comments.resolveReports(r)
+	}
+	return 0, 0, ErrNotFound
+}
+
+func (s *InMemoryPostStorage) createReport(report *models.Report, hideAt int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, exists := s.posts[report.TargetID]
+	if !exists {
+		return false, ErrNotFound
+	}
+	report.PostID = post.ID
+	return applyReport(s.journal, s.reports, report, hideAt, post.Status, func() error {
+		return s.writeStatus(post, models.StatusPending)
+	})
+}
+
+func (s *InMemoryCommentStorage) createReport(report *models.Report, hideAt int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comment, exists := s.comments[report.TargetID]
+	if !exists {
+		return false, ErrNotFound
+	}
+	report.PostID = comment.PostID
+	return applyReport(s.journal, s.reports, report, hideAt, comment.Status, func() error {
+		return s.writeStatus(comment, models.StatusPending)
+	})
+}
+
+// resolveReports закрывает жалобы на пост и применяет решение к нему
+// под одной блокировкой.
+func (s *InMemoryPostStorage) resolveReports(resolution *models.Report) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, exists := s.posts[resolution.TargetID]
+	if !exists {
+		return 0, 0, ErrNotFound
+	}
+	n, status, err := applyResolution(s.journal, s.reports, resolution, post.Status)
+	if err == nil && status != "" {
+		err = s.writeStatus(post, status)
+	}
+	return n, post.ID, err
+}
+
+// resolveReports закрывает жалобы на комментарий и применяет решение
+// к нему под одной блокировкой.
+func (s *InMemoryCommentStorage) resolveReports(resolution *models.Report) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comment, exists := s.comments[resolution.TargetID]
+	if !exists {
+		return 0, 0, ErrNotFound
+	}
+	n, status, err := applyResolution(s.journal, s.reports, resolution, comment.Status)
+	if err == nil && status != "" {
+		err = s.writeStatus(comment, status)
+	}
+	return n, comment.PostID, err
+}
+
+// applyReport пишет жалобу в журнал, сохраняет её и при достижении порога
+// скрывает одобренную цель через hide. Вызывается под блокировкой хранилища.
+func applyReport(j *journal, reports reportSet, report *models.Report, hideAt int, status string, hide func() error) (bool, error) {
+	if _, exists := reports[report.TargetID][report.Reporter]; exists {
+		return false, ErrDuplicateReport
+	}
+	report.HidTarget = hideAt > 0 && status == models.StatusApproved && reports.open(report.TargetID)+1 >= hideAt
+	if err := j.append(opCreateReport, report); err != nil {
+		return false, err
+	}
+	reports.add(report)
+	if !report.HidTarget {
+		return false, nil
+	}
+	return true, hide()
+}
+
+// applyResolution пишет решение в журнал, закрывает им открытые жалобы
+// на цель со статусом status и возвращает их число и новый статус цели
+// (см. resolvedStatus). Вызывается под блокировкой хранилища.
+func applyResolution(j *journal, reports reportSet, resolution *models.Report, status string) (int, string, error) {
+	n := reports.open(resolution.TargetID)
+	if n == 0 {
+		return 0, "", ErrNotFound
+	}
+	next := resolvedStatus(resolution.Resolution, status, reports.hidden(resolution.TargetID))
+	if err := j.append(opResolveReports, resolution); err != nil {
+		return 0, "", err
+	}
+	reports.resolve(resolution)
+	return n, next, nil
+}
+
+// reportTables возвращает таблицу жалоб цели, её колонку с ID цели,
+// таблицу самой цели и колонку цели с ID её поста.
+func reportTables(targetType string) (table, column, targetTable, postColumn string, err error) {
+	switch targetType {
+	case models.ReportTargetPost:
+		return "post_reports", "post_id", "posts", "id", nil
+	case models.ReportTargetComment:
+		return "comment_reports", "comment_id", "comments", "post_id", nil
+	}
+	return "", "", "", "", ErrNotFound
+}
+
+const openReportsQuery = `
+SELECT 'post' AS type, r.post_id AS target_id, r.post_id, r.reporter, r.reason, r.text, r.created_at, r.hid_target
+FROM post_reports r WHERE r.resolution = ''
+UNION ALL
+SELECT 'comment', r.comment_id, c.post_id, r.reporter, r.reason, r.text, r.created_at, r.hid_target
+FROM comment_reports r JOIN comments c ON c.id = r.comment_id WHERE r.resolution = ''`
+
+func scanReport(scan func(dest ...interface{}) error) (*models.Report, error) {
+	report := &models.Report{}
+	err := scan(&report.TargetType, &report.TargetID, &report.PostID, &report.Reporter,
+		&report.Reason, &report.Text, &report.CreatedAt, &report.HidTarget)
+	return report, err
+}
+
+type PostgresReportStorage struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresReportStorage(pool *pgxpool.Pool) *PostgresReportStorage {
+	return &PostgresReportStorage{pool: pool}
+}
+
+// CreateReport блокирует строку цели до конца транзакции, поэтому
+// одновременные жалобы подсчитываются по очереди.
+func (s *PostgresReportStorage) CreateReport(report *models.Report, hideAt int) (bool, error) {
+	table, column, targetTable, postColumn, err := reportTables(report.TargetType)
+	if err != nil {
+		return false, err
+	}
+	ctx := context.Background()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback(ctx)
+
+	sql, args, err := squirrel.Select(postColumn, "status").From(targetTable).Where(squirrel.Eq{"id": report.TargetID}).
+		Suffix("FOR UPDATE").PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return false, err
+	}
+	var status string
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&report.PostID, &status); err != nil {
+		if err == pgx.ErrNoRows {
+			return false, ErrNotFound
+		}
+		return false, err
+	}
+
+	// Порог проверяется до вставки, чтобы отметить жалобу, скрывшую цель
+	report.HidTarget = false
+	if hideAt > 0 && status == models.StatusApproved {
+		sql, args, err = squirrel.Select("count(*)").From(table).Where(squirrel.Eq{column: report.TargetID, "resolution": ""}).
+			PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return false, err
+		}
+		var open int
+		if err := tx.QueryRow(ctx, sql, args...).Scan(&open); err != nil {
+			return false, err
+		}
+		report.HidTarget = open+1 >= hideAt
+	}
+
+	sql, args, err = squirrel.Insert(table).Columns(column, "reporter", "reason", "text", "created_at", "hid_target").
+		Values(report.TargetID, report.Reporter, report.Reason, report.Text, report.CreatedAt, report.HidTarget).
+		Suffix("ON CONFLICT DO NOTHING").PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, err
+	}
+	if result.RowsAffected() == 0 {
+		return false, ErrDuplicateReport
+	}
+
+	if report.HidTarget {
+		sql, args, err = touch(squirrel.Update(targetTable).Set("status", models.StatusPending), changedAt(time.Now())).
+			Where(squirrel.Eq{"id": report.TargetID}).PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return false, err
+		}
+	}
+	return report.HidTarget, tx.Commit(ctx)
+}
+
+func (s *PostgresReportStorage) GetOpenReports(limit, offset int) ([]*models.Report, error) {
+	limit, offset = normalizePage(limit, offset)
+	rows, err := s.pool.Query(context.Background(),
+		openReportsQuery+"\nORDER BY created_at, type DESC, target_id, reporter LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*models.Report{}
+	for rows.Next() {
+		report, err := scanReport(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// ResolveReports блокирует строку цели, как CreateReport: жалоба,
+// скрывающая цель, не может вклиниться между закрытием жалоб и сменой статуса.
+func (s *PostgresReportStorage) ResolveReports(targetType string, targetID int, resolution, moderator string) (int, int, error) {
+	table, column, targetTable, postColumn, err := reportTables(targetType)
+	if err != nil {
+		return 0, 0, err
+	}
+	ctx := context.Background()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := squirrel.Select(postColumn, "status").From(targetTable).Where(squirrel.Eq{"id": targetID}).
+		Suffix("FOR UPDATE").PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+	var postID int
+	var status string
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&postID, &status); err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, 0, ErrNotFound
+		}
+		return 0, 0, err
+	}
+
+	sql, args, err = squirrel.Update(table).Set("resolution", resolution).Set("resolved_by", moderator).
+		Where(squirrel.Eq{column: targetID, "resolution": ""}).Suffix("RETURNING hid_target").
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, hidden := 0, false
+	for rows.Next() {
+		var hid bool
+		if err := rows.Scan(&hid); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		n++
+		hidden = hidden || hid
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if n == 0 {
+		return 0, 0, ErrNotFound
+	}
+
+	if next := resolvedStatus(resolution, status, hidden); next != "" {
+		sql, args, err = touch(squirrel.Update(targetTable).Set("status", next), changedAt(time.Now())).
+			Where(squirrel.Eq{"id": targetID}).PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return 0, 0, err
+		}
+	}
+	return n, postID, tx.Commit(ctx)
+}
+
+type SQLiteReportStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteReportStorage(db *sql.DB) *SQLiteReportStorage {
+	return &SQLiteReportStorage{db: db}
+}
+
+// CreateReport выполняется в транзакции: SQLite блокирует базу на запись
+// с её начала, поэтому одновременные жалобы подсчитываются по очереди.
+func (s *SQLiteReportStorage) CreateReport(report *models.Report, hideAt int) (bool, error) {
+	table, column, targetTable, postColumn, err := reportTables(report.TargetType)
+	if err != nil {
+		return false, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	sqlStr, args, err := squirrel.Select(postColumn, "status").From(targetTable).Where(squirrel.Eq{"id": report.TargetID}).ToSql()
+	if err != nil {
+		return false, err
+	}
+	var status string
+	if err := tx.QueryRow(sqlStr, args...).Scan(&report.PostID, &status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNotFound
+		}
+		return false, err
+	}
+
+	// Порог проверяется до вставки, чтобы отметить жалобу, скрывшую цель
+	report.HidTarget = false
+	if hideAt > 0 && status == models.StatusApproved {
+		sqlStr, args, err = squirrel.Select("count(*)").From(table).Where(squirrel.Eq{column: report.TargetID, "resolution": ""}).ToSql()
+		if err != nil {
+			return false, err
+		}
+		var open int
+		if err := tx.QueryRow(sqlStr, args...).Scan(&open); err != nil {
+			return false, err
+		}
+		report.HidTarget = open+1 >= hideAt
+	}
+
+	sqlStr, args, err = squirrel.Insert(table).Columns(column, "reporter", "reason", "text", "created_at", "hid_target").
+		Values(report.TargetID, report.Reporter, report.Reason, report.Text, report.CreatedAt, report.HidTarget).
+		Suffix("ON CONFLICT DO NOTHING").ToSql()
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(sqlStr, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, ErrDuplicateReport
+	}
+
+	if report.HidTarget {
+		sqlStr, args, err = touch(squirrel.Update(targetTable).Set("status", models.StatusPending), changedAt(time.Now())).
+			Where(squirrel.Eq{"id": report.TargetID}).ToSql()
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(sqlStr, args...); err != nil {
+			return false, err
+		}
+	}
+	return report.HidTarget, tx.Commit()
+}
+
+// GetOpenReports упорядочивает жалобы после чтения: created_at
+// в SQLite хранится строкой в формате, зависящем от часового пояса.
+func (s *SQLiteReportStorage) GetOpenReports(limit, offset int) ([]*models.Report, error) {
+	rows, err := s.db.Query(openReportsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*models.Report{}
+	for rows.Next() {
+		report, err := scanReport(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortReports(reports)
+	return pageReports(reports, limit, offset), nil
+}
+
+// ResolveReports выполняется в транзакции, как CreateReport.
+func (s *SQLiteReportStorage) ResolveReports(targetType string, targetID int, resolution, moderator string) (int, int, error) {
+	table, column, targetTable, postColumn, err := reportTables(targetType)
+	if err != nil {
+		return 0, 0, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	sqlStr, args, err := squirrel.Select(postColumn, "status").From(targetTable).Where(squirrel.Eq{"id": targetID}).ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+	var postID int
+	var status string
+	if err := tx.QueryRow(sqlStr, args...).Scan(&postID, &status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, ErrNotFound
+		}
+		return 0, 0, err
+	}
+
+	sqlStr, args, err = squirrel.Update(table).Set("resolution", resolution).Set("resolved_by", moderator).
+		Where(squirrel.Eq{column: targetID, "resolution": ""}).Suffix("RETURNING hid_target").ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+	rows, err := tx.Query(sqlStr, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, hidden := 0, false
+	for rows.Next() {
+		var hid bool
+		if err := rows.Scan(&hid); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		n++
+		hidden = hidden || hid
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if n == 0 {
+		return 0, 0, ErrNotFound
+	}
+
+	if next := resolvedStatus(resolution, status, hidden); next != "" {
+		sqlStr, args, err = touch(squirrel.Update(targetTable).Set("status", next), changedAt(time.Now())).
+			Where(squirrel.Eq{"id": targetID}).ToSql()
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.Exec(sqlStr, args...); err != nil {
+			return 0, 0, err
+		}
+	}
+	return n, postID, tx.Commit()
+}
@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// Веса совпадений в заголовке и тексте поста, как у весов A и B в ts_rank Postgres.
+const (
+	titleSearchWeight = 1.0
+	textSearchWeight  = 0.4
+	// Число слов во фрагменте с подсветкой
+	snippetWords = 20
+)
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// searchTerms разбивает текст на слова в нижнем регистре так же, как
+// конфигурация simple в Postgres: без стемминга и стоп-слов.
+func searchTerms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !isWordRune(r) })
+}
+
+// sortSearchResults упорядочивает результаты одинаково во всех хранилищах:
+// по убыванию релевантности, при равенстве — посты раньше комментариев, затем по ID.
+func sortSearchResults(results []*models.SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if a.Type != b.Type {
+			return a.Type == models.SearchResultPost
+		}
+		return a.ID < b.ID
+	})
+}
+
+type searchKey struct {
+	kind string
+	id   int
+}
+
+type searchDoc struct {
+	postID  int
+	content string
+	// Взвешенная частота каждого слова в документе
+	terms map[string]float64
+}
+
+// InMemorySearchStorage — инвертированный индекс по in-memory хранилищам.
+// Хранилища обновляют его при каждой записи, поэтому поиск видит
+// новые посты и комментарии сразу.
+type InMemorySearchStorage struct {
+	mu       sync.RWMutex
+	docs     map[searchKey]*searchDoc
+	postings map[string]map[searchKey]struct{}
+	// Неодобренные посты: их комментарии не находятся, пока пост скрыт
+	hiddenPosts map[int]bool
+}
+
+// NewInMemorySearchStorage строит индекс по уже сохранённым данным
+// и подключает его к хранилищам.
+func NewInMemorySearchStorage(posts *InMemoryPostStorage, comments *InMemoryCommentStorage) *InMemorySearchStorage {
+	s := &InMemorySearchStorage{
+		docs:        make(map[searchKey]*searchDoc),
+		postings:    make(map[string]map[searchKey]struct{}),
+		hiddenPosts: make(map[int]bool),
+	}
+
+	posts.mu.Lock()
+	for _, post := range posts.posts {
+		s.indexPost(post)
+	}
+	posts.search = s
+	posts.mu.Unlock()
+
+	comments.mu.Lock()
+	for _, comment := range comments.comments {
+		s.indexComment(comment)
+	}
+	comments.search = s
+	comments.mu.Unlock()
+	return s
+}
+
+// indexPost добавляет пост в индекс или заменяет прежнюю версию;
+// неодобренный пост из индекса убирается вместе с его комментариями.
+// Безопасен для nil: хранилище без индекса ничего не делает.
+func (s *InMemorySearchStorage) indexPost(post *models.Post) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if post.Status == models.StatusApproved {
+		delete(s.hiddenPosts, post.ID)
+	} else {
+		s.hiddenPosts[post.ID] = true
+	}
+	s.mu.Unlock()
+	if post.Status != models.StatusApproved {
+		s.put(searchKey{models.SearchResultPost, post.ID}, nil)
+		return
+	}
+	terms := make(map[string]float64)
+	for _, term := range searchTerms(post.Title) {
+		terms[term] += titleSearchWeight
+	}
+	for _, term := range searchTerms(post.Text) {
+		terms[term] += textSearchWeight
+	}
+	s.put(searchKey{models.SearchResultPost, post.ID}, &searchDoc{
+		postID:  post.ID,
+		content: post.Title + " " + post.Text,
+		terms:   terms,
+	})
+}
+
+func (s *InMemorySearchStorage) indexComment(comment *models.Comment) {
+	if s == nil {
+		return
+	}
+	if comment.Status != models.StatusApproved {
+		s.put(searchKey{models.SearchResultComment, comment.ID}, nil)
+		return
+	}
+	terms := make(map[string]float64)
+	for _, term := range searchTerms(comment.Text) {
+		terms[term]++
+	}
+	s.put(searchKey{models.SearchResultComment, comment.ID}, &searchDoc{
+		postID:  comment.PostID,
+		content: comment.Text,
+		terms:   terms,
+	})
+}
+
+// put заменяет документ key на doc; nil удаляет документ.
+func (s *InMemorySearchStorage) put(key searchKey, doc *searchDoc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, exists := s.docs[key]; exists {
+		for term := range old.terms {
+			delete(s.postings[term], key)
+			if len(s.postings[term]) == 0 {
+				delete(s.postings, term)
+			}
+		}
+		delete(s.docs, key)
+	}
+	if doc == nil {
+		return
+	}
+	s.docs[key] = doc
+	for term := range doc.terms {
+		if s.postings[term] == nil {
+			s.postings[term] = make(map[searchKey]struct{})
+		}
+		s.postings[term][key] = struct{}{}
+	}
+}
+
+// Search находит документы, содержащие все слова запроса. Релевантность —
+// сумма взвешенных частот слов, умноженных на их обратную документную частоту.
+func (s *InMemorySearchStorage) Search(query string, limit, offset int) ([]*models.SearchResult, error) {
+	limit, offset = normalizePage(limit, offset)
+	terms := uniqueStrings(searchTerms(query))
+	if len(terms) == 0 {
+		return []*models.SearchResult{}, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Перебираем самый короткий список документов и проверяем остальные слова
+	sort.Slice(terms, func(i, j int) bool { return len(s.postings[terms[i]]) < len(s.postings[terms[j]]) })
+	var results []*models.SearchResult
+	for key := range s.postings[terms[0]] {
+		doc := s.docs[key]
+		if key.kind == models.SearchResultComment && s.hiddenPosts[doc.postID] {
+			continue
+		}
+		rank := 0.0
+		for _, term := range terms {
+			tf, ok := doc.terms[term]
+			if !ok {
+				rank = -1
+				break
+			}
+			rank += tf * math.Log(1+float64(len(s.docs))/float64(len(s.postings[term])))
+		}
+		if rank >= 0 {
+			results = append(results, &models.SearchResult{Type: key.kind, ID: key.id, PostID: doc.postID, Rank: rank})
+		}
+	}
+	sortSearchResults(results)
+
+	if offset >= len(results) {
+		return []*models.SearchResult{}, nil
+	}
+	end := offset + limit
+	if end > len(results) {
+		end = len(results)
+	}
+	page := results[offset:end]
+	highlighted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		highlighted[term] = true
+	}
+	for _, result := range page {
+		result.Snippet = highlight(s.docs[searchKey{result.Type, result.ID}].content, highlighted)
+	}
+	return page, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// highlight вырезает из content окно в snippetWords слов, начинающееся
+// незадолго до первого совпадения, экранирует HTML и оборачивает совпавшие
+// слова в <b></b>.
+func highlight(content string, terms map[string]bool) string {
+	type span struct{ start, end int }
+	var words []span
+	start := -1
+	for i, r := range content {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			words = append(words, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, span{start, len(content)})
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	first := 0
+	for i, w := range words {
+		if terms[strings.ToLower(content[w.start:w.end])] {
+			first = i
+			break
+		}
+	}
+	from := first - 2
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetWords
+	if to > len(words) {
+		to = len(words)
+	}
+
+	var b strings.Builder
+	pos := words[from].start
+	for _, w := range words[from:to] {
+		b.WriteString(html.EscapeString(content[pos:w.start]))
+		word := html.EscapeString(content[w.start:w.end])
+		if terms[strings.ToLower(word)] {
+			b.WriteString("<b>" + word + "</b>")
+		} else {
+			b.WriteString(word)
+		}
+		pos = w.end
+	}
+	return b.String()
+}
+
+// Границы совпадений в сниппетах Postgres и SQLite: управляющие символы
+// вместо тегов, чтобы текст пользователя экранировался до их появления.
+const (
+	snippetStart = '\x02'
+	snippetStop  = '\x03'
+)
+
+// markSnippet экранирует HTML в сниппете базы и заменяет границы совпадений
+// на <b></b>. Такие же символы в тексте пользователя не оставят тег незакрытым.
+func markSnippet(snippet string) string {
+	var b strings.Builder
+	open := false
+	for _, r := range html.EscapeString(snippet) {
+		switch {
+		case r == snippetStart && !open:
+			b.WriteString("<b>")
+			open = true
+		case r == snippetStop && open:
+			b.WriteString("</b>")
+			open = false
+		case r != snippetStart && r != snippetStop:
+			b.WriteRune(r)
+		}
+	}
+	if open {
+		b.WriteString("</b>")
+	}
+	return b.String()
+}
+
+// Ранжирование и подсветка считаются только для выбранной страницы.
+const postgresSearchQuery = `
+WITH q AS (SELECT plainto_tsquery('simple', $1) AS query),
+hits AS (
+	SELECT 'post' AS type, id, id AS post_id, ts_rank_cd(search, q.query)::float8 AS rank
+	FROM posts, q WHERE search @@ q.query AND status = 'approved'
+	UNION ALL
+	SELECT 'comment', c.id, c.post_id, ts_rank_cd(c.search, q.query)::float8
+	FROM comments c JOIN posts p ON p.id = c.post_id CROSS JOIN q
+	WHERE c.search @@ q.query AND c.status = 'approved' AND p.status = 'approved'
+	ORDER BY rank DESC, type DESC, id
+	LIMIT $2 OFFSET $3
+)
+SELECT h.type, h.id, h.post_id, h.rank,
+	ts_headline('simple', CASE WHEN h.type = 'post' THEN p.title || ' ' || p.text ELSE c.text END,
+		q.query, 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=20, MinWords=5')
+FROM hits h
+CROSS JOIN q
+LEFT JOIN posts p ON h.type = 'post' AND p.id = h.id
+LEFT JOIN comments c ON h.type = 'comment' AND c.id = h.id
+ORDER BY h.rank DESC, h.type DESC, h.id`
+
+// PostgresSearchStorage ищет по tsvector-колонкам с GIN-индексами.
+type PostgresSearchStorage struct {
+	db pgQuerier
+}
+
+func NewPostgresSearchStorage(pool *pgxpool.Pool) *PostgresSearchStorage {
+	return &PostgresSearchStorage{db: pool}
+}
+
+// NewReplicatedPostgresSearchStorage создаёт хранилище, выполняющее поиск на репликах.
+func NewReplicatedPostgresSearchStorage(replicas *ReplicaSet) *PostgresSearchStorage {
+	return &PostgresSearchStorage{db: replicas.Reader()}
+}
+
+func (s *PostgresSearchStorage) Search(query string, limit, offset int) ([]*models.SearchResult, error) {
+	limit, offset = normalizePage(limit, offset)
+	rows, err := s.db.Query(context.Background(), postgresSearchQuery, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		if err := rows.Scan(&result.Type, &result.ID, &result.PostID, &result.Rank, &result.Snippet); err != nil {
+			return nil, err
+		}
+		result.Snippet = markSnippet(result.Snippet)
+		results = append(results, &result)
+	}
+	return results, rows.Err()
+}
+
+// bm25 в SQLite тем меньше, чем документ релевантнее, поэтому знак меняется.
+const sqliteSearchQuery = `
+SELECT type, id, post_id, rank, snippet FROM (
+	SELECT 'post' AS type, p.id AS id, p.id AS post_id, -bm25(posts_fts, 1.0, 0.4) AS rank,
+		snippet(posts_fts, -1, char(2), char(3), '', 20) AS snippet
+	FROM posts_fts JOIN posts p ON p.id = posts_fts.rowid WHERE posts_fts MATCH ? AND p.status = 'approved'
+	UNION ALL
+	SELECT 'comment', c.id, c.post_id, -bm25(comments_fts),
+		snippet(comments_fts, 0, char(2), char(3), '', 20)
+	FROM comments_fts JOIN comments c ON c.id = comments_fts.rowid JOIN posts p ON p.id = c.post_id
+	WHERE comments_fts MATCH ? AND c.status = 'approved' AND p.status = 'approved'
+)
+ORDER BY rank DESC, type DESC, id
+LIMIT ? OFFSET ?`
+
+// SQLiteSearchStorage ищет по индексам FTS5.
+type SQLiteSearchStorage struct {
+	db sqlQuerier
+}
+
+func NewSQLiteSearchStorage(db *sql.DB) *SQLiteSearchStorage {
+	return &SQLiteSearchStorage{db: db}
+}
+
+func (s *SQLiteSearchStorage) Search(query string, limit, offset int) ([]*models.SearchResult, error) {
+	limit, offset = normalizePage(limit, offset)
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []*models.SearchResult{}, nil
+	}
+	// Каждое слово берётся в кавычки, чтобы ввод пользователя
+	// не разбирался как синтаксис запросов FTS5
+	match := `"` + strings.Join(terms, `" "`) + `"`
+
+	rows, err := s.db.Query(sqliteSearchQuery, match, match, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		if err := rows.Scan(&result.Type, &result.ID, &result.PostID, &result.Rank, &result.Snippet); err != nil {
+			return nil, err
+		}
+		result.Snippet = markSnippet(result.Snippet)
+		results = append(results, &result)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"ozon_test/internal/models"
+)
+
+// CommentSort — порядок комментариев внутри каждой группы ответов на один
+// и тот же комментарий (или корневых комментариев поста).
+type CommentSort string
+
+const (
+	// CommentSortNew — сначала новые.
+	CommentSortNew CommentSort = "new"
+	// CommentSortOld — сначала старые.
+	CommentSortOld CommentSort = "old"
+	// CommentSortTop — по разнице upvote и downvote.
+	CommentSortTop CommentSort = "top"
+	// CommentSortControversial — сначала комментарии с большим числом голосов,
+	// разделившихся поровну.
+	CommentSortControversial CommentSort = "controversial"
+	// CommentSortHot — по оценке с поправкой на возраст: каждые 12,5 часов
+	// новизны весят столько же, сколько десятикратный рост оценки.
+	CommentSortHot CommentSort = "hot"
+	// CommentSortBest — по нижней границе доверительного интервала Уилсона
+	// для доли upvote: мало голосов значит мало уверенности.
+	CommentSortBest CommentSort = "best"
+)
+
+// Valid сообщает, известен ли порядок.
+func (s CommentSort) Valid() bool {
+	switch s {
+	case CommentSortNew, CommentSortOld, CommentSortTop, CommentSortControversial, CommentSortHot, CommentSortBest:
+		return true
+	}
+	return false
+}
+
+const (
+	// Начало отсчёта и шаг затухания для hot, в секундах
+	hotEpoch = 1134028003
+	hotDecay = 45000
+)
+
+// commentNode — данные комментария, нужные для сортировки дерева.
+type commentNode struct {
+	id        int
+	parentID  *int
+	createdAt time.Time
+	ups       int
+	downs     int
+}
+
+func newCommentNode(comment *models.Comment) commentNode {
+	return commentNode{
+		id:        comment.ID,
+		parentID:  comment.ParentCommentID,
+		createdAt: comment.CreatedAt,
+		ups:       comment.Reactions[models.ReactionUpvote],
+		downs:     comment.Reactions[models.ReactionDownvote],
+	}
+}
+
+// score вычисляет оценку комментария для порядков top, controversial, hot
+// и best. Формулы повторяют выражения postgresCommentScores.
+func (n commentNode) score(order CommentSort) float64 {
+	ups, downs := float64(n.ups), float64(n.downs)
+	switch order {
+	case CommentSortTop:
+		return ups - downs
+	case CommentSortControversial:
+		if n.ups <= 0 || n.downs <= 0 {
+			return 0
+		}
+		balance := ups / downs
+		if n.ups > n.downs {
+			balance = downs / ups
+		}
+		return math.Pow(ups+downs, balance)
+	case CommentSortHot:
+		s := ups - downs
+		sign := 0.0
+		if s > 0 {
+			sign = 1
+		} else if s < 0 {
+			sign = -1
+		}
+		return sign*math.Log10(math.Max(math.Abs(s), 1)) + float64(n.createdAt.Unix()-hotEpoch)/hotDecay
+	case CommentSortBest:
+		total := ups + downs
+		if total == 0 {
+			return 0
+		}
+		// z = 1.96 (95%): z²/2 = 1.9208, z²/4 = 0.9604, z² = 3.8416
+		return (ups/total + 1.9208/total - 1.96*math.Sqrt(ups*downs/total+0.9604)/total) / (1 + 3.8416/total)
+	}
+	return 0
+}
+
+// sortCommentTree возвращает ID комментариев в порядке обхода дерева в глубину:
+// за каждым комментарием следуют ответы на него, а каждая группа ответов
+// (и корневые комментарии) упорядочена по order.
+func sortCommentTree(nodes []commentNode, order CommentSort) []int {
+	scores := make(map[int]float64, len(nodes))
+	children := make(map[int][]commentNode)
+	var roots []commentNode
+	for _, n := range nodes {
+		scores[n.id] = n.score(order)
+		if n.parentID == nil {
+			roots = append(roots, n)
+		} else {
+			children[*n.parentID] = append(children[*n.parentID], n)
+		}
+	}
+
+	less := func(group []commentNode) func(i, j int) bool {
+		return func(i, j int) bool {
+			a, b := group[i], group[j]
+			switch order {
+			case CommentSortNew:
+				if !a.createdAt.Equal(b.createdAt) {
+					return a.createdAt.After(b.createdAt)
+				}
+				return a.id > b.id
+			case CommentSortOld:
+				if !a.createdAt.Equal(b.createdAt) {
+					return a.createdAt.Before(b.createdAt)
+				}
+				return a.id < b.id
+			}
+			if scores[a.id] != scores[b.id] {
+				return scores[a.id] > scores[b.id]
+			}
+			return a.id < b.id
+		}
+	}
+
+	ids := make([]int, 0, len(nodes))
+	var visit func(group []commentNode)
+	visit = func(group []commentNode) {
+		sort.Slice(group, less(group))
+		for _, n := range group {
+			ids = append(ids, n.id)
+			visit(children[n.id])
+		}
+	}
+	visit(roots)
+	return ids
+}
+
+// postgresCommentOrders — сортировка группы ответов в SQL для каждого порядка.
+// ups и downs — число голосов, created_at и id — колонки комментария.
+var postgresCommentOrders = map[CommentSort]string{
+	CommentSortNew: "created_at DESC, id DESC",
+	CommentSortOld: "created_at, id",
+	CommentSortTop: "ups - downs DESC, id",
+	CommentSortControversial: `CASE WHEN ups > 0 AND downs > 0 THEN
+		power((ups + downs)::float8, CASE WHEN ups > downs THEN downs::float8 / ups ELSE ups::float8 / downs END)
+		ELSE 0 END DESC, id`,
+	CommentSortHot: `sign(ups - downs)::float8 * log(greatest(abs(ups - downs), 1)::float8)
+		+ (floor(extract(epoch FROM created_at))::float8 - 1134028003) / 45000 DESC, id`,
+	CommentSortBest: `CASE WHEN ups + downs = 0 THEN 0 ELSE
+		(ups::float8 / (ups + downs) + 1.9208 / (ups + downs)
+			- 1.96 * sqrt(ups::float8 * downs / (ups + downs) + 0.9604) / (ups + downs))
+		/ (1 + 3.8416 / (ups + downs)) END DESC, id`,
+}
+
+// postgresCommentTreeQuery нумерует комментарии поста внутри их групп ответов
+// и собирает для каждого путь из этих номеров от корня: сортировка по пути
+// даёт обход дерева в глубину. Невидимые зрителю ($4) комментарии
+// отбрасываются до построения дерева, а с ними и ответы на них.
+// Подставляются порядок из postgresCommentOrders, колонки комментария
+// и выражение счётчиков реакций.
+const postgresCommentTreeQuery = `
+WITH RECURSIVE votes AS (
+	SELECT c.id, c.parent_comment_id, c.created_at,
+		count(*) FILTER (WHERE r.kind = 'upvote') AS ups,
+		count(*) FILTER (WHERE r.kind = 'downvote') AS downs
+	FROM comments c
+	LEFT JOIN comment_reactions r ON r.comment_id = c.id
+	WHERE c.post_id = $1 AND (c.status = 'approved' OR ($4 <> '' AND c.author = $4))
+	GROUP BY c.id
+),
+ranked AS (
+	SELECT id, parent_comment_id,
+		row_number() OVER (PARTITION BY parent_comment_id ORDER BY %s) AS position
+	FROM votes
+),
+tree AS (
+	SELECT id, ARRAY[position] AS path FROM ranked WHERE parent_comment_id IS NULL
+	UNION ALL
+	SELECT ranked.id, tree.path || ranked.position
+	FROM ranked JOIN tree ON ranked.parent_comment_id = tree.id
+)
+SELECT %s, %s
+FROM tree JOIN comments ON comments.id = tree.id
+ORDER BY tree.path
+LIMIT $2 OFFSET $3`
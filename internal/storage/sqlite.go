@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"ozon_test/config"
+	"ozon_test/internal/models"
+)
+
+// sqlQuerier — общее подмножество методов *sql.DB и *sql.Tx.
+type sqlQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type SQLitePostStorage struct {
+	db sqlQuerier
+}
+
+type SQLiteCommentStorage struct {
+	db sqlQuerier
+}
+
+func NewSQLitePostStorage(db *sql.DB) *SQLitePostStorage {
+	return &SQLitePostStorage{db: db}
+}
+
+func NewSQLiteCommentStorage(db *sql.DB) *SQLiteCommentStorage {
+	return &SQLiteCommentStorage{db: db}
+}
+
+func (s *SQLitePostStorage) CreatePost(post *models.Post) error {
+	post.Status = newStatus(post.Status)
+	post.Version = 1
+	post.UpdatedAt = changedAt(time.Now())
+	query := squirrel.Insert("posts").Columns(postColumns[1:]...).Values(postValues(post)...).
+		Suffix("RETURNING id")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return s.db.QueryRow(sqlStr, args...).Scan(&post.ID)
+}
+
+func (s *SQLitePostStorage) GetPostByID(id int) (*models.Post, error) {
+	query := squirrel.Select(postColumns...).Column(sqlitePostReactions).
+		From("posts").Where(squirrel.Eq{"id": id})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	post := &models.Post{}
+	var reactions []byte
+	err = s.db.QueryRow(sqlStr, args...).Scan(append(postFields(post), &reactions)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if post.Reactions, err = decodeReactions(reactions); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (s *SQLitePostStorage) GetAllPosts() ([]*models.Post, error) {
+	return s.list(squirrel.Select(postColumns...))
+}
+
+func (s *SQLitePostStorage) GetVisiblePosts(viewer string) ([]*models.Post, error) {
+	return s.list(squirrel.Select(postColumns...).Where(visibleCondition("posts", viewer)))
+}
+
+// list выполняет выборку постов query со счётчиками реакций в порядке ID.
+func (s *SQLitePostStorage) list(query squirrel.SelectBuilder) ([]*models.Post, error) {
+	query = query.Column(sqlitePostReactions).From("posts").OrderBy("id")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*models.Post{}
+	for rows.Next() {
+		post := &models.Post{}
+		var reactions []byte
+		err = rows.Scan(append(postFields(post), &reactions)...)
+		if err != nil {
+			return nil, err
+		}
+		if post.Reactions, err = decodeReactions(reactions); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (s *SQLitePostStorage) UpdatePost(post *models.Post) error {
+	updatedAt := changedAt(time.Now())
+	query := touch(squirrel.Update("posts").SetMap(postUpdates(post)), updatedAt).
+		Where(squirrel.Eq{"id": post.ID, "version": post.Version}).Suffix("RETURNING version")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	err = s.db.QueryRow(sqlStr, args...).Scan(&post.Version)
+	if err == nil {
+		post.UpdatedAt = updatedAt
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	// Поста нет или его версия другая
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM posts WHERE id = ?)", post.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+func (s *SQLitePostStorage) LastModified() (time.Time, error) {
+	return sqliteLastModified(s.db, squirrel.Select("updated_at").From("posts"))
+}
+
+// sqliteLastModified возвращает наибольший updated_at строк query; нулевое
+// время, если строк нет. Выбирается сама колонка, а не max(updated_at):
+// драйвер разбирает время только в колонках с типом DATETIME, а строки
+// в UTC упорядочены так же, как время (см. changedAt).
+func sqliteLastModified(db sqlQuerier, query squirrel.SelectBuilder) (time.Time, error) {
+	sqlStr, args, err := query.OrderBy("updated_at DESC").Limit(1).ToSql()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	if err := db.QueryRow(sqlStr, args...).Scan(&last); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	return last, nil
+}
+
+func (s *SQLiteCommentStorage) CreateComment(comment *models.Comment) error {
+	comment.Status = newStatus(comment.Status)
+	comment.Version = 1
+	comment.UpdatedAt = changedAt(time.Now())
+	query := squirrel.Insert("comments").Columns(commentColumns[1:]...).Values(commentValues(comment)...).
+		Suffix("RETURNING id")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	err = s.db.QueryRow(sqlStr, args...).Scan(&comment.ID)
+	if err != nil {
+		// SQLite не сообщает имя нарушенного ключа; пост проверяется до вставки,
+		// поэтому нарушение при указанном родителе относится к нему
+		var sqliteErr *sqlite.Error
+		if comment.ParentCommentID != nil && errors.As(err, &sqliteErr) &&
+			sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY {
+			return ErrInvalidParent
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteCommentStorage) GetCommentsByPostID(postID int, limit, offset int) ([]*models.Comment, error) {
+	return s.list(squirrel.Eq{"post_id": postID}, limit, offset)
+}
+
+func (s *SQLiteCommentStorage) GetVisibleComments(postID int, viewer string, limit, offset int) ([]*models.Comment, error) {
+	return s.list(squirrel.And{squirrel.Eq{"post_id": postID}, visibleCondition("comments", viewer)}, limit, offset)
+}
+
+// list выбирает страницу комментариев по условию where в порядке ID.
+func (s *SQLiteCommentStorage) list(where squirrel.Sqlizer, limit, offset int) ([]*models.Comment, error) {
+	limit, offset = normalizePage(limit, offset)
+	query := squirrel.Select(commentColumns...).Column(sqliteCommentReactions).
+		From("comments").Where(where).OrderBy("id").
+		Limit(uint64(limit)).Offset(uint64(offset))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*models.Comment{}
+	for rows.Next() {
+		comment := &models.Comment{}
+		var reactions []byte
+		err = rows.Scan(append(commentFields(comment), &reactions)...)
+		if err != nil {
+			return nil, err
+		}
+		if comment.Reactions, err = decodeReactions(reactions); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func (s *SQLiteCommentStorage) LastModified(postID int) (time.Time, error) {
+	return sqliteLastModified(s.db, squirrel.Select("updated_at").From("comments").Where(squirrel.Eq{"post_id": postID}))
+}
+
+// GetCommentTree сортирует дерево в Go: функции даты SQLite не разбирают
+// время с наносекундами, в котором драйвер сохраняет created_at.
+func (s *SQLiteCommentStorage) GetCommentTree(postID int, viewer string, order CommentSort, limit, offset int) ([]*models.Comment, error) {
+	if !order.Valid() {
+		return nil, ErrInvalidCommentSort
+	}
+	all, err := s.GetVisibleComments(postID, viewer, math.MaxInt32, 0)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]commentNode, 0, len(all))
+	byID := make(map[int]*models.Comment, len(all))
+	for _, comment := range all {
+		nodes = append(nodes, newCommentNode(comment))
+		byID[comment.ID] = comment
+	}
+
+	ids := sortCommentTree(nodes, order)
+	limit, offset = normalizePage(limit, offset)
+	if offset >= len(ids) {
+		return []*models.Comment{}, nil
+	}
+	end := offset + limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+	comments := make([]*models.Comment, 0, end-offset)
+	for _, id := range ids[offset:end] {
+		comments = append(comments, byID[id])
+	}
+	return comments, nil
+}
+
+type SQLiteTxManager struct {
+	db *sql.DB
+}
+
+func NewSQLiteTxManager(db *sql.DB) *SQLiteTxManager {
+	return &SQLiteTxManager{db: db}
+}
+
+func (m *SQLiteTxManager) WithinTx(fn func(tx Tx) error) error {
+	dbTx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+
+	posts := &SQLitePostStorage{db: dbTx}
+	// SQLite блокирует всю базу на запись с начала транзакции,
+	// поэтому отдельная блокировка строки не нужна
+	tx := &storageTx{
+		posts:     posts,
+		comments:  &SQLiteCommentStorage{db: dbTx},
+		forShare:  posts.GetPostByID,
+		forUpdate: posts.GetPostByID,
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return dbTx.Commit()
+}
+
+func OpenSQLite(cfg *config.Config) (*sql.DB, error) {
+	// WAL позволяет читателям не блокироваться на время записи,
+	// busy_timeout — дождаться освобождения блокировки вместо SQLITE_BUSY.
+	// Транзакции сразу берут блокировку записи (BEGIN IMMEDIATE), чтобы
+	// проверка и вставка в одной транзакции не упирались во взаимоблокировку
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate",
+		cfg.SQLite.Path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы SQLite: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка подключения к базе SQLite: %w", err)
+	}
+
+	return db, nil
+}
@@ -5,53 +5,235 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v4"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"ozon_test/config"
 	"ozon_test/internal/models"
 )
 
 var ErrNotFound = errors.New("not found")
 var ErrCommentsNotAllowed = errors.New("comments not allowed")
+var ErrInvalidParent = errors.New("parent comment not found in this post")
+var ErrInvalidCommentSort = errors.New("unknown comment sort")
+var ErrDuplicateReport = errors.New("duplicate report")
+var ErrVersionConflict = errors.New("version conflict")
 
 type PostStorage interface {
 	CreatePost(post *models.Post) error
 	GetPostByID(id int) (*models.Post, error)
 	GetAllPosts() ([]*models.Post, error)
+	// GetVisiblePosts возвращает посты, видимые viewer: одобренные
+	// и его собственные. Пустой viewer видит только одобренные.
+	GetVisiblePosts(viewer string) ([]*models.Post, error)
+	// UpdatePost сохраняет изменяемые поля поста (автор и время создания
+	// не меняются), если версия поста в хранилище равна post.Version,
+	// и увеличивает post.Version. Если версия другая, возвращает ErrVersionConflict.
 	UpdatePost(post *models.Post) error
+	// LastModified возвращает наибольшее время изменения поста (UpdatedAt);
+	// нулевое время — постов нет.
+	LastModified() (time.Time, error)
 }
 
 type CommentStorage interface {
 	CreateComment(comment *models.Comment) error
 	GetCommentsByPostID(postID int, limit, offset int) ([]*models.Comment, error)
+	// GetVisibleComments возвращает страницу комментариев поста, видимых
+	// viewer (см. PostStorage.GetVisiblePosts).
+	GetVisibleComments(postID int, viewer string, limit, offset int) ([]*models.Comment, error)
+	// GetCommentTree возвращает страницу видимых viewer комментариев поста
+	// в порядке обхода дерева в глубину, где каждая группа ответов
+	// упорядочена по order. Ответы на скрытый комментарий тоже скрыты.
+	GetCommentTree(postID int, viewer string, order CommentSort, limit, offset int) ([]*models.Comment, error)
+	// LastModified возвращает наибольшее время изменения комментария поста;
+	// нулевое время — комментариев нет.
+	LastModified(postID int) (time.Time, error)
+}
+
+// SearchStorage выполняет полнотекстовый поиск по постам и комментариям.
+// Найденными считаются документы, содержащие все слова запроса.
+type SearchStorage interface {
+	Search(query string, limit, offset int) ([]*models.SearchResult, error)
+}
+
+// normalizePage приводит параметры пагинации к виду, одинаковому для всех хранилищ:
+// отрицательные значения считаются нулём.
+func normalizePage(limit, offset int) (int, int) {
+	if limit < 0 {
+		limit = 0
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// Колонки постов и комментариев. Первая колонка — id, который назначает
+// база; остальные записываются из postValues и commentValues.
+var (
+	postColumns    = []string{"id", "title", "text", "allow_comments", "author", "created_at", "moderation_action", "moderation_reason", "status", "version", "updated_at"}
+	commentColumns = []string{"id", "post_id", "parent_comment_id", "text", "author", "created_at", "moderation_action", "moderation_reason", "status", "version", "updated_at"}
+)
+
+// postFields возвращает адреса полей поста в порядке postColumns.
+func postFields(post *models.Post) []interface{} {
+	return []interface{}{&post.ID, &post.Title, &post.Text, &post.AllowComments, &post.Author, &post.CreatedAt,
+		&post.ModerationAction, &post.ModerationReason, &post.Status, &post.Version, &post.UpdatedAt}
+}
+
+// postValues возвращает значения колонок postColumns[1:].
+func postValues(post *models.Post) []interface{} {
+	return []interface{}{post.Title, post.Text, post.AllowComments, post.Author, post.CreatedAt,
+		post.ModerationAction, post.ModerationReason, post.Status, post.Version, post.UpdatedAt}
+}
+
+// postUpdates возвращает изменяемые колонки поста для UPDATE; версия
+// и время изменения записываются отдельно (см. touch).
+func postUpdates(post *models.Post) map[string]interface{} {
+	return map[string]interface{}{
+		"title":             post.Title,
+		"text":              post.Text,
+		"allow_comments":    post.AllowComments,
+		"moderation_action": post.ModerationAction,
+		"moderation_reason": post.ModerationReason,
+		"status":            post.Status,
+	}
+}
+
+// nextVersion — выражение UPDATE, увеличивающее версию записи.
+var nextVersion = squirrel.Expr("version + 1")
+
+// changedAt приводит время изменения записи к виду, одинаковому для всех
+// хранилищ: UTC с точностью до микросекунд, как хранит Postgres. SQLite
+// хранит время строкой, а строки сравниваются как время, только если пояс
+// у всех один.
+func changedAt(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// touch дополняет UPDATE записи увеличением версии и временем изменения at.
+func touch(query squirrel.UpdateBuilder, at time.Time) squirrel.UpdateBuilder {
+	return query.Set("version", nextVersion).Set("updated_at", at)
+}
+
+// commentFields возвращает адреса полей комментария в порядке commentColumns.
+func commentFields(comment *models.Comment) []interface{} {
+	return []interface{}{&comment.ID, &comment.PostID, &comment.ParentCommentID, &comment.Text, &comment.Author, &comment.CreatedAt,
+		&comment.ModerationAction, &comment.ModerationReason, &comment.Status, &comment.Version, &comment.UpdatedAt}
+}
+
+// commentValues возвращает значения колонок commentColumns[1:].
+func commentValues(comment *models.Comment) []interface{} {
+	return []interface{}{comment.PostID, comment.ParentCommentID, comment.Text, comment.Author, comment.CreatedAt,
+		comment.ModerationAction, comment.ModerationReason, comment.Status, comment.Version, comment.UpdatedAt}
+}
+
+// newStatus возвращает статус новой записи: запись без явного статуса одобрена.
+func newStatus(status string) string {
+	if status == "" {
+		return models.StatusApproved
+	}
+	return status
+}
+
+// visibleTo сообщает, видна ли запись со статусом status и автором author
+// пользователю viewer: одобренные видны всем, остальные — только автору.
+func visibleTo(status, author, viewer string) bool {
+	return status == models.StatusApproved || (viewer != "" && author == viewer)
+}
+
+// visibleCondition — условие visibleTo для SQL-запроса; table — имя или псевдоним таблицы.
+func visibleCondition(table, viewer string) squirrel.Sqlizer {
+	status := squirrel.Eq{table + ".status": models.StatusApproved}
+	if viewer == "" {
+		return status
+	}
+	return squirrel.Or{status, squirrel.Eq{table + ".author": viewer}}
+}
+
+// qualifiedColumns перечисляет колонки через запятую с префиксом таблицы.
+func qualifiedColumns(table string, columns []string) string {
+	qualified := make([]string, len(columns))
+	for i, column := range columns {
+		qualified[i] = table + "." + column
+	}
+	return strings.Join(qualified, ", ")
+}
+
+// In-memory хранилища отдают и принимают копии моделей: изменение
+// полученного объекта вне блокировки не затрагивает хранимые данные.
+func clonePost(post *models.Post) *models.Post {
+	clone := *post
+	return &clone
+}
+
+func cloneComment(comment *models.Comment) *models.Comment {
+	clone := *comment
+	if comment.ParentCommentID != nil {
+		parentID := *comment.ParentCommentID
+		clone.ParentCommentID = &parentID
+	}
+	return &clone
+}
+
+// Счётчики реакций вычисляются при чтении, поэтому в хранимую копию не попадают.
+func storedPost(post *models.Post) *models.Post {
+	clone := clonePost(post)
+	clone.Reactions = nil
+	return clone
+}
+
+func storedComment(comment *models.Comment) *models.Comment {
+	clone := cloneComment(comment)
+	clone.Reactions = nil
+	return clone
 }
 
 type InMemoryPostStorage struct {
-	posts  map[int]*models.Post
-	mu     sync.Mutex
-	nextID int
+	posts     map[int]*models.Post
+	reactions reactionSet
+	reports   reportSet
+	mu        sync.RWMutex
+	nextID    int
+	journal   *journal
+	search    *InMemorySearchStorage
 }
 
 type InMemoryCommentStorage struct {
 	comments map[int]*models.Comment
-	mu       sync.Mutex
-	nextID   int
+	// ID комментариев каждого поста в порядке создания
+	byPost map[int][]int
+	// ID прямых ответов на каждый комментарий в порядке создания
+	replies   map[int][]int
+	reactions reactionSet
+	reports   reportSet
+	mu        sync.RWMutex
+	nextID    int
+	journal   *journal
+	search    *InMemorySearchStorage
 }
 
 func NewInMemoryPostStorage() *InMemoryPostStorage {
 	return &InMemoryPostStorage{
-		posts:  make(map[int]*models.Post),
-		nextID: 1,
+		posts:     make(map[int]*models.Post),
+		reactions: make(reactionSet),
+		reports:   make(reportSet),
+		nextID:    1,
 	}
 }
 
 func NewInMemoryCommentStorage() *InMemoryCommentStorage {
 	return &InMemoryCommentStorage{
-		comments: make(map[int]*models.Comment),
-		nextID:   1,
+		comments:  make(map[int]*models.Comment),
+		byPost:    make(map[int][]int),
+		replies:   make(map[int][]int),
+		reactions: make(reactionSet),
+		reports:   make(reportSet),
+		nextID:    1,
 	}
 }
 
@@ -59,89 +241,253 @@ func (s *InMemoryPostStorage) CreatePost(post *models.Post) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	post.ID = s.nextID
+	post.Status = newStatus(post.Status)
+	post.Version = 1
+	post.UpdatedAt = changedAt(time.Now())
+	if err := s.journal.append(opCreatePost, post); err != nil {
+		return err
+	}
 	s.nextID++
-	s.posts[post.ID] = post
+	s.posts[post.ID] = storedPost(post)
+	s.search.indexPost(post)
 	return nil
 }
 
 func (s *InMemoryPostStorage) GetPostByID(id int) (*models.Post, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	post, exists := s.posts[id]
 	if !exists {
 		return nil, ErrNotFound
 	}
-	return post, nil
+	return s.read(post), nil
+}
+
+// read возвращает копию поста со счётчиками реакций. Вызывается под блокировкой.
+func (s *InMemoryPostStorage) read(post *models.Post) *models.Post {
+	clone := clonePost(post)
+	clone.Reactions = s.reactions.counts(post.ID)
+	return clone
 }
 
 func (s *InMemoryPostStorage) GetAllPosts() ([]*models.Post, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.list(func(*models.Post) bool { return true }), nil
+}
+
+func (s *InMemoryPostStorage) GetVisiblePosts(viewer string) ([]*models.Post, error) {
+	return s.list(func(post *models.Post) bool { return visibleTo(post.Status, post.Author, viewer) }), nil
+}
+
+// list возвращает посты, отобранные filter, в порядке ID.
+func (s *InMemoryPostStorage) list(filter func(*models.Post) bool) []*models.Post {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	posts := make([]*models.Post, 0, len(s.posts))
 	for _, post := range s.posts {
-		posts = append(posts, post)
+		if filter(post) {
+			posts = append(posts, s.read(post))
+		}
 	}
-	return posts, nil
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID < posts[j].ID })
+	return posts
 }
 
 func (s *InMemoryPostStorage) UpdatePost(post *models.Post) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, exists := s.posts[post.ID]; !exists {
+	current, exists := s.posts[post.ID]
+	if !exists {
 		return ErrNotFound
 	}
-	s.posts[post.ID] = post
+	if current.Version != post.Version {
+		return ErrVersionConflict
+	}
+	updated := storedPost(post)
+	updated.Author = current.Author
+	updated.CreatedAt = current.CreatedAt
+	updated.Version++
+	updated.UpdatedAt = changedAt(time.Now())
+	if err := s.journal.append(opUpdatePost, updated); err != nil {
+		return err
+	}
+	s.posts[post.ID] = updated
+	s.search.indexPost(updated)
+	post.Version = updated.Version
+	post.UpdatedAt = updated.UpdatedAt
 	return nil
 }
 
+func (s *InMemoryPostStorage) LastModified() (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var last time.Time
+	for _, post := range s.posts {
+		if post.UpdatedAt.After(last) {
+			last = post.UpdatedAt
+		}
+	}
+	return last, nil
+}
+
 func (s *InMemoryCommentStorage) CreateComment(comment *models.Comment) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if comment.ParentCommentID != nil {
+		parent, exists := s.comments[*comment.ParentCommentID]
+		if !exists || parent.PostID != comment.PostID {
+			return ErrInvalidParent
+		}
+	}
 	comment.ID = s.nextID
+	comment.Status = newStatus(comment.Status)
+	comment.Version = 1
+	comment.UpdatedAt = changedAt(time.Now())
+	if err := s.journal.append(opCreateComment, comment); err != nil {
+		return err
+	}
 	s.nextID++
-	s.comments[comment.ID] = comment
+	s.insert(storedComment(comment))
 	return nil
 }
 
+// insert добавляет комментарий в хранилище и индексы. Вызывается под блокировкой.
+func (s *InMemoryCommentStorage) insert(comment *models.Comment) {
+	s.comments[comment.ID] = comment
+	// ID растут монотонно, поэтому добавление в конец сохраняет порядок создания
+	s.byPost[comment.PostID] = append(s.byPost[comment.PostID], comment.ID)
+	if comment.ParentCommentID != nil {
+		s.replies[*comment.ParentCommentID] = append(s.replies[*comment.ParentCommentID], comment.ID)
+	}
+	s.search.indexComment(comment)
+}
+
 func (s *InMemoryCommentStorage) GetCommentsByPostID(postID int, limit, offset int) ([]*models.Comment, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	var comments []*models.Comment
-	for _, comment := range s.comments {
-		if comment.PostID == postID {
-			comments = append(comments, comment)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.page(s.byPost[postID], limit, offset), nil
+}
+
+func (s *InMemoryCommentStorage) GetVisibleComments(postID int, viewer string, limit, offset int) ([]*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.page(s.visible(postID, viewer), limit, offset), nil
+}
+
+// visible возвращает ID видимых viewer комментариев поста в порядке создания.
+// Вызывается под блокировкой.
+func (s *InMemoryCommentStorage) visible(postID int, viewer string) []int {
+	ids := make([]int, 0, len(s.byPost[postID]))
+	for _, id := range s.byPost[postID] {
+		if comment := s.comments[id]; visibleTo(comment.Status, comment.Author, viewer) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (s *InMemoryCommentStorage) GetCommentTree(postID int, viewer string, order CommentSort, limit, offset int) ([]*models.Comment, error) {
+	if !order.Valid() {
+		return nil, ErrInvalidCommentSort
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.visible(postID, viewer)
+	nodes := make([]commentNode, 0, len(ids))
+	for _, id := range ids {
+		comment := s.comments[id]
+		ups, downs := s.reactions.votes(id)
+		nodes = append(nodes, commentNode{
+			id:        id,
+			parentID:  comment.ParentCommentID,
+			createdAt: comment.CreatedAt,
+			ups:       ups,
+			downs:     downs,
+		})
+	}
+	return s.page(sortCommentTree(nodes, order), limit, offset), nil
+}
+
+func (s *InMemoryCommentStorage) LastModified(postID int) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var last time.Time
+	for _, id := range s.byPost[postID] {
+		if updatedAt := s.comments[id].UpdatedAt; updatedAt.After(last) {
+			last = updatedAt
 		}
 	}
-	start := offset
-	if start >= len(comments) {
-		return []*models.Comment{}, nil
+	return last, nil
+}
+
+// GetReplies возвращает прямые ответы на комментарий в порядке создания.
+func (s *InMemoryCommentStorage) GetReplies(commentID int, limit, offset int) ([]*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.page(s.replies[commentID], limit, offset), nil
+}
+
+// page выбирает из упорядоченного списка ID одну страницу комментариев.
+// Вызывается под блокировкой.
+func (s *InMemoryCommentStorage) page(ids []int, limit, offset int) []*models.Comment {
+	limit, offset = normalizePage(limit, offset)
+	if offset >= len(ids) {
+		return []*models.Comment{}
+	}
+	end := offset + limit
+	if end > len(ids) {
+		end = len(ids)
 	}
-	end := start + limit
-	if end > len(comments) {
-		end = len(comments)
+	comments := make([]*models.Comment, 0, end-offset)
+	for _, id := range ids[offset:end] {
+		comment := cloneComment(s.comments[id])
+		comment.Reactions = s.reactions.counts(id)
+		comments = append(comments, comment)
 	}
-	return comments[start:end], nil
+	return comments
 }
 
+// pgQuerier — общее подмножество методов пула и транзакции pgx.
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Хранилища Postgres пишут в db, а читают из read: это либо тот же
+// primary, либо реплики (см. ReplicaSet). В транзакции оба поля указывают на неё.
 type PostgresPostStorage struct {
-	pool *pgxpool.Pool
+	db   pgQuerier
+	read pgQuerier
 }
 
 type PostgresCommentStorage struct {
-	pool *pgxpool.Pool
+	db   pgQuerier
+	read pgQuerier
 }
 
 func NewPostgresPostStorage(pool *pgxpool.Pool) *PostgresPostStorage {
-	return &PostgresPostStorage{pool: pool}
+	return &PostgresPostStorage{db: pool, read: pool}
 }
 
 func NewPostgresCommentStorage(pool *pgxpool.Pool) *PostgresCommentStorage {
-	return &PostgresCommentStorage{pool: pool}
+	return &PostgresCommentStorage{db: pool, read: pool}
+}
+
+// NewReplicatedPostgresPostStorage создаёт хранилище, читающее посты с реплик.
+func NewReplicatedPostgresPostStorage(pool *pgxpool.Pool, replicas *ReplicaSet) *PostgresPostStorage {
+	return &PostgresPostStorage{db: pool, read: replicas.Reader()}
+}
+
+// NewReplicatedPostgresCommentStorage создаёт хранилище, читающее комментарии с реплик.
+func NewReplicatedPostgresCommentStorage(pool *pgxpool.Pool, replicas *ReplicaSet) *PostgresCommentStorage {
+	return &PostgresCommentStorage{db: pool, read: replicas.Reader()}
 }
 
 func (s *PostgresPostStorage) CreatePost(post *models.Post) error {
-	query := squirrel.Insert("posts").Columns("title", "text", "allow_comments", "author", "created_at").
-		Values(post.Title, post.Text, post.AllowComments, post.Author, post.CreatedAt).
+	post.Status = newStatus(post.Status)
+	post.Version = 1
+	post.UpdatedAt = changedAt(time.Now())
+	query := squirrel.Insert("posts").Columns(postColumns[1:]...).Values(postValues(post)...).
 		Suffix("RETURNING id").PlaceholderFormat(squirrel.Dollar)
 
 	sql, args, err := query.ToSql()
@@ -149,7 +495,7 @@ func (s *PostgresPostStorage) CreatePost(post *models.Post) error {
 		return err
 	}
 
-	err = s.pool.QueryRow(context.Background(), sql, args...).Scan(&post.ID)
+	err = s.db.QueryRow(context.Background(), sql, args...).Scan(&post.ID)
 	if err != nil {
 		return err
 	}
@@ -157,77 +503,143 @@ func (s *PostgresPostStorage) CreatePost(post *models.Post) error {
 }
 
 func (s *PostgresPostStorage) GetPostByID(id int) (*models.Post, error) {
-	query := squirrel.Select("id", "title", "text", "allow_comments", "author", "created_at").
+	return s.getPostByID(id, "")
+}
+
+// getPostByID читает пост, при необходимости блокируя строку (lock — "FOR SHARE" или "FOR UPDATE").
+// Блокирующее чтение нужно только для проверок в транзакции, поэтому реакции не подсчитывает.
+func (s *PostgresPostStorage) getPostByID(id int, lock string) (*models.Post, error) {
+	query := squirrel.Select(postColumns...).
 		From("posts").Where(squirrel.Eq{"id": id}).PlaceholderFormat(squirrel.Dollar)
+	if lock != "" {
+		query = query.Suffix(lock)
+	} else {
+		query = query.Column(postgresPostReactions)
+	}
 
 	sql, args, err := query.ToSql()
 	if err != nil {
 		return nil, err
 	}
 
-	row := s.pool.QueryRow(context.Background(), sql, args...)
+	// Блокирующее чтение возможно только на primary
+	db := s.read
+	if lock != "" {
+		db = s.db
+	}
+	row := db.QueryRow(context.Background(), sql, args...)
 	post := &models.Post{}
-	err = row.Scan(&post.ID, &post.Title, &post.Text, &post.AllowComments, &post.Author, &post.CreatedAt)
+	var reactions []byte
+	dest := postFields(post)
+	if lock == "" {
+		dest = append(dest, &reactions)
+	}
+	err = row.Scan(dest...)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
+	if lock == "" {
+		if post.Reactions, err = decodeReactions(reactions); err != nil {
+			return nil, err
+		}
+	}
 	return post, nil
 }
 
 func (s *PostgresPostStorage) GetAllPosts() ([]*models.Post, error) {
-	query := squirrel.Select("id", "title", "text", "allow_comments", "author", "created_at").
-		From("posts").PlaceholderFormat(squirrel.Dollar)
+	return s.list(squirrel.Select(postColumns...))
+}
+
+func (s *PostgresPostStorage) GetVisiblePosts(viewer string) ([]*models.Post, error) {
+	return s.list(squirrel.Select(postColumns...).Where(visibleCondition("posts", viewer)))
+}
+
+// list выполняет выборку постов query со счётчиками реакций в порядке ID.
+func (s *PostgresPostStorage) list(query squirrel.SelectBuilder) ([]*models.Post, error) {
+	query = query.Column(postgresPostReactions).From("posts").OrderBy("id").PlaceholderFormat(squirrel.Dollar)
 
 	sql, args, err := query.ToSql()
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := s.pool.Query(context.Background(), sql, args...)
+	rows, err := s.read.Query(context.Background(), sql, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []*models.Post
+	posts := []*models.Post{}
 	for rows.Next() {
 		post := &models.Post{}
-		err = rows.Scan(&post.ID, &post.Title, &post.Text, &post.AllowComments, &post.Author, &post.CreatedAt)
+		var reactions []byte
+		err = rows.Scan(append(postFields(post), &reactions)...)
 		if err != nil {
 			return nil, err
 		}
+		if post.Reactions, err = decodeReactions(reactions); err != nil {
+			return nil, err
+		}
 		posts = append(posts, post)
 	}
-	return posts, nil
+	return posts, rows.Err()
 }
 
 func (s *PostgresPostStorage) UpdatePost(post *models.Post) error {
-	query := squirrel.Update("posts").Set("title", post.Title).Set("text", post.Text).
-		Set("allow_comments", post.AllowComments).Set("author", post.Author).
-		Set("created_at", post.CreatedAt).Where(squirrel.Eq{"id": post.ID}).PlaceholderFormat(squirrel.Dollar)
+	updatedAt := changedAt(time.Now())
+	query := touch(squirrel.Update("posts").SetMap(postUpdates(post)), updatedAt).
+		Where(squirrel.Eq{"id": post.ID, "version": post.Version}).Suffix("RETURNING version").
+		PlaceholderFormat(squirrel.Dollar)
 
 	sql, args, err := query.ToSql()
 	if err != nil {
 		return err
 	}
 
-	result, err := s.pool.Exec(context.Background(), sql, args...)
-	if err != nil {
+	err = s.db.QueryRow(context.Background(), sql, args...).Scan(&post.Version)
+	if err == nil {
+		post.UpdatedAt = updatedAt
+	}
+	if err != pgx.ErrNoRows {
 		return err
 	}
-
-	if result.RowsAffected() == 0 {
+	// Поста нет или его версия другая
+	var exists bool
+	if err := s.db.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)", post.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
 		return ErrNotFound
 	}
-	return nil
+	return ErrVersionConflict
+}
+
+func (s *PostgresPostStorage) LastModified() (time.Time, error) {
+	return postgresLastModified(s.read, squirrel.Select("updated_at").From("posts"))
+}
+
+// postgresLastModified возвращает наибольший updated_at строк query; нулевое
+// время, если строк нет.
+func postgresLastModified(db pgQuerier, query squirrel.SelectBuilder) (time.Time, error) {
+	sql, args, err := query.OrderBy("updated_at DESC").Limit(1).PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	if err := db.QueryRow(context.Background(), sql, args...).Scan(&last); err != nil && err != pgx.ErrNoRows {
+		return time.Time{}, err
+	}
+	return last, nil
 }
 
 func (s *PostgresCommentStorage) CreateComment(comment *models.Comment) error {
-	query := squirrel.Insert("comments").Columns("post_id", "parent_comment_id", "text", "author", "created_at").
-		Values(comment.PostID, comment.ParentCommentID, comment.Text, comment.Author, comment.CreatedAt).
+	comment.Status = newStatus(comment.Status)
+	comment.Version = 1
+	comment.UpdatedAt = changedAt(time.Now())
+	query := squirrel.Insert("comments").Columns(commentColumns[1:]...).Values(commentValues(comment)...).
 		Suffix("RETURNING id").PlaceholderFormat(squirrel.Dollar)
 
 	sql, args, err := query.ToSql()
@@ -235,16 +647,30 @@ func (s *PostgresCommentStorage) CreateComment(comment *models.Comment) error {
 		return err
 	}
 
-	err = s.pool.QueryRow(context.Background(), sql, args...).Scan(&comment.ID)
+	err = s.db.QueryRow(context.Background(), sql, args...).Scan(&comment.ID)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "comments_parent_same_post_fkey" {
+			return ErrInvalidParent
+		}
 		return err
 	}
 	return nil
 }
 
 func (s *PostgresCommentStorage) GetCommentsByPostID(postID int, limit, offset int) ([]*models.Comment, error) {
-	query := squirrel.Select("id", "post_id", "parent_comment_id", "text", "author", "created_at").
-		From("comments").Where(squirrel.Eq{"post_id": postID}).
+	return s.list(squirrel.Eq{"post_id": postID}, limit, offset)
+}
+
+func (s *PostgresCommentStorage) GetVisibleComments(postID int, viewer string, limit, offset int) ([]*models.Comment, error) {
+	return s.list(squirrel.And{squirrel.Eq{"post_id": postID}, visibleCondition("comments", viewer)}, limit, offset)
+}
+
+// list выбирает страницу комментариев по условию where в порядке ID.
+func (s *PostgresCommentStorage) list(where squirrel.Sqlizer, limit, offset int) ([]*models.Comment, error) {
+	limit, offset = normalizePage(limit, offset)
+	query := squirrel.Select(commentColumns...).Column(postgresCommentReactions).
+		From("comments").Where(where).OrderBy("id").
 		Limit(uint64(limit)).Offset(uint64(offset)).PlaceholderFormat(squirrel.Dollar)
 
 	sql, args, err := query.ToSql()
@@ -252,44 +678,49 @@ func (s *PostgresCommentStorage) GetCommentsByPostID(postID int, limit, offset i
 		return nil, err
 	}
 
-	rows, err := s.pool.Query(context.Background(), sql, args...)
+	rows, err := s.read.Query(context.Background(), sql, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanPostgresComments(rows)
+}
 
-	var comments []*models.Comment
-	for rows.Next() {
-		comment := &models.Comment{}
-		var parentID *int
-		err = rows.Scan(&comment.ID, &comment.PostID, &parentID, &comment.Text, &comment.Author, &comment.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		comment.ParentCommentID = parentID
-		comments = append(comments, comment)
-	}
-	return comments, nil
+func (s *PostgresCommentStorage) LastModified(postID int) (time.Time, error) {
+	return postgresLastModified(s.read, squirrel.Select("updated_at").From("comments").Where(squirrel.Eq{"post_id": postID}))
 }
 
-func CreateDBPool(cfg *config.Config) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
-		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName)
+func (s *PostgresCommentStorage) GetCommentTree(postID int, viewer string, order CommentSort, limit, offset int) ([]*models.Comment, error) {
+	orderBy, ok := postgresCommentOrders[order]
+	if !ok {
+		return nil, ErrInvalidCommentSort
+	}
+	limit, offset = normalizePage(limit, offset)
+	sql := fmt.Sprintf(postgresCommentTreeQuery, orderBy, qualifiedColumns("comments", commentColumns), postgresCommentReactions)
 
-	poolConfig, err := pgxpool.ParseConfig(connString)
+	rows, err := s.read.Query(context.Background(), sql, postID, limit, offset, viewer)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка разбора строки подключения: %w", err)
+		return nil, err
 	}
+	return scanPostgresComments(rows)
+}
 
-	poolConfig.MaxConns = 10
-	poolConfig.MinConns = 2
-	poolConfig.MaxConnLifetime = time.Hour
-	poolConfig.MaxConnIdleTime = 30 * time.Minute
+// scanPostgresComments читает комментарии со счётчиками реакций и закрывает rows.
+func scanPostgresComments(rows pgx.Rows) ([]*models.Comment, error) {
+	defer rows.Close()
 
-	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
+	comments := []*models.Comment{}
+	var err error
+	for rows.Next() {
+		comment := &models.Comment{}
+		var reactions []byte
+		err = rows.Scan(append(commentFields(comment), &reactions)...)
+		if err != nil {
+			return nil, err
+		}
+		if comment.Reactions, err = decodeReactions(reactions); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
 	}
-
-	return pool, nil
+	return comments, rows.Err()
 }
@@ -1,9 +1,14 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"ozon_test/config"
 	"ozon_test/internal/models"
 )
 
@@ -67,3 +72,311 @@ func TestInMemoryCommentStorage(t *testing.T) {
 		t.Errorf("Ожидался текст 'Test comment', получено '%s'", comments[0].Text)
 	}
 }
+
+func TestInMemoryStorageCopiesModels(t *testing.T) {
+	posts := NewInMemoryPostStorage()
+	post := &models.Post{Title: "Test", Text: "Text", AllowComments: true, Author: "Author", CreatedAt: time.Now()}
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	post.Title = "Changed after create"
+
+	retrieved, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retrieved.AllowComments = false
+	all, err := posts.GetAllPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all[0].Title != "Test" || !all[0].AllowComments {
+		t.Errorf("Изменение полученного поста затронуло хранилище: %+v", all[0])
+	}
+
+	comments := NewInMemoryCommentStorage()
+	parent := &models.Comment{PostID: post.ID, Text: "Parent", Author: "User", CreatedAt: time.Now()}
+	if err := comments.CreateComment(parent); err != nil {
+		t.Fatal(err)
+	}
+	parentID := parent.ID
+	comment := &models.Comment{PostID: post.ID, ParentCommentID: &parentID, Text: "Comment", Author: "User", CreatedAt: time.Now()}
+	if err := comments.CreateComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	parentID = 100
+	page, err := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*page[1].ParentCommentID = 200
+	page, _ = comments.GetCommentsByPostID(post.ID, 10, 0)
+	if *page[1].ParentCommentID != parent.ID {
+		t.Errorf("Ожидался ParentCommentID %d, получено %d", parent.ID, *page[1].ParentCommentID)
+	}
+}
+
+func TestInMemoryCommentReplies(t *testing.T) {
+	store := NewInMemoryCommentStorage()
+
+	root := &models.Comment{PostID: 1, Text: "Root", Author: "User", CreatedAt: time.Now()}
+	if err := store.CreateComment(root); err != nil {
+		t.Fatal(err)
+	}
+	var want []int
+	for i := 0; i < 3; i++ {
+		reply := &models.Comment{PostID: 1, ParentCommentID: &root.ID, Text: "Reply", Author: "User", CreatedAt: time.Now()}
+		if err := store.CreateComment(reply); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, reply.ID)
+	}
+	other := &models.Comment{PostID: 1, Text: "Other root", Author: "User", CreatedAt: time.Now()}
+	if err := store.CreateComment(other); err != nil {
+		t.Fatal(err)
+	}
+
+	replies, err := store.GetReplies(root.ID, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 2 || replies[0].ID != want[1] || replies[1].ID != want[2] {
+		t.Errorf("Ожидались ответы %v, получено %+v", want[1:], replies)
+	}
+
+	replies, err = store.GetReplies(other.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 0 {
+		t.Errorf("Ожидалось 0 ответов, получено %d", len(replies))
+	}
+}
+
+func newTestSQLiteDB(t *testing.T) *sql.DB {
+	cfg := &config.Config{}
+	cfg.SQLite.Path = filepath.Join(t.TempDir(), "test.db")
+
+	if err := ApplySQLiteMigrations(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenSQLite(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.SQLite.Path = filepath.Join(t.TempDir(), "test.db")
+
+	m, err := NewMigrate(cfg, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(); err != nil {
+		t.Fatalf("Ошибка отката миграций: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Ошибка повторного применения миграций: %v", err)
+	}
+}
+
+func TestSQLitePostStorage(t *testing.T) {
+	store := NewSQLitePostStorage(newTestSQLiteDB(t))
+
+	post := &models.Post{
+		Title:         "Test",
+		Text:          "Text",
+		AllowComments: true,
+		Author:        "Author",
+		CreatedAt:     time.Now(),
+	}
+	if err := store.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+
+	post.AllowComments = false
+	if err := store.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+
+	retrieved, err := store.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retrieved.Title != "Test" || retrieved.AllowComments {
+		t.Errorf("Получен неожиданный пост: %+v", retrieved)
+	}
+
+	if _, err := store.GetPostByID(post.ID + 1); err != ErrNotFound {
+		t.Errorf("Ожидалась ошибка ErrNotFound, получено %v", err)
+	}
+	if err := store.UpdatePost(&models.Post{ID: post.ID + 1}); err != ErrNotFound {
+		t.Errorf("Ожидалась ошибка ErrNotFound, получено %v", err)
+	}
+}
+
+func TestSQLiteCommentStorage(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	post := &models.Post{Title: "Test", Text: "Text", AllowComments: true, Author: "Author", CreatedAt: time.Now()}
+	if err := NewSQLitePostStorage(db).CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	store := NewSQLiteCommentStorage(db)
+
+	parent := &models.Comment{PostID: post.ID, Text: "Parent", Author: "User", CreatedAt: time.Now()}
+	if err := store.CreateComment(parent); err != nil {
+		t.Fatal(err)
+	}
+	reply := &models.Comment{PostID: post.ID, ParentCommentID: &parent.ID, Text: "Reply", Author: "User", CreatedAt: time.Now()}
+	if err := store.CreateComment(reply); err != nil {
+		t.Fatal(err)
+	}
+
+	comments, err := store.GetCommentsByPostID(post.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 {
+		t.Fatalf("Ожидалось 2 комментария, получено %d", len(comments))
+	}
+	if comments[1].ParentCommentID == nil || *comments[1].ParentCommentID != parent.ID {
+		t.Errorf("Ожидался ответ на комментарий %d", parent.ID)
+	}
+}
+
+func BenchmarkInMemoryGetCommentsByPostID(b *testing.B) {
+	for _, total := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("comments=%d", total), func(b *testing.B) {
+			store := NewInMemoryCommentStorage()
+			const posts = 100
+			for i := 0; i < total; i++ {
+				comment := &models.Comment{PostID: i%posts + 1, Text: "Comment", Author: "User", CreatedAt: time.Now()}
+				if err := store.CreateComment(comment); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := store.GetCommentsByPostID(i%posts+1, 10, 5); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInMemoryGetCommentsByPostIDParallel(b *testing.B) {
+	store := NewInMemoryCommentStorage()
+	const posts = 100
+	for i := 0; i < 10000; i++ {
+		comment := &models.Comment{PostID: i%posts + 1, Text: "Comment", Author: "User", CreatedAt: time.Now()}
+		if err := store.CreateComment(comment); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := store.GetCommentsByPostID(i%posts+1, 10, 5); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+func TestInMemoryTxManagerSerializes(t *testing.T) {
+	posts := NewInMemoryPostStorage()
+	comments := NewInMemoryCommentStorage()
+	txManager := NewInMemoryTxManager(posts, comments)
+	post := &models.Post{Title: "Test", Text: "Text", AllowComments: true, Author: "Author", CreatedAt: time.Now()}
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := make(chan error)
+	err := txManager.WithinTx(func(tx Tx) error {
+		locked, err := tx.GetPostForShare(post.ID)
+		if err != nil {
+			return err
+		}
+		go func() {
+			disabled <- txManager.WithinTx(func(tx Tx) error {
+				p, err := tx.GetPostForUpdate(post.ID)
+				if err != nil {
+					return err
+				}
+				p.AllowComments = false
+				return tx.Posts().UpdatePost(p)
+			})
+		}()
+		// Конкурирующая транзакция не должна успеть изменить пост
+		time.Sleep(20 * time.Millisecond)
+		current, _ := posts.GetPostByID(post.ID)
+		if !locked.AllowComments || !current.AllowComments {
+			t.Error("Пост изменён до завершения транзакции")
+		}
+		return tx.Comments().CreateComment(&models.Comment{PostID: post.ID, Text: "Comment", Author: "User", CreatedAt: time.Now()})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-disabled; err != nil {
+		t.Fatal(err)
+	}
+
+	updated, _ := posts.GetPostByID(post.ID)
+	if updated.AllowComments {
+		t.Error("Ожидалось, что комментарии будут отключены")
+	}
+}
+
+func TestSQLiteTxManagerRollback(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	posts := NewSQLitePostStorage(db)
+	comments := NewSQLiteCommentStorage(db)
+	txManager := NewSQLiteTxManager(db)
+	post := &models.Post{Title: "Test", Text: "Text", AllowComments: true, Author: "Author", CreatedAt: time.Now()}
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+
+	errAbort := errors.New("abort")
+	err := txManager.WithinTx(func(tx Tx) error {
+		if _, err := tx.GetPostForShare(post.ID); err != nil {
+			return err
+		}
+		if err := tx.Comments().CreateComment(&models.Comment{PostID: post.ID, Text: "Comment", Author: "User", CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Ожидалась ошибка транзакции, получено %v", err)
+	}
+	if page, _ := comments.GetCommentsByPostID(post.ID, 10, 0); len(page) != 0 {
+		t.Errorf("Ожидался откат вставки, получено %d комментариев", len(page))
+	}
+
+	err = txManager.WithinTx(func(tx Tx) error {
+		return tx.Comments().CreateComment(&models.Comment{PostID: post.ID, Text: "Comment", Author: "User", CreatedAt: time.Now()})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page, _ := comments.GetCommentsByPostID(post.ID, 10, 0); len(page) != 1 {
+		t.Errorf("Ожидался 1 комментарий после фиксации, получено %d", len(page))
+	}
+}
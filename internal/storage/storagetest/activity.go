@@ -0,0 +1,106 @@
+package storagetest
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// ActivityFactory возвращает пустые хранилища и хранилище активности на их данные.
+type ActivityFactory func(t *testing.T) (storage.PostStorage, storage.CommentStorage, storage.ReactionStorage, storage.ActivityStorage)
+
+// RunActivity прогоняет проверки выборки активности для горячей ленты.
+func RunActivity(t *testing.T, factory ActivityFactory) {
+	t.Run("Window", func(t *testing.T) { testActivityWindow(t, factory) })
+	t.Run("Reactions", func(t *testing.T) { testActivityReactions(t, factory) })
+}
+
+func mustGetActivity(t *testing.T, activity storage.ActivityStorage, since, until time.Time) []models.Activity {
+	t.Helper()
+	result, err := activity.GetActivity(since, until)
+	if err != nil {
+		t.Fatalf("Ошибка чтения активности: %v", err)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+func testActivityWindow(t *testing.T, factory ActivityFactory) {
+	posts, comments, _, activity := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	base := time.Now().UTC().Truncate(time.Microsecond).Add(-time.Hour)
+	// Время в другом поясе сравнивается по моменту, а не по записи
+	moscow := time.FixedZone("MSK", 3*60*60)
+	for i, createdAt := range []time.Time{
+		base.Add(-time.Minute),
+		base,
+		base.Add(time.Second).In(moscow),
+		base.Add(10 * time.Minute),
+		base.Add(20 * time.Minute),
+	} {
+		comment := newComment(post.ID, nil, "Comment")
+		comment.CreatedAt = createdAt
+		if err := comments.CreateComment(comment); err != nil {
+			t.Fatalf("Комментарий %d: %v", i, err)
+		}
+	}
+
+	// Полуинтервал (base, base+10m]: первые два комментария и последний не входят
+	got := mustGetActivity(t, activity, base, base.Add(10*time.Minute))
+	if len(got) != 2 {
+		t.Fatalf("Ожидалось 2 события, получено %v", got)
+	}
+	if !got[0].CreatedAt.Equal(base.Add(time.Second)) || !got[1].CreatedAt.Equal(base.Add(10*time.Minute)) {
+		t.Errorf("Неожиданное время событий: %v", got)
+	}
+	for _, a := range got {
+		if a.PostID != post.ID || a.Reaction != "" {
+			t.Errorf("Ожидался комментарий к посту %d, получено %+v", post.ID, a)
+		}
+	}
+
+	if got := mustGetActivity(t, activity, base.Add(time.Hour), base.Add(2*time.Hour)); len(got) != 0 {
+		t.Errorf("Ожидалась пустая выборка, получено %v", got)
+	}
+}
+
+func testActivityReactions(t *testing.T, factory ActivityFactory) {
+	posts, comments, reactions, activity := factory(t)
+	since := time.Now().Add(-time.Minute)
+	post := mustCreatePost(t, posts, "Test")
+	other := mustCreatePost(t, posts, "Other")
+	comment := mustCreateComment(t, comments, other.ID, nil, "Comment")
+
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetPost, post.ID, "alice", models.ReactionUpvote))
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetComment, comment.ID, "alice", "👍"))
+	removed := newReaction(models.ReactionTargetPost, post.ID, "bob", models.ReactionDownvote)
+	mustSetReaction(t, reactions, removed)
+	if err := reactions.RemoveReaction(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Повтор реакции того же вида сохраняет её прежнее время
+	repeated := newReaction(models.ReactionTargetPost, post.ID, "alice", models.ReactionUpvote)
+	repeated.CreatedAt = repeated.CreatedAt.Add(time.Hour)
+	mustSetReaction(t, reactions, repeated)
+	if got := mustGetActivity(t, activity, time.Now().Add(time.Minute), time.Now().Add(2*time.Hour)); len(got) != 0 {
+		t.Errorf("Повтор реакции не должен считаться новой активностью, получено %v", got)
+	}
+
+	got := mustGetActivity(t, activity, since, time.Now().Add(time.Minute))
+	kinds := map[int][]string{}
+	for _, a := range got {
+		kinds[a.PostID] = append(kinds[a.PostID], a.Reaction)
+	}
+	sort.Strings(kinds[other.ID])
+	if len(kinds[post.ID]) != 1 || kinds[post.ID][0] != models.ReactionUpvote {
+		t.Errorf("Ожидалась одна реакция upvote на пост, получено %v", kinds[post.ID])
+	}
+	// Комментарий и реакция на него относятся к посту комментария
+	if len(kinds[other.ID]) != 2 || kinds[other.ID][0] != "" || kinds[other.ID][1] != "👍" {
+		t.Errorf("Ожидались комментарий и реакция 👍, получено %v", kinds[other.ID])
+	}
+}
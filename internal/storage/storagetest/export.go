@@ -0,0 +1,160 @@
+package storagetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// ExportFactory возвращает пустые хранилища и хранилище выгрузки их данных.
+type ExportFactory func(t *testing.T) (storage.PostStorage, storage.CommentStorage, storage.ExportStorage)
+
+// RunExport прогоняет проверки выгрузки постов и комментариев.
+func RunExport(t *testing.T, factory ExportFactory) {
+	t.Run("All", func(t *testing.T) { testExportAll(t, factory) })
+	t.Run("Batches", func(t *testing.T) { testExportBatches(t, factory) })
+	t.Run("Cursor", func(t *testing.T) { testExportCursor(t, factory) })
+	t.Run("DateRange", func(t *testing.T) { testExportDateRange(t, factory) })
+	t.Run("StopOnError", func(t *testing.T) { testExportStopOnError(t, factory) })
+}
+
+func exportedPosts(t *testing.T, export storage.ExportStorage, filter storage.ExportFilter) []*models.Post {
+	t.Helper()
+	var posts []*models.Post
+	err := export.EachPost(filter, func(post *models.Post) error {
+		posts = append(posts, post)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return posts
+}
+
+func exportedComments(t *testing.T, export storage.ExportStorage, filter storage.ExportFilter) []*models.Comment {
+	t.Helper()
+	var comments []*models.Comment
+	err := export.EachComment(filter, func(comment *models.Comment) error {
+		comments = append(comments, comment)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comments
+}
+
+func testExportAll(t *testing.T, factory ExportFactory) {
+	posts, comments, export := factory(t)
+	first := mustCreatePost(t, posts, "First")
+	mustCreatePending(t, posts, "Pending")
+	root := newComment(first.ID, nil, "Root")
+	comments.CreateComment(root)
+	reply := newComment(first.ID, &root.ID, "Reply")
+	reply.Status = models.StatusRejected
+	comments.CreateComment(reply)
+
+	got := exportedPosts(t, export, storage.ExportFilter{})
+	if titles := postTitles(got); len(titles) != 2 || titles[0] != "First" || titles[1] != "Pending" {
+		t.Fatalf("Ожидались все посты по порядку ID, получено %v", titles)
+	}
+	if got[0].Author != first.Author || !got[0].CreatedAt.Equal(first.CreatedAt) || got[0].Version != 1 || got[0].UpdatedAt.IsZero() {
+		t.Errorf("Пост выгружен не полностью: %+v", got[0])
+	}
+
+	gotComments := exportedComments(t, export, storage.ExportFilter{})
+	if texts := commentTexts(gotComments); len(texts) != 2 || texts[0] != "Root" || texts[1] != "Reply" {
+		t.Fatalf("Ожидались все комментарии по порядку ID, получено %v", texts)
+	}
+	if parent := gotComments[1].ParentCommentID; parent == nil || *parent != root.ID || gotComments[1].Status != models.StatusRejected {
+		t.Errorf("Ответ выгружен не полностью: %+v", gotComments[1])
+	}
+}
+
+// Записей больше, чем читается за одну порцию
+func testExportBatches(t *testing.T, factory ExportFactory) {
+	posts, comments, export := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	const count = 1200
+	for i := 0; i < count; i++ {
+		if err := comments.CreateComment(newComment(post.ID, nil, "Comment")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := exportedComments(t, export, storage.ExportFilter{})
+	if len(got) != count {
+		t.Fatalf("Ожидалось %d комментариев, получено %d", count, len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].ID <= got[i-1].ID {
+			t.Fatalf("Нарушен порядок ID: %d после %d", got[i].ID, got[i-1].ID)
+		}
+	}
+}
+
+func testExportCursor(t *testing.T, factory ExportFactory) {
+	posts, comments, export := factory(t)
+	first := mustCreatePost(t, posts, "First")
+	second := mustCreatePost(t, posts, "Second")
+	mustCreatePost(t, posts, "Third")
+	comment := newComment(first.ID, nil, "First")
+	comments.CreateComment(comment)
+	comments.CreateComment(newComment(first.ID, nil, "Second"))
+
+	if titles := postTitles(exportedPosts(t, export, storage.ExportFilter{AfterID: first.ID})); len(titles) != 2 || titles[0] != "Second" {
+		t.Errorf("Ожидались посты после первого, получено %v", titles)
+	}
+	if got := exportedPosts(t, export, storage.ExportFilter{AfterID: second.ID + 1}); len(got) != 0 {
+		t.Errorf("После последнего поста выгрузка должна быть пустой, получено %v", postTitles(got))
+	}
+	if texts := commentTexts(exportedComments(t, export, storage.ExportFilter{AfterID: comment.ID})); len(texts) != 1 || texts[0] != "Second" {
+		t.Errorf("Ожидался комментарий после первого, получено %v", texts)
+	}
+}
+
+func testExportDateRange(t *testing.T, factory ExportFactory) {
+	posts, comments, export := factory(t)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// Время в другом поясе сравнивается по моменту, а не по записи
+	msk := time.FixedZone("MSK", 3*60*60)
+	for i, title := range []string{"Before", "From", "Inside", "To"} {
+		post := newPost(title)
+		post.CreatedAt = base.Add(time.Duration(i-1) * 24 * time.Hour).In(msk)
+		if err := posts.CreatePost(post); err != nil {
+			t.Fatal(err)
+		}
+		comment := newComment(post.ID, nil, title)
+		comment.CreatedAt = post.CreatedAt
+		comments.CreateComment(comment)
+	}
+
+	filter := storage.ExportFilter{From: base, To: base.Add(48 * time.Hour)}
+	if titles := postTitles(exportedPosts(t, export, filter)); len(titles) != 2 || titles[0] != "From" || titles[1] != "Inside" {
+		t.Errorf("Ожидались посты из [From, To), получено %v", titles)
+	}
+	if texts := commentTexts(exportedComments(t, export, filter)); len(texts) != 2 || texts[0] != "From" || texts[1] != "Inside" {
+		t.Errorf("Ожидались комментарии из [From, To), получено %v", texts)
+	}
+	if titles := postTitles(exportedPosts(t, export, storage.ExportFilter{From: base.Add(time.Nanosecond)})); len(titles) != 2 || titles[0] != "Inside" {
+		t.Errorf("Ожидались посты после From, получено %v", titles)
+	}
+}
+
+func testExportStopOnError(t *testing.T, factory ExportFactory) {
+	posts, _, export := factory(t)
+	mustCreatePost(t, posts, "First")
+	mustCreatePost(t, posts, "Second")
+
+	stop := errors.New("stop")
+	calls := 0
+	err := export.EachPost(storage.ExportFilter{}, func(*models.Post) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Ошибка обработчика должна останавливать выгрузку, получено %v после %d вызовов", err, calls)
+	}
+}
@@ -0,0 +1,115 @@
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// IdempotencyFactory возвращает пустое хранилище ключей идемпотентности.
+type IdempotencyFactory func(t *testing.T) storage.IdempotencyStorage
+
+// RunIdempotency прогоняет проверки ключей идемпотентности.
+func RunIdempotency(t *testing.T, factory IdempotencyFactory) {
+	t.Run("ReserveAndReplay", func(t *testing.T) { testReserveAndReplay(t, factory) })
+	t.Run("Expiry", func(t *testing.T) { testIdempotencyExpiry(t, factory) })
+	t.Run("Release", func(t *testing.T) { testIdempotencyRelease(t, factory) })
+}
+
+func newIdempotencyRecord(owner, key string, createdAt time.Time) *models.IdempotencyRecord {
+	return &models.IdempotencyRecord{Owner: owner, Key: key, RequestHash: "hash", CreatedAt: createdAt}
+}
+
+func mustReserve(t *testing.T, s storage.IdempotencyStorage, record *models.IdempotencyRecord, expiredBefore, abandonedBefore time.Time) *models.IdempotencyRecord {
+	t.Helper()
+	existing, err := s.ReserveIdempotencyKey(record, expiredBefore, abandonedBefore)
+	if err != nil {
+		t.Fatalf("Ошибка резервирования ключа: %v", err)
+	}
+	return existing
+}
+
+func testReserveAndReplay(t *testing.T, factory IdempotencyFactory) {
+	s := factory(t)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	past := now.Add(-time.Hour)
+
+	record := newIdempotencyRecord("user:alice", "k1", now)
+	if existing := mustReserve(t, s, record, past, past); existing != nil {
+		t.Fatalf("Свободный ключ должен резервироваться, получено %+v", existing)
+	}
+	existing := mustReserve(t, s, newIdempotencyRecord("user:alice", "k1", now), past, past)
+	if existing == nil || existing.StatusCode != 0 || existing.RequestHash != "hash" {
+		t.Fatalf("Ожидалась незавершённая запись, получено %+v", existing)
+	}
+	if other := mustReserve(t, s, newIdempotencyRecord("user:bob", "k1", now), past, past); other != nil {
+		t.Errorf("Ключи разных владельцев не должны пересекаться, получено %+v", other)
+	}
+
+	record.StatusCode = 201
+	record.ContentType = "application/json"
+	record.Headers = map[string]string{"ETag": `"1.abc"`}
+	record.Body = []byte(`{"id":1}`)
+	if err := s.SaveIdempotentResponse(record); err != nil {
+		t.Fatal(err)
+	}
+	existing = mustReserve(t, s, newIdempotencyRecord("user:alice", "k1", now), past, past)
+	if existing == nil || existing.StatusCode != 201 || existing.ContentType != "application/json" ||
+		existing.Headers["ETag"] != `"1.abc"` || string(existing.Body) != `{"id":1}` || !existing.CreatedAt.Equal(now) {
+		t.Errorf("Ожидался сохранённый ответ, получено %+v", existing)
+	}
+
+	if err := s.SaveIdempotentResponse(newIdempotencyRecord("user:alice", "missing", now)); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound для незанятого ключа, получено %v", err)
+	}
+}
+
+func testIdempotencyExpiry(t *testing.T, factory IdempotencyFactory) {
+	s := factory(t)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	old := now.Add(-2 * time.Hour)
+
+	done := newIdempotencyRecord("user:alice", "done", old)
+	mustReserve(t, s, done, old.Add(-time.Hour), old.Add(-time.Hour))
+	done.StatusCode = 200
+	s.SaveIdempotentResponse(done)
+	mustReserve(t, s, newIdempotencyRecord("user:alice", "stuck", old), old.Add(-time.Hour), old.Add(-time.Hour))
+
+	// Завершённая запись живёт до истечения TTL, незавершённая — до истечения блокировки
+	ttl, lock := now.Add(-3*time.Hour), now.Add(-time.Minute)
+	if existing := mustReserve(t, s, newIdempotencyRecord("user:alice", "done", now), ttl, lock); existing == nil {
+		t.Error("Завершённая запись в пределах TTL должна возвращаться")
+	}
+	if existing := mustReserve(t, s, newIdempotencyRecord("user:alice", "stuck", now), ttl, lock); existing != nil {
+		t.Errorf("Брошенный ключ должен заниматься заново, получено %+v", existing)
+	}
+	if existing := mustReserve(t, s, newIdempotencyRecord("user:alice", "done", now), now.Add(-time.Hour), lock); existing != nil {
+		t.Errorf("Запись старше TTL должна заменяться, получено %+v", existing)
+	}
+
+	mustReserve(t, s, newIdempotencyRecord("user:alice", "purged", old), old, old)
+	if err := s.PurgeIdempotencyKeys(now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if existing := mustReserve(t, s, newIdempotencyRecord("user:alice", "purged", now), old, old); existing != nil {
+		t.Errorf("Удалённая запись не должна возвращаться, получено %+v", existing)
+	}
+	if existing := mustReserve(t, s, newIdempotencyRecord("user:alice", "stuck", now), old, old); existing == nil {
+		t.Error("Свежая запись не должна удаляться")
+	}
+}
+
+func testIdempotencyRelease(t *testing.T, factory IdempotencyFactory) {
+	s := factory(t)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	past := now.Add(-time.Hour)
+	mustReserve(t, s, newIdempotencyRecord("user:alice", "k1", now), past, past)
+	if err := s.ReleaseIdempotencyKey("user:alice", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if existing := mustReserve(t, s, newIdempotencyRecord("user:alice", "k1", now), past, past); existing != nil {
+		t.Errorf("Освобождённый ключ должен заниматься заново, получено %+v", existing)
+	}
+}
@@ -0,0 +1,213 @@
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// ModerationFactory возвращает пустые хранилища и хранилище очереди модерации на их данные.
+type ModerationFactory func(t *testing.T) (storage.PostStorage, storage.CommentStorage, storage.ModerationStorage)
+
+// RunModeration прогоняет проверки статусов модерации и очереди.
+func RunModeration(t *testing.T, factory ModerationFactory) {
+	t.Run("DefaultStatus", func(t *testing.T) { testDefaultStatus(t, factory) })
+	t.Run("Visibility", func(t *testing.T) { testVisibility(t, factory) })
+	t.Run("TreeVisibility", func(t *testing.T) { testTreeVisibility(t, factory) })
+	t.Run("Queue", func(t *testing.T) { testModerationQueue(t, factory) })
+	t.Run("SetStatus", func(t *testing.T) { testSetStatus(t, factory) })
+}
+
+func mustCreatePending(t *testing.T, posts storage.PostStorage, title string) *models.Post {
+	t.Helper()
+	post := newPost(title)
+	post.Status = models.StatusPending
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatalf("Ошибка создания поста: %v", err)
+	}
+	return post
+}
+
+func postTitles(posts []*models.Post) []string {
+	titles := make([]string, len(posts))
+	for i, post := range posts {
+		titles[i] = post.Title
+	}
+	return titles
+}
+
+func testDefaultStatus(t *testing.T, factory ModerationFactory) {
+	posts, comments, _ := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusApproved {
+		t.Errorf("Ожидался статус approved, получен %q", got.Status)
+	}
+	comment := newComment(post.ID, nil, "Comment")
+	if err := comments.CreateComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if comment.Status != models.StatusApproved {
+		t.Errorf("Ожидался статус комментария approved, получен %q", comment.Status)
+	}
+}
+
+func testVisibility(t *testing.T, factory ModerationFactory) {
+	posts, comments, _ := factory(t)
+	approved := mustCreatePost(t, posts, "Approved")
+	mustCreatePending(t, posts, "Pending")
+
+	for _, tc := range []struct {
+		viewer string
+		want   int
+	}{{"", 1}, {"Stranger", 1}, {"Author", 2}} {
+		visible, err := posts.GetVisiblePosts(tc.viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(visible) != tc.want {
+			t.Errorf("viewer %q: ожидалось постов %d, получено %v", tc.viewer, tc.want, postTitles(visible))
+		}
+	}
+	if all, _ := posts.GetAllPosts(); len(all) != 2 {
+		t.Errorf("GetAllPosts должен возвращать все посты, получено %d", len(all))
+	}
+
+	comments.CreateComment(newComment(approved.ID, nil, "Visible"))
+	pending := newComment(approved.ID, nil, "Hidden")
+	pending.Status = models.StatusPending
+	if err := comments.CreateComment(pending); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ := comments.GetVisibleComments(approved.ID, "", 10, 0); len(page) != 1 || page[0].Text != "Visible" {
+		t.Errorf("Аноним должен видеть только одобренный комментарий, получено %v", commentTexts(page))
+	}
+	if page, _ := comments.GetVisibleComments(approved.ID, "User", 10, 0); len(page) != 2 {
+		t.Errorf("Автор должен видеть свой комментарий, получено %v", commentTexts(page))
+	}
+}
+
+func commentTexts(comments []*models.Comment) []string {
+	texts := make([]string, len(comments))
+	for i, comment := range comments {
+		texts[i] = comment.Text
+	}
+	return texts
+}
+
+func testTreeVisibility(t *testing.T, factory ModerationFactory) {
+	posts, comments, _ := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	root := newComment(post.ID, nil, "Root")
+	comments.CreateComment(root)
+	pending := newComment(post.ID, &root.ID, "Pending")
+	pending.Status = models.StatusPending
+	if err := comments.CreateComment(pending); err != nil {
+		t.Fatal(err)
+	}
+	reply := newComment(post.ID, &pending.ID, "Reply")
+	reply.Author = "Other"
+	comments.CreateComment(reply)
+
+	// Одобренный ответ на скрытый комментарий скрыт вместе с ним
+	got, err := comments.GetCommentTree(post.ID, "", storage.CommentSortOld, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts := commentTexts(got); len(texts) != 1 || texts[0] != "Root" {
+		t.Errorf("Аноним: ожидалось [Root], получено %v", texts)
+	}
+	got, _ = comments.GetCommentTree(post.ID, "User", storage.CommentSortOld, 10, 0)
+	if texts := commentTexts(got); len(texts) != 3 || texts[1] != "Pending" || texts[2] != "Reply" {
+		t.Errorf("Автор: ожидалось [Root Pending Reply], получено %v", texts)
+	}
+}
+
+func testModerationQueue(t *testing.T, factory ModerationFactory) {
+	posts, comments, moderation := factory(t)
+	base := time.Now().UTC().Truncate(time.Microsecond).Add(-time.Hour)
+
+	post := newPost("Pending")
+	post.Status = models.StatusPending
+	post.CreatedAt = base.Add(time.Minute)
+	post.ModerationAction = "hold"
+	post.ModerationReason = "ссылок больше 3"
+	posts.CreatePost(post)
+	approved := mustCreatePost(t, posts, "Approved")
+
+	// Время в другом поясе сравнивается по моменту, а не по записи
+	older := newComment(approved.ID, nil, "Older")
+	older.Status = models.StatusPending
+	older.CreatedAt = base.In(time.FixedZone("MSK", 3*60*60))
+	comments.CreateComment(older)
+	comments.CreateComment(newComment(approved.ID, nil, "Visible"))
+
+	queue, err := moderation.GetModerationQueue(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 2 {
+		t.Fatalf("Ожидалось 2 записи в очереди, получено %d", len(queue))
+	}
+	first, second := queue[0], queue[1]
+	if first.Type != models.ModerationTargetComment || first.ID != older.ID || first.PostID != approved.ID || first.Text != "Older" {
+		t.Errorf("Первым ожидался старший комментарий, получено %+v", first)
+	}
+	if second.Type != models.ModerationTargetPost || second.ID != post.ID || second.PostID != post.ID ||
+		second.Title != "Pending" || second.ModerationAction != "hold" || second.ModerationReason != "ссылок больше 3" {
+		t.Errorf("Вторым ожидался пост, получено %+v", second)
+	}
+
+	page, _ := moderation.GetModerationQueue(1, 1)
+	if len(page) != 1 || page[0].ID != post.ID {
+		t.Errorf("Ожидалась вторая страница с постом, получено %v", page)
+	}
+}
+
+func testSetStatus(t *testing.T, factory ModerationFactory) {
+	posts, comments, moderation := factory(t)
+	post := mustCreatePending(t, posts, "Pending")
+	comment := newComment(post.ID, nil, "Pending")
+	comment.Status = models.StatusPending
+	comments.CreateComment(comment)
+
+	postID, err := moderation.SetStatus(models.ModerationTargetPost, post.ID, models.StatusApproved)
+	if err != nil || postID != post.ID {
+		t.Fatalf("Ошибка одобрения поста: %d, %v", postID, err)
+	}
+	if got, _ := posts.GetPostByID(post.ID); got.Version != post.Version+1 || got.UpdatedAt.Before(post.UpdatedAt) {
+		t.Errorf("Смена статуса должна увеличивать версию и обновлять время изменения, получено %+v", got)
+	}
+	if visible, _ := posts.GetVisiblePosts(""); len(visible) != 1 {
+		t.Error("Одобренный пост должен быть виден всем")
+	}
+
+	postID, err = moderation.SetStatus(models.ModerationTargetComment, comment.ID, models.StatusRejected)
+	if err != nil || postID != post.ID {
+		t.Fatalf("Ошибка отклонения комментария: %d, %v", postID, err)
+	}
+	if page, _ := comments.GetVisibleComments(post.ID, "", 10, 0); len(page) != 0 {
+		t.Error("Отклонённый комментарий не должен быть виден")
+	}
+	if page, _ := comments.GetVisibleComments(post.ID, "User", 10, 0); len(page) != 1 || page[0].Status != models.StatusRejected {
+		t.Errorf("Автор должен видеть свой отклонённый комментарий, получено %v", page)
+	}
+	if queue, _ := moderation.GetModerationQueue(10, 0); len(queue) != 0 {
+		t.Errorf("Очередь должна опустеть, получено %d", len(queue))
+	}
+
+	if _, err := moderation.SetStatus(models.ModerationTargetPost, 999, models.StatusApproved); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound для несуществующего поста, получено %v", err)
+	}
+	if _, err := moderation.SetStatus(models.ModerationTargetComment, 999, models.StatusApproved); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound для несуществующего комментария, получено %v", err)
+	}
+	if _, err := moderation.SetStatus("user", post.ID, models.StatusApproved); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound для неизвестной цели, получено %v", err)
+	}
+}
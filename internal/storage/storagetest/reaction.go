@@ -0,0 +1,180 @@
+package storagetest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// ReactionFactory возвращает пустые хранилища и хранилище реакций на их данные.
+type ReactionFactory func(t *testing.T) (storage.PostStorage, storage.CommentStorage, storage.ReactionStorage)
+
+// RunReactions прогоняет проверки реакций и их счётчиков в моделях.
+func RunReactions(t *testing.T, factory ReactionFactory) {
+	t.Run("PostCounts", func(t *testing.T) { testPostReactionCounts(t, factory) })
+	t.Run("CommentCounts", func(t *testing.T) { testCommentReactionCounts(t, factory) })
+	t.Run("Remove", func(t *testing.T) { testRemoveReaction(t, factory) })
+	t.Run("MissingTarget", func(t *testing.T) { testReactionMissingTarget(t, factory) })
+	t.Run("TouchesTarget", func(t *testing.T) { testReactionTouchesTarget(t, factory) })
+}
+
+func newReaction(targetType string, targetID int, author, kind string) *models.Reaction {
+	return &models.Reaction{
+		TargetType: targetType,
+		TargetID:   targetID,
+		Author:     author,
+		Kind:       kind,
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func mustSetReaction(t *testing.T, reactions storage.ReactionStorage, reaction *models.Reaction) {
+	t.Helper()
+	if err := reactions.SetReaction(reaction); err != nil {
+		t.Fatalf("Ошибка сохранения реакции: %v", err)
+	}
+}
+
+func testPostReactionCounts(t *testing.T, factory ReactionFactory) {
+	posts, _, reactions := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	other := mustCreatePost(t, posts, "Other")
+
+	upvote := newReaction(models.ReactionTargetPost, post.ID, "alice", models.ReactionUpvote)
+	mustSetReaction(t, reactions, upvote)
+	if upvote.PostID != post.ID {
+		t.Errorf("Ожидался PostID %d, получено %d", post.ID, upvote.PostID)
+	}
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetPost, post.ID, "bob", models.ReactionUpvote))
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetPost, post.ID, "carol", "👍"))
+	// Повторная реакция автора заменяет прежнюю
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetPost, post.ID, "bob", models.ReactionDownvote))
+
+	want := map[string]int{models.ReactionUpvote: 1, models.ReactionDownvote: 1, "👍": 1}
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Reactions, want) {
+		t.Errorf("Ожидались реакции %v, получено %v", want, got.Reactions)
+	}
+
+	all, err := posts.GetAllPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all[0].Reactions, want) {
+		t.Errorf("GetAllPosts: ожидались реакции %v, получено %v", want, all[0].Reactions)
+	}
+	if all[1].ID != other.ID || all[1].Reactions == nil || len(all[1].Reactions) != 0 {
+		t.Errorf("Ожидались пустые (не nil) реакции другого поста, получено %v", all[1].Reactions)
+	}
+}
+
+func testCommentReactionCounts(t *testing.T, factory ReactionFactory) {
+	posts, comments, reactions := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	first := mustCreateComment(t, comments, post.ID, nil, "First")
+	mustCreateComment(t, comments, post.ID, nil, "Second")
+
+	reaction := newReaction(models.ReactionTargetComment, first.ID, "alice", models.ReactionUpvote)
+	mustSetReaction(t, reactions, reaction)
+	if reaction.PostID != post.ID {
+		t.Errorf("Ожидался PostID %d, получено %d", post.ID, reaction.PostID)
+	}
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetComment, first.ID, "bob", models.ReactionUpvote))
+
+	page, err := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Reactions[models.ReactionUpvote] != 2 || len(page[1].Reactions) != 0 {
+		t.Errorf("Ожидалось 2 upvote у первого комментария, получено %+v", page)
+	}
+	// Реакции на комментарий не влияют на счётчики поста
+	if got, _ := posts.GetPostByID(post.ID); len(got.Reactions) != 0 {
+		t.Errorf("Ожидались пустые реакции поста, получено %v", got.Reactions)
+	}
+}
+
+func testRemoveReaction(t *testing.T, factory ReactionFactory) {
+	posts, _, reactions := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetPost, post.ID, "alice", models.ReactionUpvote))
+
+	removed := &models.Reaction{TargetType: models.ReactionTargetPost, TargetID: post.ID, Author: "alice"}
+	if err := reactions.RemoveReaction(removed); err != nil {
+		t.Fatal(err)
+	}
+	if removed.PostID != post.ID {
+		t.Errorf("Ожидался PostID %d, получено %d", post.ID, removed.PostID)
+	}
+	if got, _ := posts.GetPostByID(post.ID); len(got.Reactions) != 0 {
+		t.Errorf("Ожидались пустые реакции после удаления, получено %v", got.Reactions)
+	}
+	if err := reactions.RemoveReaction(removed); err != storage.ErrNotFound {
+		t.Errorf("Повторное удаление: ожидалась ошибка ErrNotFound, получено %v", err)
+	}
+}
+
+func testReactionMissingTarget(t *testing.T, factory ReactionFactory) {
+	posts, _, reactions := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+
+	for _, reaction := range []*models.Reaction{
+		newReaction(models.ReactionTargetPost, post.ID+1000, "alice", models.ReactionUpvote),
+		newReaction(models.ReactionTargetComment, 1000, "alice", models.ReactionUpvote),
+	} {
+		if err := reactions.SetReaction(reaction); err != storage.ErrNotFound {
+			t.Errorf("SetReaction(%s): ожидалась ошибка ErrNotFound, получено %v", reaction.TargetType, err)
+		}
+		if err := reactions.RemoveReaction(reaction); err != storage.ErrNotFound {
+			t.Errorf("RemoveReaction(%s): ожидалась ошибка ErrNotFound, получено %v", reaction.TargetType, err)
+		}
+	}
+}
+
+func testReactionTouchesTarget(t *testing.T, factory ReactionFactory) {
+	posts, comments, reactions := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	comment := mustCreateComment(t, comments, post.ID, nil, "Comment")
+
+	upvote := newReaction(models.ReactionTargetPost, post.ID, "alice", models.ReactionUpvote)
+	upvote.CreatedAt = post.UpdatedAt.Add(time.Hour)
+	mustSetReaction(t, reactions, upvote)
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Реакция меняет время изменения поста, но не его версию
+	if !got.UpdatedAt.Equal(upvote.CreatedAt) || got.Version != post.Version {
+		t.Errorf("Ожидалось время изменения %v и версия %d, получено %+v", upvote.CreatedAt, post.Version, got)
+	}
+	if last, err := posts.LastModified(); err != nil || !last.Equal(upvote.CreatedAt) {
+		t.Errorf("Ожидалось время изменения постов %v, получено %v, %v", upvote.CreatedAt, last, err)
+	}
+
+	removed := &models.Reaction{TargetType: models.ReactionTargetPost, TargetID: post.ID, Author: "alice",
+		CreatedAt: upvote.CreatedAt.Add(time.Hour)}
+	if err := reactions.RemoveReaction(removed); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := posts.GetPostByID(post.ID); !got.UpdatedAt.Equal(removed.CreatedAt) {
+		t.Errorf("Снятие реакции должно менять время изменения, получено %v", got.UpdatedAt)
+	}
+	// Время изменения не уменьшается
+	mustSetReaction(t, reactions, newReaction(models.ReactionTargetPost, post.ID, "bob", models.ReactionUpvote))
+	if got, _ := posts.GetPostByID(post.ID); !got.UpdatedAt.Equal(removed.CreatedAt) {
+		t.Errorf("Ожидалось время изменения %v, получено %v", removed.CreatedAt, got.UpdatedAt)
+	}
+
+	reaction := newReaction(models.ReactionTargetComment, comment.ID, "alice", "👍")
+	reaction.CreatedAt = comment.UpdatedAt.Add(time.Hour)
+	mustSetReaction(t, reactions, reaction)
+	if last, err := comments.LastModified(post.ID); err != nil || !last.Equal(reaction.CreatedAt) {
+		t.Errorf("Ожидалось время изменения комментариев %v, получено %v, %v", reaction.CreatedAt, last, err)
+	}
+}
@@ -0,0 +1,208 @@
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// ReportFactory возвращает пустые хранилища и хранилище жалоб на их данные.
+type ReportFactory func(t *testing.T) (storage.PostStorage, storage.CommentStorage, storage.ReportStorage)
+
+// RunReports прогоняет проверки жалоб и скрытия по порогу.
+func RunReports(t *testing.T, factory ReportFactory) {
+	t.Run("Create", func(t *testing.T) { testCreateReport(t, factory) })
+	t.Run("HideThreshold", func(t *testing.T) { testReportHideThreshold(t, factory) })
+	t.Run("OpenReports", func(t *testing.T) { testOpenReports(t, factory) })
+	t.Run("Resolve", func(t *testing.T) { testResolveReports(t, factory) })
+	t.Run("ResolveStatus", func(t *testing.T) { testResolveStatus(t, factory) })
+}
+
+func newReport(targetType string, targetID int, reporter string) *models.Report {
+	return &models.Report{
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reporter:   reporter,
+		Reason:     models.ReportReasonSpam,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func mustReport(t *testing.T, reports storage.ReportStorage, report *models.Report, hideAt int) bool {
+	t.Helper()
+	hidden, err := reports.CreateReport(report, hideAt)
+	if err != nil {
+		t.Fatalf("Ошибка создания жалобы: %v", err)
+	}
+	return hidden
+}
+
+func testCreateReport(t *testing.T, factory ReportFactory) {
+	posts, comments, reports := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	comment := mustCreateComment(t, comments, post.ID, nil, "Comment")
+
+	report := newReport(models.ReportTargetComment, comment.ID, "alice")
+	mustReport(t, reports, report, 0)
+	if report.PostID != post.ID {
+		t.Errorf("Ожидался PostID %d, получен %d", post.ID, report.PostID)
+	}
+	if _, err := reports.CreateReport(newReport(models.ReportTargetComment, comment.ID, "alice"), 0); err != storage.ErrDuplicateReport {
+		t.Errorf("Ожидалась ErrDuplicateReport для повторной жалобы, получено %v", err)
+	}
+	if _, err := reports.CreateReport(newReport(models.ReportTargetPost, 999, "alice"), 0); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound для несуществующего поста, получено %v", err)
+	}
+	if _, err := reports.CreateReport(newReport(models.ReportTargetComment, 999, "alice"), 0); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound для несуществующего комментария, получено %v", err)
+	}
+}
+
+func testReportHideThreshold(t *testing.T, factory ReportFactory) {
+	posts, _, reports := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+
+	if mustReport(t, reports, newReport(models.ReportTargetPost, post.ID, "alice"), 2) {
+		t.Error("Одной жалобы недостаточно для скрытия")
+	}
+	if !mustReport(t, reports, newReport(models.ReportTargetPost, post.ID, "bob"), 2) {
+		t.Error("Пост должен скрыться после второй жалобы")
+	}
+	if visible, _ := posts.GetVisiblePosts(""); len(visible) != 0 {
+		t.Error("Скрытый пост не должен быть виден")
+	}
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusPending {
+		t.Errorf("Ожидался статус pending, получен %q", got.Status)
+	}
+	// Уже скрытая цель не скрывается повторно
+	if mustReport(t, reports, newReport(models.ReportTargetPost, post.ID, "carol"), 2) {
+		t.Error("Повторное скрытие не ожидалось")
+	}
+
+	rejected := mustCreatePost(t, posts, "Rejected")
+	rejected.Status = models.StatusRejected
+	if err := posts.UpdatePost(rejected); err != nil {
+		t.Fatal(err)
+	}
+	if mustReport(t, reports, newReport(models.ReportTargetPost, rejected.ID, "alice"), 1) {
+		t.Error("Отклонённый пост не должен переводиться в pending")
+	}
+}
+
+func testOpenReports(t *testing.T, factory ReportFactory) {
+	posts, comments, reports := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	comment := mustCreateComment(t, comments, post.ID, nil, "Comment")
+	base := time.Now().UTC().Truncate(time.Microsecond).Add(-time.Hour)
+
+	later := newReport(models.ReportTargetPost, post.ID, "alice")
+	later.CreatedAt = base.Add(time.Minute)
+	later.Text = "Реклама"
+	mustReport(t, reports, later, 0)
+	// Время в другом поясе сравнивается по моменту, а не по записи
+	earlier := newReport(models.ReportTargetComment, comment.ID, "bob")
+	earlier.CreatedAt = base.In(time.FixedZone("MSK", 3*60*60))
+	earlier.Reason = models.ReportReasonAbuse
+	mustReport(t, reports, earlier, 0)
+
+	open, err := reports.GetOpenReports(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 {
+		t.Fatalf("Ожидалось 2 открытые жалобы, получено %d", len(open))
+	}
+	first, second := open[0], open[1]
+	if first.TargetType != models.ReportTargetComment || first.TargetID != comment.ID || first.PostID != post.ID ||
+		first.Reporter != "bob" || first.Reason != models.ReportReasonAbuse {
+		t.Errorf("Первой ожидалась жалоба на комментарий, получено %+v", first)
+	}
+	if second.TargetType != models.ReportTargetPost || second.TargetID != post.ID || second.PostID != post.ID ||
+		second.Text != "Реклама" || !second.CreatedAt.Equal(later.CreatedAt) {
+		t.Errorf("Второй ожидалась жалоба на пост, получено %+v", second)
+	}
+
+	page, _ := reports.GetOpenReports(1, 1)
+	if len(page) != 1 || page[0].Reporter != "alice" {
+		t.Errorf("Ожидалась вторая страница с жалобой alice, получено %v", page)
+	}
+}
+
+func testResolveReports(t *testing.T, factory ReportFactory) {
+	posts, _, reports := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	other := mustCreatePost(t, posts, "Other")
+	mustReport(t, reports, newReport(models.ReportTargetPost, post.ID, "alice"), 0)
+	mustReport(t, reports, newReport(models.ReportTargetPost, post.ID, "bob"), 0)
+	mustReport(t, reports, newReport(models.ReportTargetPost, other.ID, "alice"), 0)
+
+	n, postID, err := reports.ResolveReports(models.ReportTargetPost, post.ID, models.ReportDismiss, "moder")
+	if err != nil || n != 2 || postID != post.ID {
+		t.Fatalf("Ожидалось закрыть 2 жалобы, получено %d, %v", n, err)
+	}
+	open, _ := reports.GetOpenReports(10, 0)
+	if len(open) != 1 || open[0].TargetID != other.ID {
+		t.Errorf("Должна остаться жалоба на другой пост, получено %v", open)
+	}
+	if _, _, err := reports.ResolveReports(models.ReportTargetPost, post.ID, models.ReportDismiss, "moder"); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound без открытых жалоб, получено %v", err)
+	}
+	// Закрытая жалоба не даёт пожаловаться повторно
+	if _, err := reports.CreateReport(newReport(models.ReportTargetPost, post.ID, "alice"), 0); err != storage.ErrDuplicateReport {
+		t.Errorf("Ожидалась ErrDuplicateReport после закрытия, получено %v", err)
+	}
+	if _, _, err := reports.ResolveReports("user", post.ID, models.ReportDismiss, "moder"); err != storage.ErrNotFound {
+		t.Errorf("Ожидалась ErrNotFound для неизвестной цели, получено %v", err)
+	}
+}
+
+func postStatus(t *testing.T, posts storage.PostStorage, id int) string {
+	t.Helper()
+	post, err := posts.GetPostByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post.Status
+}
+
+// Отклонение жалоб возвращает одобрение только цели, которую скрыли они
+func testResolveStatus(t *testing.T, factory ReportFactory) {
+	posts, comments, reports := factory(t)
+	hidden := mustCreatePost(t, posts, "Hidden")
+	mustReport(t, reports, newReport(models.ReportTargetPost, hidden.ID, "alice"), 1)
+	if open, _ := reports.GetOpenReports(10, 0); len(open) != 1 || !open[0].HidTarget {
+		t.Errorf("Жалоба, скрывшая пост, должна быть отмечена, получено %+v", open)
+	}
+	if _, _, err := reports.ResolveReports(models.ReportTargetPost, hidden.ID, models.ReportDismiss, "moder"); err != nil {
+		t.Fatal(err)
+	}
+	if status := postStatus(t, posts, hidden.ID); status != models.StatusApproved {
+		t.Errorf("Скрытый жалобами пост должен вернуться в approved, получен %q", status)
+	}
+
+	held := mustCreatePending(t, posts, "Held")
+	mustReport(t, reports, newReport(models.ReportTargetPost, held.ID, "alice"), 1)
+	if _, _, err := reports.ResolveReports(models.ReportTargetPost, held.ID, models.ReportDismiss, "moder"); err != nil {
+		t.Fatal(err)
+	}
+	if status := postStatus(t, posts, held.ID); status != models.StatusPending {
+		t.Errorf("Пост, ожидающий модератора, не должен публиковаться, получен %q", status)
+	}
+
+	removed := mustCreatePost(t, posts, "Removed")
+	comment := mustCreateComment(t, comments, removed.ID, nil, "Comment")
+	mustReport(t, reports, newReport(models.ReportTargetComment, comment.ID, "alice"), 0)
+	n, postID, err := reports.ResolveReports(models.ReportTargetComment, comment.ID, models.ReportRemove, "moder")
+	if err != nil || n != 1 || postID != removed.ID {
+		t.Fatalf("Ожидалось закрыть жалобу на комментарий к посту %d, получено %d, %d, %v", removed.ID, n, postID, err)
+	}
+	if page, _ := comments.GetVisibleComments(removed.ID, "", 10, 0); len(page) != 0 {
+		t.Errorf("Удалённый по жалобе комментарий не должен быть виден, получено %d", len(page))
+	}
+}
@@ -0,0 +1,172 @@
+package storagetest
+
+import (
+	"strings"
+	"testing"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// SearchFactory возвращает пустые хранилища и поиск по их данным.
+type SearchFactory func(t *testing.T) (storage.PostStorage, storage.CommentStorage, storage.SearchStorage)
+
+// RunSearch прогоняет проверки полнотекстового поиска. Значения релевантности
+// у хранилищ различаются, поэтому проверяются только состав и порядок результатов.
+func RunSearch(t *testing.T, factory SearchFactory) {
+	t.Run("Matches", func(t *testing.T) { testSearchMatches(t, factory) })
+	t.Run("TitleRanksHigher", func(t *testing.T) { testSearchTitleRanksHigher(t, factory) })
+	t.Run("Pagination", func(t *testing.T) { testSearchPagination(t, factory) })
+	t.Run("UpdatedPost", func(t *testing.T) { testSearchUpdatedPost(t, factory) })
+	t.Run("HidesUnapproved", func(t *testing.T) { testSearchHidesUnapproved(t, factory) })
+}
+
+func mustSearch(t *testing.T, search storage.SearchStorage, query string, limit, offset int) []*models.SearchResult {
+	t.Helper()
+	results, err := search.Search(query, limit, offset)
+	if err != nil {
+		t.Fatalf("Ошибка поиска %q: %v", query, err)
+	}
+	if results == nil {
+		t.Fatalf("Поиск %q вернул nil вместо пустого среза", query)
+	}
+	return results
+}
+
+func testSearchMatches(t *testing.T, factory SearchFactory) {
+	posts, comments, search := factory(t)
+	post := newPost("Погода в Москве")
+	post.Text = "Сегодня солнечно"
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	other := mustCreatePost(t, posts, "Go generics")
+	comment := mustCreateComment(t, comments, post.ID, nil, "Москве повезло с погодой")
+	mustCreateComment(t, comments, other.ID, nil, "Отличная статья")
+
+	results := mustSearch(t, search, "МОСКВЕ", 10, 0)
+	if len(results) != 2 {
+		t.Fatalf("Ожидалось 2 результата, получено %+v", results)
+	}
+	if results[0].Type != models.SearchResultPost || results[0].ID != post.ID {
+		t.Errorf("Ожидался первым пост %d, получено %+v", post.ID, results[0])
+	}
+	if results[1].Type != models.SearchResultComment || results[1].ID != comment.ID || results[1].PostID != post.ID {
+		t.Errorf("Ожидался комментарий %d к посту %d, получено %+v", comment.ID, post.ID, results[1])
+	}
+	for _, result := range results {
+		if !strings.Contains(result.Snippet, "<b>Москве</b>") {
+			t.Errorf("Ожидалась подсветка совпадения, получено %q", result.Snippet)
+		}
+	}
+
+	// Текст пользователя в сниппете экранируется
+	unsafe := mustCreatePost(t, posts, "Рецепт")
+	mustCreateComment(t, comments, unsafe.ID, nil, "Рецепт <img src=x onerror=alert(1)> & \x02соус")
+	results = mustSearch(t, search, "соус", 10, 0)
+	if len(results) != 1 || strings.Contains(results[0].Snippet, "<img") ||
+		strings.Count(results[0].Snippet, "<b>") != strings.Count(results[0].Snippet, "</b>") {
+		t.Errorf("Ожидался экранированный сниппет, получено %+v", results)
+	}
+
+	// Найдены только документы со всеми словами запроса
+	results = mustSearch(t, search, "москве солнечно", 10, 0)
+	if len(results) != 1 || results[0].ID != post.ID {
+		t.Errorf("Ожидался только пост %d, получено %+v", post.ID, results)
+	}
+
+	if results := mustSearch(t, search, "несуществующее", 10, 0); len(results) != 0 {
+		t.Errorf("Ожидался пустой результат, получено %+v", results)
+	}
+	// Служебные символы в запросе считаются разделителями слов
+	if results := mustSearch(t, search, `"статья* OR (`, 10, 0); len(results) != 0 {
+		t.Errorf("Ожидался пустой результат, получено %+v", results)
+	}
+	if results := mustSearch(t, search, `статья" -`, 10, 0); len(results) != 1 {
+		t.Errorf("Ожидался 1 результат, получено %+v", results)
+	}
+}
+
+func testSearchTitleRanksHigher(t *testing.T, factory SearchFactory) {
+	posts, _, search := factory(t)
+	inText := newPost("Утро")
+	inText.Text = "Выпил кофе"
+	if err := posts.CreatePost(inText); err != nil {
+		t.Fatal(err)
+	}
+	inTitle := newPost("Кофе")
+	inTitle.Text = "Выпил чай"
+	if err := posts.CreatePost(inTitle); err != nil {
+		t.Fatal(err)
+	}
+
+	results := mustSearch(t, search, "кофе", 10, 0)
+	if len(results) != 2 || results[0].ID != inTitle.ID || results[1].ID != inText.ID {
+		t.Errorf("Ожидался порядок [%d %d], получено %+v", inTitle.ID, inText.ID, results)
+	}
+	if results[0].Rank <= results[1].Rank {
+		t.Errorf("Совпадение в заголовке должно быть релевантнее: %v <= %v", results[0].Rank, results[1].Rank)
+	}
+}
+
+func testSearchPagination(t *testing.T, factory SearchFactory) {
+	posts, _, search := factory(t)
+	for i := 0; i < 5; i++ {
+		mustCreatePost(t, posts, "Новости")
+	}
+
+	all := mustSearch(t, search, "новости", 10, 0)
+	if len(all) != 5 {
+		t.Fatalf("Ожидалось 5 результатов, получено %d", len(all))
+	}
+	page := mustSearch(t, search, "новости", 2, 2)
+	if len(page) != 2 || page[0].ID != all[2].ID || page[1].ID != all[3].ID {
+		t.Errorf("Ожидалась страница [%d %d], получено %+v", all[2].ID, all[3].ID, page)
+	}
+	if page := mustSearch(t, search, "новости", 10, 10); len(page) != 0 {
+		t.Errorf("Ожидалась пустая страница, получено %+v", page)
+	}
+}
+
+func testSearchUpdatedPost(t *testing.T, factory SearchFactory) {
+	posts, _, search := factory(t)
+	post := newPost("Черновик")
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	post.Title = "Публикация"
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+
+	if results := mustSearch(t, search, "черновик", 10, 0); len(results) != 0 {
+		t.Errorf("Старый заголовок не должен находиться, получено %+v", results)
+	}
+	if results := mustSearch(t, search, "публикация", 10, 0); len(results) != 1 {
+		t.Errorf("Ожидался 1 результат по новому заголовку, получено %+v", results)
+	}
+}
+
+func testSearchHidesUnapproved(t *testing.T, factory SearchFactory) {
+	posts, comments, search := factory(t)
+	post := newPost("Черновик статьи")
+	post.Status = models.StatusPending
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	approved := mustCreatePost(t, posts, "Опубликовано")
+	comment := newComment(approved.ID, nil, "Черновик комментария")
+	comment.Status = models.StatusRejected
+	if err := comments.CreateComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if results := mustSearch(t, search, "черновик", 10, 0); len(results) != 0 {
+		t.Errorf("Неодобренные записи не должны находиться, получено %+v", results)
+	}
+
+	// Одобренный комментарий скрыт вместе с неодобренным постом
+	mustCreateComment(t, comments, post.ID, nil, "Отзыв на статью")
+	if results := mustSearch(t, search, "отзыв", 10, 0); len(results) != 0 {
+		t.Errorf("Комментарии неодобренного поста не должны находиться, получено %+v", results)
+	}
+}
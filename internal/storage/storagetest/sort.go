@@ -0,0 +1,140 @@
+package storagetest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// RunCommentSort прогоняет проверки сортировки дерева комментариев.
+func RunCommentSort(t *testing.T, factory ReactionFactory) {
+	t.Run("Orders", func(t *testing.T) { testCommentSortOrders(t, factory) })
+	t.Run("HotDecay", func(t *testing.T) { testCommentSortHotDecay(t, factory) })
+	t.Run("Pagination", func(t *testing.T) { testCommentSortPagination(t, factory) })
+	t.Run("Invalid", func(t *testing.T) { testCommentSortInvalid(t, factory) })
+}
+
+// commentTree создаёт дерево, в котором комментарии с большим ID созданы позже:
+//
+//	1 (+1 -1)
+//	├── 4 (-1)
+//	│   └── 6
+//	└── 5 (+2)
+//	2 (+3)
+//	3 (+2 -1)
+func commentTree(t *testing.T, factory ReactionFactory) (storage.CommentStorage, int) {
+	posts, comments, reactions := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	base := time.Now().UTC().Truncate(time.Microsecond).Add(-24 * time.Hour)
+	parents := []int{0, 0, 0, 1, 1, 4}
+	votes := [][2]int{{1, 1}, {3, 0}, {2, 1}, {0, 1}, {2, 0}, {0, 0}}
+	for i, parent := range parents {
+		comment := newComment(post.ID, nil, fmt.Sprintf("Comment %d", i+1))
+		if parent != 0 {
+			comment.ParentCommentID = &parent
+		}
+		comment.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		if err := comments.CreateComment(comment); err != nil {
+			t.Fatal(err)
+		}
+		if comment.ID != i+1 {
+			t.Fatalf("Ожидался ID %d, получено %d", i+1, comment.ID)
+		}
+		for v := 0; v < votes[i][0]+votes[i][1]; v++ {
+			kind := models.ReactionUpvote
+			if v >= votes[i][0] {
+				kind = models.ReactionDownvote
+			}
+			mustSetReaction(t, reactions, newReaction(models.ReactionTargetComment, comment.ID, fmt.Sprintf("voter%d", v), kind))
+		}
+	}
+	return comments, post.ID
+}
+
+func commentIDs(comments []*models.Comment) []int {
+	ids := make([]int, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
+
+func testCommentSortOrders(t *testing.T, factory ReactionFactory) {
+	comments, postID := commentTree(t, factory)
+	tests := []struct {
+		order storage.CommentSort
+		want  []int
+	}{
+		{storage.CommentSortOld, []int{1, 4, 6, 5, 2, 3}},
+		{storage.CommentSortNew, []int{3, 2, 1, 5, 4, 6}},
+		{storage.CommentSortTop, []int{2, 3, 1, 5, 4, 6}},
+		// У 1 голоса разделились поровну, у 3 — почти; у 2 разногласий нет
+		{storage.CommentSortControversial, []int{1, 4, 6, 5, 3, 2}},
+		{storage.CommentSortHot, []int{2, 3, 1, 5, 4, 6}},
+		{storage.CommentSortBest, []int{2, 3, 1, 5, 4, 6}},
+	}
+	for _, tt := range tests {
+		got, err := comments.GetCommentTree(postID, "", tt.order, 10, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.order, err)
+		}
+		if ids := commentIDs(got); !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: ожидался порядок %v, получено %v", tt.order, tt.want, ids)
+		}
+	}
+
+	got, _ := comments.GetCommentTree(postID, "", storage.CommentSortTop, 10, 0)
+	if got[0].Reactions[models.ReactionUpvote] != 3 {
+		t.Errorf("Ожидались счётчики реакций в дереве, получено %v", got[0].Reactions)
+	}
+}
+
+func testCommentSortHotDecay(t *testing.T, factory ReactionFactory) {
+	posts, comments, reactions := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	old := newComment(post.ID, nil, "Old")
+	old.CreatedAt = time.Now().UTC().Truncate(time.Microsecond).Add(-48 * time.Hour)
+	if err := comments.CreateComment(old); err != nil {
+		t.Fatal(err)
+	}
+	for v := 0; v < 10; v++ {
+		mustSetReaction(t, reactions, newReaction(models.ReactionTargetComment, old.ID, fmt.Sprintf("voter%d", v), models.ReactionUpvote))
+	}
+	fresh := mustCreateComment(t, comments, post.ID, nil, "Fresh")
+
+	// Десять голосов не перевешивают двое суток новизны
+	got, _ := comments.GetCommentTree(post.ID, "", storage.CommentSortHot, 10, 0)
+	if ids := commentIDs(got); !reflect.DeepEqual(ids, []int{fresh.ID, old.ID}) {
+		t.Errorf("hot: ожидался порядок [%d %d], получено %v", fresh.ID, old.ID, ids)
+	}
+	got, _ = comments.GetCommentTree(post.ID, "", storage.CommentSortTop, 10, 0)
+	if ids := commentIDs(got); !reflect.DeepEqual(ids, []int{old.ID, fresh.ID}) {
+		t.Errorf("top: ожидался порядок [%d %d], получено %v", old.ID, fresh.ID, ids)
+	}
+}
+
+func testCommentSortPagination(t *testing.T, factory ReactionFactory) {
+	comments, postID := commentTree(t, factory)
+	got, err := comments.GetCommentTree(postID, "", storage.CommentSortOld, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := commentIDs(got); !reflect.DeepEqual(ids, []int{4, 6}) {
+		t.Errorf("Ожидалась страница [4 6], получено %v", ids)
+	}
+	got, err = comments.GetCommentTree(postID, "", storage.CommentSortOld, 10, 10)
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("Ожидалась пустая страница, получено %v, %v", got, err)
+	}
+}
+
+func testCommentSortInvalid(t *testing.T, factory ReactionFactory) {
+	_, comments, _ := factory(t)
+	if _, err := comments.GetCommentTree(1, "", "random", 10, 0); err != storage.ErrInvalidCommentSort {
+		t.Errorf("Ожидалась ошибка ErrInvalidCommentSort, получено %v", err)
+	}
+}
@@ -0,0 +1,443 @@
+// Package storagetest содержит общий набор тестов, которому должна
+// соответствовать любая реализация PostStorage и CommentStorage.
+package storagetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"ozon_test/internal/models"
+	"ozon_test/internal/storage"
+)
+
+// Factory возвращает пустые хранилища постов и комментариев, разделяющие одни данные.
+type Factory func(t *testing.T) (storage.PostStorage, storage.CommentStorage)
+
+// Run прогоняет все проверки набора для хранилищ, созданных factory.
+func Run(t *testing.T, factory Factory) {
+	t.Run("PostRoundTrip", func(t *testing.T) { testPostRoundTrip(t, factory) })
+	t.Run("PostNotFound", func(t *testing.T) { testPostNotFound(t, factory) })
+	t.Run("UpdatePost", func(t *testing.T) { testUpdatePost(t, factory) })
+	t.Run("UpdatePostVersion", func(t *testing.T) { testUpdatePostVersion(t, factory) })
+	t.Run("LastModified", func(t *testing.T) { testLastModified(t, factory) })
+	t.Run("GetAllPostsOrder", func(t *testing.T) { testGetAllPostsOrder(t, factory) })
+	t.Run("EmptyResults", func(t *testing.T) { testEmptyResults(t, factory) })
+	t.Run("CommentRoundTrip", func(t *testing.T) { testCommentRoundTrip(t, factory) })
+	t.Run("CommentPagination", func(t *testing.T) { testCommentPagination(t, factory) })
+	t.Run("InvalidParent", func(t *testing.T) { testInvalidParent(t, factory) })
+	t.Run("ConcurrentCreate", func(t *testing.T) { testConcurrentCreate(t, factory) })
+	t.Run("ModerationDecision", func(t *testing.T) { testModerationDecision(t, factory) })
+}
+
+func newPost(title string) *models.Post {
+	return &models.Post{
+		Title:         title,
+		Text:          "Text",
+		AllowComments: true,
+		Author:        "Author",
+		// Postgres хранит время с точностью до микросекунд
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func newComment(postID int, parentID *int, text string) *models.Comment {
+	return &models.Comment{
+		PostID:          postID,
+		ParentCommentID: parentID,
+		Text:            text,
+		Author:          "User",
+		CreatedAt:       time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func mustCreatePost(t *testing.T, posts storage.PostStorage, title string) *models.Post {
+	t.Helper()
+	post := newPost(title)
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatalf("Ошибка создания поста: %v", err)
+	}
+	return post
+}
+
+func mustCreateComment(t *testing.T, comments storage.CommentStorage, postID int, parentID *int, text string) *models.Comment {
+	t.Helper()
+	comment := newComment(postID, parentID, text)
+	if err := comments.CreateComment(comment); err != nil {
+		t.Fatalf("Ошибка создания комментария: %v", err)
+	}
+	return comment
+}
+
+func testPostRoundTrip(t *testing.T, factory Factory) {
+	posts, _ := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	if post.ID == 0 {
+		t.Fatal("Хранилище не присвоило посту ID")
+	}
+
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != post.ID || got.Title != post.Title || got.Text != post.Text ||
+		got.AllowComments != post.AllowComments || got.Author != post.Author {
+		t.Errorf("Ожидался пост %+v, получено %+v", post, got)
+	}
+	if !got.CreatedAt.Equal(post.CreatedAt) {
+		t.Errorf("Ожидалось время создания %v, получено %v", post.CreatedAt, got.CreatedAt)
+	}
+}
+
+func testPostNotFound(t *testing.T, factory Factory) {
+	posts, _ := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	missing := post.ID + 1000
+
+	if _, err := posts.GetPostByID(missing); err != storage.ErrNotFound {
+		t.Errorf("GetPostByID: ожидалась ошибка ErrNotFound, получено %v", err)
+	}
+	if err := posts.UpdatePost(&models.Post{ID: missing, Title: "Missing", CreatedAt: time.Now()}); err != storage.ErrNotFound {
+		t.Errorf("UpdatePost: ожидалась ошибка ErrNotFound, получено %v", err)
+	}
+}
+
+func testUpdatePost(t *testing.T, factory Factory) {
+	posts, _ := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	other := mustCreatePost(t, posts, "Other")
+
+	post.Title = "Updated"
+	post.AllowComments = false
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Updated" || got.AllowComments {
+		t.Errorf("Изменения поста не сохранились: %+v", got)
+	}
+
+	got, err = posts.GetPostByID(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Other" || !got.AllowComments {
+		t.Errorf("Изменение затронуло другой пост: %+v", got)
+	}
+}
+
+func testUpdatePostVersion(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	if post.Version != 1 {
+		t.Fatalf("Ожидалась версия 1 нового поста, получена %d", post.Version)
+	}
+	if comment := mustCreateComment(t, comments, post.ID, nil, "Comment"); comment.Version != 1 {
+		t.Errorf("Ожидалась версия 1 нового комментария, получена %d", comment.Version)
+	}
+
+	stale, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Title = "First"
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Version != 2 {
+		t.Errorf("Ожидалась версия 2 после изменения, получена %d", post.Version)
+	}
+
+	// Изменение по устаревшей копии не затирает чужое
+	stale.Title = "Second"
+	if err := posts.UpdatePost(stale); err != storage.ErrVersionConflict {
+		t.Errorf("Ожидалась ErrVersionConflict, получено %v", err)
+	}
+	// Автор и время создания не меняются
+	post.Author = "Other"
+	post.CreatedAt = post.CreatedAt.Add(time.Hour)
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "First" || got.Version != 3 || got.Author != "Author" || !got.CreatedAt.Equal(stale.CreatedAt) {
+		t.Errorf("Ожидался пост First версии 3 с прежними автором и временем, получено %+v", got)
+	}
+}
+
+func testLastModified(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+	if last, err := posts.LastModified(); err != nil || !last.IsZero() {
+		t.Fatalf("Ожидалось нулевое время без постов: %v, %v", last, err)
+	}
+	post := mustCreatePost(t, posts, "Test")
+	other := mustCreatePost(t, posts, "Other")
+	if post.UpdatedAt.IsZero() || other.UpdatedAt.Before(post.UpdatedAt) {
+		t.Fatalf("Ожидалось время изменения новых постов, получено %v и %v", post.UpdatedAt, other.UpdatedAt)
+	}
+	if last, err := posts.LastModified(); err != nil || !last.Equal(other.UpdatedAt) {
+		t.Errorf("Ожидалось время изменения %v, получено %v, %v", other.UpdatedAt, last, err)
+	}
+
+	if last, err := comments.LastModified(post.ID); err != nil || !last.IsZero() {
+		t.Errorf("Ожидалось нулевое время без комментариев: %v, %v", last, err)
+	}
+	comment := mustCreateComment(t, comments, post.ID, nil, "Comment")
+	mustCreateComment(t, comments, other.ID, nil, "Other")
+	if last, err := comments.LastModified(post.ID); err != nil || !last.Equal(comment.UpdatedAt) {
+		t.Errorf("Ожидалось время изменения комментариев %v, получено %v, %v", comment.UpdatedAt, last, err)
+	}
+
+	created := post.UpdatedAt
+	post.Title = "Updated"
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	if post.UpdatedAt.Before(created) {
+		t.Errorf("Время изменения не должно уменьшаться: было %v, стало %v", created, post.UpdatedAt)
+	}
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.UpdatedAt.Equal(post.UpdatedAt) || !got.CreatedAt.Equal(post.CreatedAt) {
+		t.Errorf("Ожидалось время изменения %v, получено %+v", post.UpdatedAt, got)
+	}
+	if last, err := posts.LastModified(); err != nil || last.Before(post.UpdatedAt) {
+		t.Errorf("Ожидалось время изменения не раньше %v, получено %v, %v", post.UpdatedAt, last, err)
+	}
+}
+
+func testGetAllPostsOrder(t *testing.T, factory Factory) {
+	posts, _ := factory(t)
+	var ids []int
+	for _, title := range []string{"First", "Second", "Third", "Fourth", "Fifth"} {
+		ids = append(ids, mustCreatePost(t, posts, title).ID)
+	}
+
+	all, err := posts.GetAllPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(ids) {
+		t.Fatalf("Ожидалось %d постов, получено %d", len(ids), len(all))
+	}
+	for i, post := range all {
+		if post.ID != ids[i] {
+			t.Errorf("Позиция %d: ожидался пост %d, получено %d", i, ids[i], post.ID)
+		}
+	}
+}
+
+func testEmptyResults(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+
+	all, err := posts.GetAllPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all == nil || len(all) != 0 {
+		t.Errorf("Ожидался пустой срез постов (не nil), получено %#v", all)
+	}
+
+	post := mustCreatePost(t, posts, "Test")
+	page, err := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page == nil || len(page) != 0 {
+		t.Errorf("Ожидался пустой срез комментариев (не nil), получено %#v", page)
+	}
+}
+
+func testCommentRoundTrip(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	other := mustCreatePost(t, posts, "Other")
+
+	parent := mustCreateComment(t, comments, post.ID, nil, "Parent")
+	reply := mustCreateComment(t, comments, post.ID, &parent.ID, "Reply")
+	mustCreateComment(t, comments, other.ID, nil, "Elsewhere")
+
+	got, err := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Ожидалось 2 комментария, получено %d", len(got))
+	}
+	if got[0].ID != parent.ID || got[0].ParentCommentID != nil || got[0].Text != "Parent" {
+		t.Errorf("Неожиданный корневой комментарий: %+v", got[0])
+	}
+	if got[1].ID != reply.ID || got[1].ParentCommentID == nil || *got[1].ParentCommentID != parent.ID {
+		t.Errorf("Неожиданный ответ: %+v", got[1])
+	}
+	if got[1].PostID != post.ID || got[1].Author != reply.Author || !got[1].CreatedAt.Equal(reply.CreatedAt) {
+		t.Errorf("Ожидался комментарий %+v, получено %+v", reply, got[1])
+	}
+}
+
+func testInvalidParent(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	other := mustCreatePost(t, posts, "Other")
+	foreign := mustCreateComment(t, comments, other.ID, nil, "Elsewhere")
+
+	if err := comments.CreateComment(newComment(post.ID, &foreign.ID, "Reply")); err != storage.ErrInvalidParent {
+		t.Errorf("Ответ на комментарий другого поста: ожидалась ошибка ErrInvalidParent, получено %v", err)
+	}
+	missing := foreign.ID + 1000
+	if err := comments.CreateComment(newComment(post.ID, &missing, "Reply")); err != storage.ErrInvalidParent {
+		t.Errorf("Ответ на несуществующий комментарий: ожидалась ошибка ErrInvalidParent, получено %v", err)
+	}
+
+	page, err := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 0 {
+		t.Errorf("Отклонённые ответы не должны сохраняться, получено %d комментариев", len(page))
+	}
+}
+
+func testCommentPagination(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+	var ids []int
+	for i := 0; i < 7; i++ {
+		ids = append(ids, mustCreateComment(t, comments, post.ID, nil, "Comment").ID)
+	}
+
+	cases := []struct {
+		name          string
+		limit, offset int
+		want          []int
+	}{
+		{"first page", 3, 0, ids[0:3]},
+		{"middle page", 3, 3, ids[3:6]},
+		{"partial last page", 3, 6, ids[6:7]},
+		{"offset at end", 3, 7, []int{}},
+		{"offset past end", 3, 100, []int{}},
+		{"limit past end", 100, 0, ids},
+		{"zero limit", 0, 0, []int{}},
+		{"negative offset", 2, -5, ids[0:2]},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := comments.GetCommentsByPostID(post.ID, tc.limit, tc.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page == nil {
+				t.Fatal("Ожидался срез, получено nil")
+			}
+			if len(page) != len(tc.want) {
+				t.Fatalf("Ожидалось %d комментариев, получено %d", len(tc.want), len(page))
+			}
+			for i, comment := range page {
+				if comment.ID != tc.want[i] {
+					t.Errorf("Позиция %d: ожидался комментарий %d, получено %d", i, tc.want[i], comment.ID)
+				}
+			}
+		})
+	}
+
+	// Повторный запрос той же страницы возвращает тот же результат
+	first, _ := comments.GetCommentsByPostID(post.ID, 3, 2)
+	second, _ := comments.GetCommentsByPostID(post.ID, 3, 2)
+	for i := range first {
+		if first[i].ID != second[i].ID {
+			t.Errorf("Страница нестабильна: позиция %d содержит %d и %d", i, first[i].ID, second[i].ID)
+		}
+	}
+}
+
+func testConcurrentCreate(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+	post := mustCreatePost(t, posts, "Test")
+
+	const workers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- posts.CreatePost(newPost("Concurrent"))
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- comments.CreateComment(newComment(post.ID, nil, "Concurrent"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Ошибка конкурентной записи: %v", err)
+		}
+	}
+
+	all, err := posts.GetAllPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != workers+1 {
+		t.Errorf("Ожидалось %d постов, получено %d", workers+1, len(all))
+	}
+	seen := make(map[int]bool)
+	for _, p := range all {
+		if seen[p.ID] {
+			t.Errorf("ID %d присвоен нескольким постам", p.ID)
+		}
+		seen[p.ID] = true
+	}
+
+	page, err := comments.GetCommentsByPostID(post.ID, 2*workers, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != workers {
+		t.Errorf("Ожидалось %d комментариев, получено %d", workers, len(page))
+	}
+}
+
+func testModerationDecision(t *testing.T, factory Factory) {
+	posts, comments := factory(t)
+	post := newPost("Test")
+	post.ModerationAction, post.ModerationReason = "hold", "ссылок больше 3"
+	if err := posts.CreatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	post.AllowComments = false
+	if err := posts.UpdatePost(post); err != nil {
+		t.Fatal(err)
+	}
+	got, err := posts.GetPostByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ModerationAction != "hold" || got.ModerationReason != "ссылок больше 3" {
+		t.Errorf("Ожидалось решение модерации hold, получено %q, %q", got.ModerationAction, got.ModerationReason)
+	}
+
+	comment := newComment(post.ID, nil, "***")
+	comment.ModerationAction, comment.ModerationReason = "mask", "запрещённые слова"
+	if err := comments.CreateComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	page, err := comments.GetCommentsByPostID(post.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ModerationAction != "mask" || page[0].ModerationReason != "запрещённые слова" {
+		t.Errorf("Ожидалось решение модерации mask, получено %+v", page)
+	}
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"ozon_test/internal/models"
+)
+
+// Tx — хранилища, работающие в рамках одной транзакции.
+type Tx interface {
+	Posts() PostStorage
+	Comments() CommentStorage
+	// GetPostForShare читает пост и не даёт изменить его до конца транзакции.
+	GetPostForShare(id int) (*models.Post, error)
+	// GetPostForUpdate читает пост и не даёт другим транзакциям ни изменить его,
+	// ни заблокировать на чтение до конца транзакции.
+	GetPostForUpdate(id int) (*models.Post, error)
+}
+
+// TxManager выполняет fn в транзакции, охватывающей хранилища постов и комментариев.
+// Если fn вернула ошибку, транзакция откатывается.
+type TxManager interface {
+	WithinTx(fn func(tx Tx) error) error
+}
+
+type storageTx struct {
+	posts     PostStorage
+	comments  CommentStorage
+	forShare  func(id int) (*models.Post, error)
+	forUpdate func(id int) (*models.Post, error)
+}
+
+func (t *storageTx) Posts() PostStorage {
+	return t.posts
+}
+
+func (t *storageTx) Comments() CommentStorage {
+	return t.comments
+}
+
+func (t *storageTx) GetPostForShare(id int) (*models.Post, error) {
+	return t.forShare(id)
+}
+
+func (t *storageTx) GetPostForUpdate(id int) (*models.Post, error) {
+	return t.forUpdate(id)
+}
+
+// InMemoryTxManager объединяет in-memory хранилища в один домен блокировки:
+// транзакции выполняются строго по очереди. Изменения, сделанные до ошибки,
+// не откатываются, поэтому запись должна быть последним шагом транзакции.
+type InMemoryTxManager struct {
+	mu       sync.Mutex
+	posts    *InMemoryPostStorage
+	comments *InMemoryCommentStorage
+}
+
+func NewInMemoryTxManager(posts *InMemoryPostStorage, comments *InMemoryCommentStorage) *InMemoryTxManager {
+	return &InMemoryTxManager{posts: posts, comments: comments}
+}
+
+func (m *InMemoryTxManager) WithinTx(fn func(tx Tx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fn(&storageTx{
+		posts:     m.posts,
+		comments:  m.comments,
+		forShare:  m.posts.GetPostByID,
+		forUpdate: m.posts.GetPostByID,
+	})
+}
+
+type PostgresTxManager struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresTxManager(pool *pgxpool.Pool) *PostgresTxManager {
+	return &PostgresTxManager{pool: pool}
+}
+
+func (m *PostgresTxManager) WithinTx(fn func(tx Tx) error) error {
+	ctx := context.Background()
+	pgTx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// После Commit откат ничего не делает
+	defer pgTx.Rollback(ctx)
+
+	posts := &PostgresPostStorage{db: pgTx, read: pgTx}
+	tx := &storageTx{
+		posts:    posts,
+		comments: &PostgresCommentStorage{db: pgTx, read: pgTx},
+		forShare: func(id int) (*models.Post, error) {
+			return posts.getPostByID(id, "FOR SHARE")
+		},
+		forUpdate: func(id int) (*models.Post, error) {
+			return posts.getPostByID(id, "FOR UPDATE")
+		},
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return pgTx.Commit(ctx)
+}
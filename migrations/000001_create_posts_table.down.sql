@@ -1 +1 @@
-DROP TABLE posts;
\ No newline at end of file
+DROP TABLE IF EXISTS posts;
\ No newline at end of file
@@ -1 +1 @@
-DROP TABLE comments;
\ No newline at end of file
+DROP TABLE IF EXISTS comments;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE comments ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
+ALTER TABLE posts ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
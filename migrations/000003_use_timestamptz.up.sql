@@ -0,0 +1,8 @@
+-- Условие применения: сервис, писавший в эти колонки, работал в часовом
+-- поясе UTC. Драйвер pgx записывал в TIMESTAMP местное время процесса
+-- (time.Now()) без пояса, поэтому значения трактуются как время в UTC.
+-- Если сервис работал в другом поясе, до применения миграции замените
+-- 'UTC' ниже на этот пояс (например, 'Europe/Moscow'): иначе время всех
+-- существующих строк сместится на разницу поясов.
+ALTER TABLE posts ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+ALTER TABLE comments ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
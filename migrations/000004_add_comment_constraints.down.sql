@@ -0,0 +1,12 @@
+ALTER TABLE comments DROP CONSTRAINT comments_text_length_check;
+
+ALTER TABLE comments DROP CONSTRAINT comments_parent_same_post_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_parent_comment_id_fkey
+    FOREIGN KEY (parent_comment_id) REFERENCES comments(id);
+ALTER TABLE comments DROP CONSTRAINT comments_id_post_id_key;
+
+ALTER TABLE comments DROP CONSTRAINT comments_post_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_post_id_fkey
+    FOREIGN KEY (post_id) REFERENCES posts(id);
+
+ALTER TABLE comments ALTER COLUMN post_id DROP NOT NULL;
@@ -0,0 +1,15 @@
+ALTER TABLE comments ALTER COLUMN post_id SET NOT NULL;
+
+ALTER TABLE comments DROP CONSTRAINT comments_post_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_post_id_fkey
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE;
+
+-- Ответ и родительский комментарий обязаны принадлежать одному посту:
+-- внешний ключ ссылается на пару (id, post_id) родителя
+ALTER TABLE comments ADD CONSTRAINT comments_id_post_id_key UNIQUE (id, post_id);
+ALTER TABLE comments DROP CONSTRAINT comments_parent_comment_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_parent_same_post_fkey
+    FOREIGN KEY (parent_comment_id, post_id) REFERENCES comments(id, post_id) ON DELETE CASCADE;
+
+-- Ограничение совпадает с проверкой в CommentService
+ALTER TABLE comments ADD CONSTRAINT comments_text_length_check CHECK (octet_length(text) <= 2000);
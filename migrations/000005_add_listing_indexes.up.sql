@@ -0,0 +1,4 @@
+-- Выборка комментариев поста: WHERE post_id = $1 ORDER BY id LIMIT/OFFSET
+CREATE INDEX comments_post_id_id_idx ON comments (post_id, id);
+-- Поиск ответов и каскадное удаление по родителю
+CREATE INDEX comments_parent_comment_id_idx ON comments (parent_comment_id);
@@ -0,0 +1,10 @@
+-- Полнотекстовый поиск: конфигурация simple не зависит от языка
+-- и одинаково разбирает русский и английский текст
+ALTER TABLE posts ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', text), 'B')
+) STORED;
+ALTER TABLE comments ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', text)
+) STORED;
+CREATE INDEX posts_search_idx ON posts USING GIN (search);
+CREATE INDEX comments_search_idx ON comments USING GIN (search);
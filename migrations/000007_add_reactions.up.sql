@@ -0,0 +1,17 @@
+-- Первичный ключ гарантирует одну реакцию автора на цель
+-- и служит индексом для подсчёта реакций цели
+CREATE TABLE post_reactions (
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    author TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (post_id, author)
+);
+
+CREATE TABLE comment_reactions (
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    author TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (comment_id, author)
+);
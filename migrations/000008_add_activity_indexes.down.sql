@@ -0,0 +1,3 @@
+DROP INDEX comment_reactions_created_at_idx;
+DROP INDEX post_reactions_created_at_idx;
+DROP INDEX comments_created_at_idx;
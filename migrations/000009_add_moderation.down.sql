@@ -0,0 +1,4 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS moderation_reason;
+ALTER TABLE comments DROP COLUMN IF EXISTS moderation_action;
+ALTER TABLE posts DROP COLUMN IF EXISTS moderation_reason;
+ALTER TABLE posts DROP COLUMN IF EXISTS moderation_action;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS comments_pending_idx;
+DROP INDEX IF EXISTS posts_pending_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
+ALTER TABLE posts DROP COLUMN IF EXISTS status;
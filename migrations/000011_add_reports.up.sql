@@ -0,0 +1,26 @@
+-- Первичный ключ гарантирует одну жалобу пользователя на цель
+CREATE TABLE post_reports (
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    reporter TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (post_id, reporter)
+);
+
+CREATE TABLE comment_reports (
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    reporter TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (comment_id, reporter)
+);
+
+-- Список открытых жалоб: WHERE resolution = '' ORDER BY created_at
+CREATE INDEX post_reports_open_idx ON post_reports (created_at) WHERE resolution = '';
+CREATE INDEX comment_reports_open_idx ON comment_reports (created_at) WHERE resolution = '';
@@ -0,0 +1,15 @@
+-- Ответы на запросы с заголовком Idempotency-Key; status_code = 0,
+-- пока первый запрос выполняется
+CREATE TABLE idempotency_keys (
+    owner TEXT NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (owner, key)
+);
+
+-- Удаление устаревших ключей: WHERE created_at < $1
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
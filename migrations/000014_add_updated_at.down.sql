@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS comments_post_id_updated_at_idx;
+DROP INDEX IF EXISTS posts_updated_at_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS updated_at;
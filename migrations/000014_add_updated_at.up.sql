@@ -0,0 +1,13 @@
+-- Время последнего изменения записи для заголовка Last-Modified;
+-- существующие записи получают время создания
+ALTER TABLE posts ADD COLUMN updated_at TIMESTAMPTZ;
+UPDATE posts SET updated_at = created_at;
+ALTER TABLE posts ALTER COLUMN updated_at SET NOT NULL;
+
+ALTER TABLE comments ADD COLUMN updated_at TIMESTAMPTZ;
+UPDATE comments SET updated_at = created_at;
+ALTER TABLE comments ALTER COLUMN updated_at SET NOT NULL;
+
+-- Время последнего изменения постов и комментариев поста
+CREATE INDEX posts_updated_at_idx ON posts (updated_at);
+CREATE INDEX comments_post_id_updated_at_idx ON comments (post_id, updated_at);
@@ -0,0 +1,4 @@
+-- Жалоба, на которой цель достигла порога и была скрыта: отклонение
+-- жалоб возвращает одобрение только такой цели
+ALTER TABLE post_reports ADD COLUMN hid_target BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE comment_reports ADD COLUMN hid_target BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Заголовки сохранённого ответа (ETag, Location, Last-Modified) в JSON:
+-- повтор запроса получает их вместе с телом
+ALTER TABLE idempotency_keys ADD COLUMN headers TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,15 @@
+// Package migrations встраивает SQL-миграции в бинарный файл, чтобы
+// приложение не зависело от рабочего каталога.
+package migrations
+
+import "embed"
+
+// FS содержит миграции PostgreSQL в корне и миграции SQLite в каталоге sqlite.
+//
+//go:embed *.sql sqlite/*.sql
+var FS embed.FS
+
+const (
+	PostgresDir = "."
+	SQLiteDir   = "sqlite"
+)
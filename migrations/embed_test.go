@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEveryMigrationHasDown(t *testing.T) {
+	for _, dir := range []string{PostgresDir, SQLiteDir} {
+		entries, err := fs.ReadDir(FS, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ups := 0
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), ".up.sql") {
+				continue
+			}
+			ups++
+			down := path.Join(dir, strings.TrimSuffix(e.Name(), ".up.sql")+".down.sql")
+			data, err := fs.ReadFile(FS, down)
+			if err != nil {
+				t.Errorf("Нет отката для %s: %v", path.Join(dir, e.Name()), err)
+				continue
+			}
+			if strings.TrimSpace(string(data)) == "" {
+				t.Errorf("Пустой откат %s", down)
+			}
+		}
+		if ups == 0 {
+			t.Errorf("В каталоге %q нет встроенных миграций", dir)
+		}
+	}
+}
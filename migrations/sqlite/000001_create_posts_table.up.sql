@@ -0,0 +1,8 @@
+CREATE TABLE posts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    text TEXT NOT NULL,
+    allow_comments BOOLEAN NOT NULL,
+    author TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
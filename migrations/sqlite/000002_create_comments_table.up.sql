@@ -0,0 +1,8 @@
+CREATE TABLE comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER REFERENCES posts(id),
+    parent_comment_id INTEGER REFERENCES comments(id),
+    text TEXT NOT NULL,
+    author TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
@@ -0,0 +1,14 @@
+CREATE TABLE comments_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER REFERENCES posts(id),
+    parent_comment_id INTEGER REFERENCES comments(id),
+    text TEXT NOT NULL,
+    author TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+INSERT INTO comments_old (id, post_id, parent_comment_id, text, author, created_at)
+SELECT id, post_id, parent_comment_id, text, author, created_at FROM comments;
+
+DROP TABLE comments;
+ALTER TABLE comments_old RENAME TO comments;
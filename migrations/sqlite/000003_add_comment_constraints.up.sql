@@ -0,0 +1,20 @@
+-- SQLite не умеет менять ограничения существующей таблицы, поэтому таблица
+-- пересоздаётся. Соединение миграций работает без проверки внешних ключей
+-- (PRAGMA foreign_keys выключена по умолчанию), поэтому DROP не затрагивает ответы.
+CREATE TABLE comments_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    parent_comment_id INTEGER,
+    text TEXT NOT NULL CHECK (length(CAST(text AS BLOB)) <= 2000),
+    author TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    UNIQUE (id, post_id),
+    -- Ответ и родительский комментарий обязаны принадлежать одному посту
+    FOREIGN KEY (parent_comment_id, post_id) REFERENCES comments(id, post_id) ON DELETE CASCADE
+);
+
+INSERT INTO comments_new (id, post_id, parent_comment_id, text, author, created_at)
+SELECT id, post_id, parent_comment_id, text, author, created_at FROM comments;
+
+DROP TABLE comments;
+ALTER TABLE comments_new RENAME TO comments;
@@ -0,0 +1,2 @@
+DROP INDEX comments_parent_comment_id_idx;
+DROP INDEX comments_post_id_id_idx;
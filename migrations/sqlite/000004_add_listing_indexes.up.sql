@@ -0,0 +1,2 @@
+CREATE INDEX comments_post_id_id_idx ON comments (post_id, id);
+CREATE INDEX comments_parent_comment_id_idx ON comments (parent_comment_id);
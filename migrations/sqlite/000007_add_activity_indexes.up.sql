@@ -0,0 +1,4 @@
+-- Выборка свежей активности для горячей ленты: WHERE created_at >= ?
+CREATE INDEX comments_created_at_idx ON comments (created_at);
+CREATE INDEX post_reactions_created_at_idx ON post_reactions (created_at);
+CREATE INDEX comment_reactions_created_at_idx ON comment_reactions (created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE comments DROP COLUMN moderation_reason;
+ALTER TABLE comments DROP COLUMN moderation_action;
+ALTER TABLE posts DROP COLUMN moderation_reason;
+ALTER TABLE posts DROP COLUMN moderation_action;
@@ -0,0 +1,5 @@
+-- Решение модерации при создании: пусто, mask или hold, и его причина
+ALTER TABLE posts ADD COLUMN moderation_action TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN moderation_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE comments ADD COLUMN moderation_action TEXT NOT NULL DEFAULT '';
+ALTER TABLE comments ADD COLUMN moderation_reason TEXT NOT NULL DEFAULT '';
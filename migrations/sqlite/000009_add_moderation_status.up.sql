@@ -0,0 +1,6 @@
+-- Статус модерации; существующие записи считаются одобренными
+ALTER TABLE posts ADD COLUMN status TEXT NOT NULL DEFAULT 'approved';
+ALTER TABLE comments ADD COLUMN status TEXT NOT NULL DEFAULT 'approved';
+-- Очередь модерации: WHERE status = 'pending' ORDER BY created_at
+CREATE INDEX posts_pending_idx ON posts (created_at) WHERE status = 'pending';
+CREATE INDEX comments_pending_idx ON comments (created_at) WHERE status = 'pending';
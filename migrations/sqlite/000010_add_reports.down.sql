@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS comment_reports;
+DROP TABLE IF EXISTS post_reports;
@@ -0,0 +1,22 @@
+-- Первичный ключ гарантирует одну жалобу пользователя на цель
+CREATE TABLE post_reports (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    reporter TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (post_id, reporter)
+);
+
+CREATE TABLE comment_reports (
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    reporter TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (comment_id, reporter)
+);
@@ -0,0 +1,15 @@
+-- Ответы на запросы с заголовком Idempotency-Key; status_code = 0,
+-- пока первый запрос выполняется. created_at хранится в наносекундах
+-- Unix: так сравнение времени не зависит от часового пояса записи
+CREATE TABLE idempotency_keys (
+    owner TEXT NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BLOB,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (owner, key)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
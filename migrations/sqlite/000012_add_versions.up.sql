@@ -0,0 +1,3 @@
+-- Версия записи для оптимистичной блокировки; существующие записи получают версию 1
+ALTER TABLE posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE comments ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
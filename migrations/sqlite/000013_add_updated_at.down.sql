@@ -0,0 +1,4 @@
+DROP INDEX comments_post_id_updated_at_idx;
+DROP INDEX posts_updated_at_idx;
+ALTER TABLE comments DROP COLUMN updated_at;
+ALTER TABLE posts DROP COLUMN updated_at;
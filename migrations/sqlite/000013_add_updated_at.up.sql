@@ -0,0 +1,12 @@
+-- Время последнего изменения записи для заголовка Last-Modified. Время
+-- хранится строкой в UTC, в формате драйвера: так строки упорядочены как время.
+-- created_at записан в поясе сервера, поэтому существующие записи получают
+-- время применения миграции
+ALTER TABLE posts ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '';
+UPDATE posts SET updated_at = strftime('%Y-%m-%d %H:%M:%f +0000 UTC', 'now');
+
+ALTER TABLE comments ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '';
+UPDATE comments SET updated_at = strftime('%Y-%m-%d %H:%M:%f +0000 UTC', 'now');
+
+CREATE INDEX posts_updated_at_idx ON posts (updated_at);
+CREATE INDEX comments_post_id_updated_at_idx ON comments (post_id, updated_at);
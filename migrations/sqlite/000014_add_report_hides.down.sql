@@ -0,0 +1,2 @@
+ALTER TABLE comment_reports DROP COLUMN hid_target;
+ALTER TABLE post_reports DROP COLUMN hid_target;